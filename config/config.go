@@ -17,8 +17,11 @@ type Config struct {
 		Addr string `yaml:"-"` // 不从配置文件读取，而是在加载后计算
 	} `yaml:"server"`
 	ExternalAPI struct {
-		TagPushURL string `yaml:"tag_push_url"`
-		APIKey     string `yaml:"api_key"`
+		TagPushURL      string            `yaml:"tag_push_url"`
+		APIKey          string            `yaml:"api_key"`
+		ChannelPushURLs map[string]string `yaml:"channel_push_urls"` // 推送渠道 -> 推送接口地址，用户可选择的渠道；默认渠道 app 使用 tag_push_url
+		// 推送接口是否支持群发时通过 exclude_cids 排除用户；不支持时有退订用户则不群发
+		BroadcastExcludeSupported bool `yaml:"broadcast_exclude_supported"`
 	} `yaml:"external_api"`
 	SiliconFlow struct {
 		APIKey         string `yaml:"api_key"`
@@ -53,6 +56,23 @@ type Config struct {
 		Concurrency     int `yaml:"concurrency"`      // 用户画像生成并发数
 		PushConcurrency int `yaml:"push_concurrency"` // 推送并发数
 	} `yaml:"cron"`
+	Profile struct {
+		DecayHalfLifeDays float64 `yaml:"decay_half_life_days"` // 合并画像时关键词权重的半衰期（天），0表示不衰减
+		PruneThreshold    float64 `yaml:"prune_threshold"`      // 衰减后权重低于该值的关键词从画像中移除
+		SourceWeights     struct {
+			CommunityPosts    float64 `yaml:"community_posts"`    // 社区发帖的权重
+			GroupMessages     float64 `yaml:"group_messages"`     // 群聊消息的权重
+			AssistantSessions float64 `yaml:"assistant_sessions"` // AI助手会话提问的权重
+		} `yaml:"source_weights"` // 各数据来源在画像中的相对权重，写入提示词并用于降级生成的关键词计分
+		BehaviorWeights struct {
+			Post    float64 `yaml:"post"`    // 发帖
+			Comment float64 `yaml:"comment"` // 评论
+			Share   float64 `yaml:"share"`   // 转发
+			Like    float64 `yaml:"like"`    // 点赞
+		} `yaml:"behavior_weights"` // 社区各行为类型的权重，与社区发帖的来源权重相乘
+		BehaviorTypes map[string]string  `yaml:"behavior_types"` // behavior_type 取值到行为类别（post/comment/share/like）的映射，补充内置映射
+		GroupRules    []GroupProfileRule `yaml:"group_rules"`    // 按加入的群组推断用户类型和兴趣，为空时使用内置规则
+	} `yaml:"profile"`
 	RAG struct {
 		URL          string   `yaml:"url"`
 		APIKey       string   `yaml:"api_key"`
@@ -60,7 +80,81 @@ type Config struct {
 		TopK         int      `yaml:"topk"`        // 搜索返回的最大结果数
 		Threshold    float32  `yaml:"threshold"`   // 搜索相似度阈值
 		TimeoutSec   int      `yaml:"timeout_sec"` // 请求超时时间,单位:秒
+		RRFK         float64  `yaml:"rrf_k"`       // 加权倒数排名融合的平滑常数
+
+		MaxConcurrency     int     `yaml:"max_concurrency"`      // 全局RAG并发请求数
+		PerUserConcurrency int     `yaml:"per_user_concurrency"` // 单个用户的RAG并发请求数
+		EarlyStopScore     float64 `yaml:"early_stop_score"`     // 高分结果阈值，高分结果达到topk时取消剩余检索，0表示不提前结束
+		MultiQuery         bool    `yaml:"multi_query"`          // RAG服务是否支持一次请求多个查询
+		MultiQueryURL      string  `yaml:"multi_query_url"`      // 多查询接口地址，为空时使用url
+		BatchSize          int     `yaml:"batch_size"`           // 多查询时每批关键词数量
+		CacheTTLSec        int     `yaml:"cache_ttl_sec"`        // 检索结果缓存有效期（秒），0使用默认值，负数禁用缓存
+		CacheMaxEntries    int     `yaml:"cache_max_entries"`    // 检索结果缓存最大条目数
+
+		KBPolicies map[string]KBPolicy `yaml:"kb_policies"` // 按知识库ID配置的检索策略，配置后每个知识库单独检索再合并
 	} `yaml:"rag"`
+	Diversity struct {
+		Enabled             bool    `yaml:"enabled"`              // 是否启用多样性重排
+		Lambda              float64 `yaml:"lambda"`               // MMR中相关性的权重（0-1），越小越强调多样性
+		ShingleSize         int     `yaml:"shingle_size"`         // 文本相似度计算的字符片段长度
+		DuplicateThreshold  float64 `yaml:"duplicate_threshold"`  // 相似度达到该值视为近似重复，直接剔除
+		MaxPerDocument      int     `yaml:"max_per_document"`     // 同一文档最多保留的条目数，0表示不限制
+		MaxPerKB            int     `yaml:"max_per_kb"`           // 同一知识库最多保留的条目数，0表示不限制
+		MinInterests        int     `yaml:"min_interests"`        // 至少覆盖的用户兴趣数
+		CandidateMultiplier int     `yaml:"candidate_multiplier"` // 候选池大小为topk的倍数
+	} `yaml:"diversity"`
+	Hybrid struct {
+		Enabled            bool    `yaml:"enabled"`              // 是否启用知识库+群聊总结混合召回
+		LookbackDays       int     `yaml:"lookback_days"`        // 群聊总结回溯天数
+		KnowledgeBaseQuota int     `yaml:"knowledge_base_quota"` // 知识库结果最多条数，0表示不限制
+		GroupSummaryQuota  int     `yaml:"group_summary_quota"`  // 群聊总结结果最多条数，0表示不限制
+		GroupSummaryWeight float64 `yaml:"group_summary_weight"` // 群聊总结归一化分数的权重
+	} `yaml:"hybrid"`
+	Collaborative struct {
+		Enabled       bool    `yaml:"enabled"`        // 是否用相似用户点击或推送过的内容补充推荐
+		MinResults    int     `yaml:"min_results"`    // 自身推荐结果少于该数量时补充，0表示使用rag.topk
+		NeighborCount int     `yaml:"neighbor_count"` // 参与推荐的相似用户数
+		MinSimilarity float64 `yaml:"min_similarity"` // 相似用户的最低余弦相似度
+		LookbackDays  int     `yaml:"lookback_days"`  // 相似用户推送和点击记录的回溯天数
+		ClickWeight   float64 `yaml:"click_weight"`   // 相似用户点击过的内容的权重
+		PushWeight    float64 `yaml:"push_weight"`    // 相似用户收到但未点击的内容的权重
+		IndexTTLSec   int     `yaml:"index_ttl_sec"`  // 相似度索引的重建间隔（秒），画像生成完成后也会重建
+	} `yaml:"collaborative"`
+	Synonyms struct {
+		Enabled             bool    `yaml:"enabled"`               // 是否启用关键词规范化和同义词扩展
+		ExpansionWeight     float64 `yaml:"expansion_weight"`      // 扩展查询的权重相对原关键词的比例
+		MaxExpansions       int     `yaml:"max_expansions"`        // 每个关键词最多扩展的同义词数
+		ReloadIntervalSec   int     `yaml:"reload_interval_sec"`   // 词典重新加载间隔（秒）
+		LLMSuggestions      bool    `yaml:"llm_suggestions"`       // 是否允许调用LLM生成同义词建议
+		SuggestionBatchSize int     `yaml:"suggestion_batch_size"` // 每次交给LLM分析的关键词数
+	} `yaml:"synonyms"`
+	Fallback struct {
+		Enabled            bool    `yaml:"enabled"`              // RAG服务不可用时是否使用本地全文索引
+		SnapshotURL        string  `yaml:"snapshot_url"`         // 知识库文档快照接口地址，为空时只使用检索过程中收集的文档
+		SnapshotPath       string  `yaml:"snapshot_path"`        // 快照本地保存路径，启动时先从该文件加载
+		RefreshIntervalSec int     `yaml:"refresh_interval_sec"` // 快照刷新间隔（秒）
+		MaxDocuments       int     `yaml:"max_documents"`        // 索引最多收录的文档片段数
+		FailureThreshold   int     `yaml:"failure_threshold"`    // RAG连续失败达到该次数后直接使用本地索引
+		CooldownSec        int     `yaml:"cooldown_sec"`         // 直接使用本地索引的持续时间（秒），之后重新尝试RAG服务
+		K1                 float64 `yaml:"k1"`                   // BM25词频饱和参数
+		B                  float64 `yaml:"b"`                    // BM25文档长度归一化参数
+		MinRelativeScore   float64 `yaml:"min_relative_score"`   // 结果分数相对最高分的最低比例
+	} `yaml:"fallback"`
+	Webhook struct {
+		Secret                  string `yaml:"secret"`                   // 知识库webhook校验令牌，为空时拒绝所有webhook请求
+		QueueSize               int    `yaml:"queue_size"`               // 推荐内容重新生成队列长度
+		RegenerationConcurrency int    `yaml:"regeneration_concurrency"` // 重新生成队列的工作协程数
+		MaxProbeKeywords        int    `yaml:"max_probe_keywords"`       // 新增文档时最多探测的画像关键词数
+	} `yaml:"webhook"`
+	Moderation struct {
+		Enabled          bool     `yaml:"enabled"`            // 是否启用内容审核
+		ExcludeRiskPosts bool     `yaml:"exclude_risk_posts"` // 生成画像时排除 law/politics/ad 被标记的社区帖子
+		RiskPassValues   []string `yaml:"risk_pass_values"`   // law/politics/ad 字段表示未命中风险的取值，为空时使用内置取值
+		MaxRiskScore     float64  `yaml:"max_risk_score"`     // score 高于该值的帖子视为有风险，0表示不按分数过滤
+		Blocklist        []string `yaml:"blocklist"`          // 推送内容屏蔽词，标题或内容包含任一屏蔽词时进入人工审核
+		LLMClassifier    bool     `yaml:"llm_classifier"`     // 是否调用LLM判断推送内容是否合规
+		LLMFailClosed    bool     `yaml:"llm_fail_closed"`    // LLM审核失败时是否将内容全部转人工审核
+	} `yaml:"moderation"`
 	LLM struct {
 		MaxConcurrency int `yaml:"max_concurrency"` // LLM并发请求数
 	} `yaml:"llm"`
@@ -74,12 +168,45 @@ type Config struct {
 		RecommendationFreq int  `yaml:"recommendation_freq"` // debug模式下推荐频率，单位：秒
 	} `yaml:"debug"`
 	Scheduler struct {
-		CheckIntervalSec int `yaml:"check_interval_sec"` // 调度器检查间隔（秒）
-		DefaultHour      int `yaml:"default_hour"`       // 默认执行小时
-		DefaultMinute    int `yaml:"default_minute"`     // 默认执行分钟
+		Timezone             string                 `yaml:"timezone"`               // 任务默认时区，如 Asia/Shanghai，为空使用服务器本地时区
+		Jobs                 map[string]JobSchedule `yaml:"jobs"`                   // 任务名 -> 调度配置，可选 pipeline/profile/recommendation/push/broadcast/cleanup
+		CleanupRetentionDays int                    `yaml:"cleanup_retention_days"` // cleanup任务保留推送记录、反馈、已审核内容和流程检查点的天数
+		ResumeWithinHours    int                    `yaml:"resume_within_hours"`    // 完整流程中断后，在该时间（小时）内的下一次执行或进程重启时继续执行，跳过已完成的用户
+		DefaultHour          int                    `yaml:"default_hour"`           // 默认执行小时
+		DefaultMinute        int                    `yaml:"default_minute"`         // 默认执行分钟
+		Lock                 struct {
+			Enabled    bool   `yaml:"enabled"`     // 是否启用任务租约，多实例部署时开启，每个任务的同一次调度只由一个实例执行
+			TTLSec     int    `yaml:"ttl_sec"`     // 租约有效期（秒），执行中每 ttl_sec/3 续期一次，实例崩溃后租约过期由其他实例接管
+			InstanceID string `yaml:"instance_id"` // 实例标识，为空使用"主机名-进程号"
+		} `yaml:"lock"`
 	} `yaml:"scheduler"`
 }
 
+// JobSchedule 单个定时任务的调度配置
+type JobSchedule struct {
+	// 标准cron表达式（分 时 日 月 周），也支持 @daily、@every 30m 等写法；按 Timezone 的墙上时间执行，
+	// 夏令时开始当天落在被跳过时段（如02:30）的任务在跳过时段结束时（03:00）执行，夏令时结束当天重复的时段只执行一次
+	Cron     string `yaml:"cron"`
+	Timezone string `yaml:"timezone"` // 时区，为空使用 scheduler.timezone
+	Disabled bool   `yaml:"disabled"` // 是否禁用该任务
+}
+
+// KBPolicy 单个知识库的检索策略，未配置的字段使用rag下的全局参数
+type KBPolicy struct {
+	TopK                int                `yaml:"topk"`                  // 该知识库返回的最大结果数
+	Threshold           float32            `yaml:"threshold"`             // 该知识库的相似度阈值
+	ScoreMultiplier     float64            `yaml:"score_multiplier"`      // 结果分数系数，0表示不调整
+	EligibleUserTypes   []string           `yaml:"eligible_user_types"`   // 允许检索该知识库的用户类型，为空表示不限制
+	UserTypeMultipliers map[string]float64 `yaml:"user_type_multipliers"` // 按用户类型调整分数，如对新手加权、对技术爱好者降权
+}
+
+// GroupProfileRule 群组画像规则：群名包含任一关键词时，用户获得对应的用户类型和兴趣
+type GroupProfileRule struct {
+	GroupKeywords []string `yaml:"group_keywords"` // 群名关键词
+	UserType      string   `yaml:"user_type"`      // 对应的用户类型，为空表示不设置
+	Interests     []string `yaml:"interests"`      // 对应的兴趣，按重要程度排列
+}
+
 func Load() *Config {
 	// 首先尝试加载.env文件中的环境变量
 	_ = godotenv.Load() // 忽略错误，如果.env文件不存在，继续使用系统环境变量
@@ -118,6 +245,11 @@ func Load() *Config {
 			cfg.SiliconFlow.APIKey = envAPIKey
 		}
 
+		// 知识库webhook校验令牌
+		if envSecret := os.Getenv("KB_WEBHOOK_SECRET"); envSecret != "" {
+			cfg.Webhook.Secret = envSecret
+		}
+
 		// 计算 DB.DSN 字段
 		if cfg.DB.DSN == "" {
 			// 设置默认值
@@ -201,6 +333,11 @@ func loadFromEnv() *Config {
 		cfg.ExternalAPI.APIKey = apiKey
 	}
 
+	// 知识库webhook校验令牌
+	if secret := os.Getenv("KB_WEBHOOK_SECRET"); secret != "" {
+		cfg.Webhook.Secret = secret
+	}
+
 	log.Println("配置从环境变量加载，部分配置可能缺失")
 	return &cfg
 }
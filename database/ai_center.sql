@@ -107,6 +107,136 @@ CREATE TABLE `group_configs`  (
   INDEX `idx_is_enabled`(`is_enabled` ASC) USING BTREE
 ) ENGINE = InnoDB AUTO_INCREMENT = 8 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '群配置表' ROW_FORMAT = DYNAMIC;
 
+-- ----------------------------
+-- Table structure for item_feedback
+-- ----------------------------
+DROP TABLE IF EXISTS `item_feedback`;
+CREATE TABLE `item_feedback`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `item_key` char(40) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '推送内容的唯一标识（标题和内容的SHA1）',
+  `action` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'click' COMMENT '反馈行为：click点击',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '最近一次反馈时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uk_cid_item_action`(`cid` ASC, `item_key` ASC, `action` ASC) USING BTREE,
+  INDEX `idx_created_at`(`created_at` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '推送内容反馈' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for job_leases
+-- ----------------------------
+DROP TABLE IF EXISTS `job_leases`;
+CREATE TABLE `job_leases`  (
+  `job_name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '任务名称',
+  `owner` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '最近一次获取租约的实例',
+  `token` char(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '本次租约的令牌，释放后为空',
+  `slot` bigint NOT NULL DEFAULT 0 COMMENT '最近一次获取租约时的调度时间点（Unix秒）',
+  `done_slot` bigint NOT NULL DEFAULT 0 COMMENT '已执行完成的调度时间点（Unix秒）',
+  `acquired_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '获取租约时间',
+  `heartbeat_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '最近一次续期时间',
+  `expires_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '租约过期时间',
+  PRIMARY KEY (`job_name`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '定时任务租约，多实例部署时保证同一次调度只由一个实例执行' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for job_runs
+-- ----------------------------
+DROP TABLE IF EXISTS `job_runs`;
+CREATE TABLE `job_runs`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `job_name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '任务名称',
+  `instance` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '执行任务的实例',
+  `status` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'running' COMMENT '执行状态：running/succeeded/failed/interrupted',
+  `started_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '开始时间',
+  `finished_at` datetime NULL DEFAULT NULL COMMENT '结束时间',
+  `duration_ms` bigint NOT NULL DEFAULT 0 COMMENT '执行耗时（毫秒）',
+  `stages_json` json NOT NULL COMMENT '各阶段的耗时、处理数和错误摘要',
+  `error` varchar(2000) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '导致任务失败的错误',
+  PRIMARY KEY (`id`) USING BTREE,
+  INDEX `idx_job_name`(`job_name` ASC, `id` ASC) USING BTREE,
+  INDEX `idx_status`(`status` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '定时任务执行记录' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for keyword_synonym_suggestions
+-- ----------------------------
+DROP TABLE IF EXISTS `keyword_synonym_suggestions`;
+CREATE TABLE `keyword_synonym_suggestions`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `canonical` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '建议的规范词',
+  `synonym` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '建议的同义词',
+  `source` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'llm' COMMENT '建议来源',
+  `status` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'pending' COMMENT '审核状态：pending待审核、approved已通过、rejected已拒绝',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `reviewed_at` datetime NULL DEFAULT NULL COMMENT '审核时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uk_canonical_synonym`(`canonical` ASC, `synonym` ASC) USING BTREE,
+  INDEX `idx_status`(`status` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '同义词建议审核队列' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for keyword_synonyms
+-- ----------------------------
+DROP TABLE IF EXISTS `keyword_synonyms`;
+CREATE TABLE `keyword_synonyms`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `canonical` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '规范词',
+  `synonym` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '同义词或变体写法',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uk_synonym`(`synonym` ASC) USING BTREE,
+  INDEX `idx_canonical`(`canonical` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '关键词同义词词典' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for moderation_reviews
+-- ----------------------------
+DROP TABLE IF EXISTS `moderation_reviews`;
+CREATE TABLE `moderation_reviews`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '推送对象，为空表示群发',
+  `item_key` char(40) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '推送内容的唯一标识（标题和内容的SHA1）',
+  `item_json` json NOT NULL COMMENT '推送内容',
+  `reason` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '未通过审核的原因',
+  `status` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'pending' COMMENT '审核状态：pending/approved/rejected',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `reviewed_at` datetime NULL DEFAULT NULL COMMENT '审核时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uk_cid_item`(`cid` ASC, `item_key` ASC) USING BTREE,
+  INDEX `idx_status`(`status` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '推送内容人工审核队列' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for pipeline_checkpoints
+-- ----------------------------
+DROP TABLE IF EXISTS `pipeline_checkpoints`;
+CREATE TABLE `pipeline_checkpoints`  (
+  `run_id` bigint NOT NULL COMMENT '执行记录ID（job_runs.id）',
+  `stage` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '流程阶段：profile/recommend/push',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '用户ID，为空表示群发',
+  `status` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '处理状态：started/done/failed',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`run_id`, `stage`, `cid`) USING BTREE,
+  INDEX `idx_cid`(`cid` ASC) USING BTREE,
+  INDEX `idx_updated_at`(`updated_at` ASC) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '完整推荐流程每次执行中每个用户的处理进度，用于中断后恢复执行' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for push_logs
+-- ----------------------------
+DROP TABLE IF EXISTS `push_logs`;
+CREATE TABLE `push_logs`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `item_key` char(40) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '推送内容的唯一标识（标题和内容的SHA1）',
+  `item_json` json NOT NULL COMMENT '推送内容',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '推送时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  INDEX `idx_cid_created_at`(`cid` ASC, `created_at` ASC) USING BTREE,
+  INDEX `idx_item_key`(`item_key` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户推送记录' ROW_FORMAT = DYNAMIC;
+
 -- ----------------------------
 -- Table structure for recommendation_cache
 -- ----------------------------
@@ -204,6 +334,54 @@ CREATE TABLE `user_join_exit_group_record`  (
   `group_name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL
 ) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci ROW_FORMAT = Dynamic;
 
+-- ----------------------------
+-- Table structure for user_preferences
+-- ----------------------------
+DROP TABLE IF EXISTS `user_preferences`;
+CREATE TABLE `user_preferences`  (
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `opt_out` tinyint(1) NOT NULL DEFAULT 0 COMMENT '全局退订：1不再推送任何内容',
+  `unsubscribed_topics` json NOT NULL COMMENT '退订的话题',
+  `unsubscribed_kbs` json NOT NULL COMMENT '退订的知识库ID',
+  `preferred_channel` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'app' COMMENT '推送渠道',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`cid`) USING BTREE,
+  INDEX `idx_opt_out`(`opt_out` ASC) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户推送偏好' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for user_profile_history
+-- ----------------------------
+DROP TABLE IF EXISTS `user_profile_history`;
+CREATE TABLE `user_profile_history`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `profile_json` json NOT NULL COMMENT '该版本的画像',
+  `keywords` json NOT NULL COMMENT '该版本的关键词列表',
+  `source` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '画像来源：llm/fallback/merge/manual/cold_start/decay',
+  `model` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '生成画像使用的模型',
+  `prompt_version` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '生成画像使用的提示词版本',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  INDEX `idx_cid_id`(`cid` ASC, `id` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户画像历史版本（只追加）' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for user_profile_overrides
+-- ----------------------------
+DROP TABLE IF EXISTS `user_profile_overrides`;
+CREATE TABLE `user_profile_overrides`  (
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `pinned_keywords` json NOT NULL COMMENT '固定的关键词及权重',
+  `blocked_keywords` json NOT NULL COMMENT '屏蔽的关键词',
+  `user_type` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '强制的用户类型，为空表示不覆盖',
+  `activity_level` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '强制的活跃度，为空表示不覆盖',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`cid`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户画像人工覆盖设置' ROW_FORMAT = DYNAMIC;
+
 -- ----------------------------
 -- Table structure for user_profiles
 -- ----------------------------
@@ -220,4 +398,44 @@ CREATE TABLE `user_profiles`  (
   INDEX `idx_updated_at`(`updated_at` ASC) USING BTREE
 ) ENGINE = InnoDB AUTO_INCREMENT = 3299 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci ROW_FORMAT = DYNAMIC;
 
+-- ----------------------------
+-- Table structure for user_segment_members
+-- ----------------------------
+DROP TABLE IF EXISTS `user_segment_members`;
+CREATE TABLE `user_segment_members`  (
+  `segment_id` bigint NOT NULL COMMENT '分群ID',
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '计算时间',
+  PRIMARY KEY (`segment_id`, `cid`) USING BTREE,
+  INDEX `idx_cid`(`cid` ASC) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户分群成员（每次计算时整体替换）' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for user_segments
+-- ----------------------------
+DROP TABLE IF EXISTS `user_segments`;
+CREATE TABLE `user_segments`  (
+  `id` bigint NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `name` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '分群名称',
+  `description` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '分群描述',
+  `rules_json` json NOT NULL COMMENT '分群规则：user_types/activity_levels/keywords/active_within_days',
+  `member_count` int NOT NULL DEFAULT 0 COMMENT '上次计算的成员数',
+  `refreshed_at` datetime NULL DEFAULT NULL COMMENT '上次计算时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE INDEX `uk_name`(`name` ASC) USING BTREE
+) ENGINE = InnoDB AUTO_INCREMENT = 1 CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '用户分群' ROW_FORMAT = DYNAMIC;
+
+-- ----------------------------
+-- Table structure for user_suppressions
+-- ----------------------------
+DROP TABLE IF EXISTS `user_suppressions`;
+CREATE TABLE `user_suppressions`  (
+  `cid` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+  `reason` varchar(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '原因：user_request用户请求删除',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '删除时间',
+  PRIMARY KEY (`cid`) USING BTREE
+) ENGINE = InnoDB CHARACTER SET = utf8mb4 COLLATE = utf8mb4_unicode_ci COMMENT = '已删除数据、禁止重新生成画像的用户' ROW_FORMAT = DYNAMIC;
+
 SET FOREIGN_KEY_CHECKS = 1;
@@ -0,0 +1,244 @@
+// Package dbtest 提供按SQL片段匹配的内存数据库驱动，测试仓储层和服务层时替换 db.DB，不需要真实MySQL
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"ai_push_message/db"
+)
+
+// Statement 执行过的一条语句；事务提交和回滚分别记录为 COMMIT 和 ROLLBACK
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// QueryFunc 返回查询结果的列名和行
+type QueryFunc func(args []driver.Value) (columns []string, rows [][]driver.Value, err error)
+
+// ExecFunc 返回写入语句影响的行数
+type ExecFunc func(args []driver.Value) (rowsAffected int64, err error)
+
+type queryHandler struct {
+	fragment string
+	fn       QueryFunc
+}
+
+type execHandler struct {
+	fragment string
+	fn       ExecFunc
+}
+
+// Fake 内存数据库，按注册顺序匹配包含指定片段的SQL
+// 没有匹配的查询返回空结果（QueryRow 得到 sql.ErrNoRows），没有匹配的写入语句影响1行
+type Fake struct {
+	mu       sync.Mutex
+	queries  []queryHandler
+	execs    []execHandler
+	executed []Statement
+}
+
+var driverSeq atomic.Int64
+
+// Open 创建内存数据库并替换 db.DB，测试结束后恢复
+func Open(t testing.TB) *Fake {
+	t.Helper()
+	f := &Fake{}
+	name := fmt.Sprintf("dbtest-%d", driverSeq.Add(1))
+	sql.Register(name, &fakeDriver{fake: f})
+	conn, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("打开内存数据库失败: %v", err)
+	}
+
+	prev := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = prev
+		conn.Close()
+	})
+	return f
+}
+
+// OnQuery 注册包含 fragment 的查询的结果
+func (f *Fake) OnQuery(fragment string, fn QueryFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, queryHandler{fragment: fragment, fn: fn})
+}
+
+// OnExec 注册包含 fragment 的写入语句的结果
+func (f *Fake) OnExec(fragment string, fn ExecFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execs = append(f.execs, execHandler{fragment: fragment, fn: fn})
+}
+
+// Rows 固定返回给定列和行的查询结果
+func Rows(columns []string, rows ...[]driver.Value) QueryFunc {
+	return func([]driver.Value) ([]string, [][]driver.Value, error) {
+		return columns, rows, nil
+	}
+}
+
+// Executed 返回执行过的全部写入语句和事务操作
+func (f *Fake) Executed() []Statement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Statement(nil), f.executed...)
+}
+
+// ExecutedMatching 返回包含 fragment 的已执行语句
+func (f *Fake) ExecutedMatching(fragment string) []Statement {
+	out := make([]Statement, 0)
+	for _, s := range f.Executed() {
+		if strings.Contains(s.Query, fragment) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (f *Fake) record(query string, args []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.executed = append(f.executed, Statement{Query: strings.Join(strings.Fields(query), " "), Args: args})
+}
+
+func (f *Fake) query(query string, args []driver.Value) (driver.Rows, error) {
+	f.mu.Lock()
+	var fn QueryFunc
+	for _, h := range f.queries {
+		if strings.Contains(query, h.fragment) {
+			fn = h.fn
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if fn == nil {
+		return &fakeRows{}, nil
+	}
+	columns, rows, err := fn(args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+func (f *Fake) exec(query string, args []driver.Value) (driver.Result, error) {
+	f.record(query, args)
+
+	f.mu.Lock()
+	var fn ExecFunc
+	for _, h := range f.execs {
+		if strings.Contains(query, h.fragment) {
+			fn = h.fn
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if fn == nil {
+		return driver.RowsAffected(1), nil
+	}
+	n, err := fn(args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+type fakeDriver struct {
+	fake *Fake
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{fake: d.fake}, nil
+}
+
+type fakeConn struct {
+	fake *Fake
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{fake: c.fake}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.fake.query(query, values(args))
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.fake.exec(query, values(args))
+}
+
+type fakeTx struct {
+	fake *Fake
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.fake.record("COMMIT", nil)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.fake.record("ROLLBACK", nil)
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.fake.exec(s.query, args)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.fake.query(s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// SubmitFeedbackHandler godoc
+// @Summary 上报推送内容反馈
+// @Description 上报用户点击了推送内容，用于相似用户推荐。可直接传item_key，或传推送时的title和content由服务端计算
+// @Tags 推荐内容
+// @Accept json
+// @Produce json
+// @Param request body models.FeedbackRequest true "反馈内容"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/feedback [post]
+func SubmitFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	if !utils.ValidateCID(w, req.CID) {
+		return
+	}
+	if req.Action == "" {
+		req.Action = models.FeedbackClick
+	}
+
+	itemKey, err := services.RecordFeedback(&req)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"cid":      req.CID,
+		"item_key": itemKey,
+		"action":   req.Action,
+	})
+}
+
+// GetSimilarUsersHandler godoc
+// @Summary 获取相似用户及其推荐内容
+// @Description 按画像关键词向量的余弦相似度查找相似用户，并返回相似用户点击或收到过、该用户还没有收到过的内容
+// @Tags 推荐内容
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/recommendation/{cid}/similar-users [get]
+func GetSimilarUsersHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	items, err := services.SimilarUserRecommendations(cfg, cid, cfg.RAG.TopK)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"cid":             cid,
+		"similar_users":   services.FindSimilarUsers(cfg, cid),
+		"recommendations": items,
+	})
+}
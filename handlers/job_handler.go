@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/models"
+	"ai_push_message/scheduler"
+	"ai_push_message/utils"
+)
+
+// ListJobsHandler godoc
+// @Summary 获取定时任务
+// @Description 获取全部定时任务的cron表达式、时区、是否执行中、下次执行时间和最近一次执行记录，启用租约时包括租约的持有实例和过期时间
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/jobs [get]
+func ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := scheduler.ListJobs()
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, jobs)
+}
+
+// ListJobRunsHandler godoc
+// @Summary 获取定时任务执行记录
+// @Description 按时间倒序分页获取任务的执行记录，包括各阶段的耗时、处理数、重新生成数、失败数和错误摘要
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param id path string true "任务名称（pipeline/profile/recommendation/push/broadcast/cleanup）"
+// @Param limit query int false "每页数量，默认20，最多200"
+// @Param offset query int false "偏移量，默认0"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/jobs/{id}/runs [get]
+func ListJobRunsHandler(w http.ResponseWriter, r *http.Request) {
+	job := chi.URLParam(r, "id")
+
+	limit, offset := 0, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的limit", map[string]interface{}{})
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的offset", map[string]interface{}{})
+			return
+		}
+		offset = n
+	}
+
+	runs, err := scheduler.ListJobRuns(job, limit, offset)
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"job":  job,
+		"runs": runs,
+	})
+}
+
+// ResumeJobRunHandler godoc
+// @Summary 恢复执行中断的任务
+// @Description 在后台继续执行一条已中断或失败的完整流程记录，跳过已完成的阶段和用户，已推送或推送结果未知的用户不会重复推送
+// @Tags 定时任务
+// @Accept json
+// @Produce json
+// @Param id path string true "任务名称，目前只有pipeline支持恢复执行"
+// @Param runId path int true "执行记录ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/jobs/{id}/runs/{runId}/resume [post]
+func ResumeJobRunHandler(w http.ResponseWriter, r *http.Request) {
+	job := chi.URLParam(r, "id")
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runId"), 10, 64)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的执行记录ID", map[string]interface{}{})
+		return
+	}
+
+	if err := scheduler.ResumeJobRun(job, runID); err != nil {
+		if errors.Is(err, scheduler.ErrJobNotResumable) || errors.Is(err, scheduler.ErrRunNotResumable) || errors.Is(err, scheduler.ErrJobRunning) {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+			return
+		}
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"job":    job,
+		"run_id": runID,
+	})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"ai_push_message/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// ListModerationReviewsHandler godoc
+// @Summary 获取内容审核队列
+// @Description 获取未通过自动审核（屏蔽词或LLM审核）、等待人工审核的推送内容
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Param status query string false "审核状态（pending/approved/rejected），默认pending"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/moderation/reviews [get]
+func ListModerationReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReviewPending
+	}
+
+	reviews, err := services.ListModerationReviews(status)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, reviews)
+}
+
+// ReviewModerationItemHandler godoc
+// @Summary 人工审核推送内容
+// @Description 通过（approve）后立即推送该内容，拒绝（reject）后该内容不再推送给该用户
+// @Tags 内容审核
+// @Accept json
+// @Produce json
+// @Param id path int true "审核记录ID"
+// @Param action path string true "approve 或 reject"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/moderation/reviews/{id}/{action} [post]
+func ReviewModerationItemHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的审核记录ID", map[string]interface{}{})
+		return
+	}
+
+	action := chi.URLParam(r, "action")
+	if action != "approve" && action != "reject" {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "action只能是approve或reject", map[string]interface{}{})
+		return
+	}
+
+	review, err := services.ReviewModerationItem(cfg, id, action == "approve")
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, review)
+}
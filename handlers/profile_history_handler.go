@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// GetProfileHistoryHandler godoc
+// @Summary 获取用户画像历史
+// @Description 获取指定用户的画像历史版本（按时间倒序），包含每个版本的来源、模型和提示词版本
+// @Tags 用户画像
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Param limit query int false "返回的版本数，默认20，最多100"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/profile/{cid}/history [get]
+func GetProfileHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的limit", map[string]interface{}{})
+			return
+		}
+		limit = n
+	}
+
+	history, err := services.ListProfileHistory(cid, limit)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, history)
+}
+
+// GetProfileDiffHandler godoc
+// @Summary 比较用户画像版本
+// @Description 比较指定用户的两个画像版本，返回新增和移除的兴趣以及关键词权重变化。to 默认为最新版本，from 默认为 to 的上一个版本
+// @Tags 用户画像
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Param from query int false "起始版本ID"
+// @Param to query int false "目标版本ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/profile/{cid}/diff [get]
+func GetProfileDiffHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	var ids [2]int64
+	for i, name := range []string{"from", "to"} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的版本ID: "+name, map[string]interface{}{})
+			return
+		}
+		ids[i] = id
+	}
+
+	diff, err := services.DiffProfileVersions(cid, ids[0], ids[1])
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, diff)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// GetProfileOverridesHandler godoc
+// @Summary 获取画像覆盖设置
+// @Description 获取指定用户的固定关键词、屏蔽关键词以及强制的用户类型和活跃度
+// @Tags 用户画像
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/profile/{cid}/overrides [get]
+func GetProfileOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	overrides, err := services.GetProfileOverrides(cid)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, overrides)
+}
+
+// SaveProfileOverridesHandler godoc
+// @Summary 保存画像覆盖设置
+// @Description 替换指定用户的画像覆盖设置并立即应用到当前画像；之后每次生成或合并画像都会重新应用
+// @Tags 用户画像
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Param request body models.ProfileOverrides true "覆盖设置"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/profile/{cid}/overrides [put]
+func SaveProfileOverridesHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	var overrides models.ProfileOverrides
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	overrides.CID = cid
+	if err := services.ValidateProfileOverrides(cfg, &overrides); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	profile, err := services.SaveProfileOverrides(cfg, &overrides)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"overrides":   overrides,
+		"has_profile": profile != nil,
+		"profile":     profile,
+	})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -125,7 +127,7 @@ func GenerateUserProfileHandler(w http.ResponseWriter, r *http.Request, cfg *con
 	}
 
 	// 解析画像数据
-	profileData, ok := utils.ParseProfileData(w, profile.ProfileRaw)
+	profileData, ok := utils.ParseProfileData(w, profile)
 	if !ok {
 		return
 	}
@@ -164,7 +166,7 @@ func GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 解析画像数据
-	profileData, ok := utils.ParseProfileData(w, profile.ProfileRaw)
+	profileData, ok := utils.ParseProfileData(w, profile)
 	if !ok {
 		return
 	}
@@ -296,6 +298,49 @@ func RefreshUserRecommendationHandler(w http.ResponseWriter, r *http.Request, cf
 	})
 }
 
+// KnowledgeBaseWebhookHandler godoc
+// @Summary 知识库更新通知
+// @Description 知识库文档新增、更新或删除时调用：清除相关检索缓存，从推荐缓存中移除失效文档，并为受影响的用户排队重新生成推荐内容
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Param X-Webhook-Secret header string true "webhook校验令牌，需与webhook.secret一致；未配置webhook.secret时拒绝所有请求"
+// @Param request body models.WebhookRequest true "知识库更新内容"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/webhook/knowledge-base [post]
+func KnowledgeBaseWebhookHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	// 未配置校验令牌时拒绝请求，避免任意调用方清除推荐缓存并触发重新生成
+	if cfg.Webhook.Secret == "" {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, "未配置webhook校验令牌，拒绝知识库更新通知", map[string]interface{}{})
+		return
+	}
+	token := r.Header.Get("X-Webhook-Secret")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Webhook.Secret)) != 1 {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "webhook校验令牌无效", map[string]interface{}{})
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	if err := services.ValidateWebhookRequest(&req); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	result, err := services.HandleKnowledgeBaseUpdate(cfg, &req)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	utils.WriteSuccessResponse(w, result)
+}
+
 func RegisterRoutes(r *chi.Mux, cfg *config.Config) {
 	// Swagger 文档
 	r.Get("/swagger/*", httpSwagger.Handler(
@@ -319,6 +364,12 @@ func RegisterRoutes(r *chi.Mux, cfg *config.Config) {
 	})
 
 	r.Get("/api/profile/{cid}", GetUserProfileHandler)
+	r.Get("/api/profile/{cid}/history", GetProfileHistoryHandler)
+	r.Get("/api/profile/{cid}/diff", GetProfileDiffHandler)
+	r.Get("/api/profile/{cid}/overrides", GetProfileOverridesHandler)
+	r.Put("/api/profile/{cid}/overrides", func(w http.ResponseWriter, r *http.Request) {
+		SaveProfileOverridesHandler(w, r, cfg)
+	})
 
 	r.Post("/api/recommendation/generate/{cid}", func(w http.ResponseWriter, r *http.Request) {
 		GenerateUserRecommendationHandler(w, r, cfg)
@@ -333,4 +384,49 @@ func RegisterRoutes(r *chi.Mux, cfg *config.Config) {
 	})
 
 	r.Get("/api/recommendation/{cid}", GetUserRecommendationHandler)
+	r.Get("/api/recommendation/{cid}/similar-users", func(w http.ResponseWriter, r *http.Request) {
+		GetSimilarUsersHandler(w, r, cfg)
+	})
+	r.Post("/api/feedback", SubmitFeedbackHandler)
+
+	r.Post("/api/webhook/knowledge-base", func(w http.ResponseWriter, r *http.Request) {
+		KnowledgeBaseWebhookHandler(w, r, cfg)
+	})
+
+	r.Get("/api/synonyms", ListSynonymsHandler)
+	r.Put("/api/synonyms", SaveSynonymGroupHandler)
+	r.Delete("/api/synonyms", DeleteSynonymGroupHandler)
+	r.Get("/api/synonyms/suggestions", ListSynonymSuggestionsHandler)
+	r.Post("/api/synonyms/suggestions/generate", func(w http.ResponseWriter, r *http.Request) {
+		GenerateSynonymSuggestionsHandler(w, r, cfg)
+	})
+	r.Post("/api/synonyms/suggestions/{id}/{action}", ReviewSynonymSuggestionHandler)
+
+	r.Get("/api/moderation/reviews", ListModerationReviewsHandler)
+	r.Post("/api/moderation/reviews/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		ReviewModerationItemHandler(w, r, cfg)
+	})
+
+	r.Delete("/api/users/{cid}", DeleteUserDataHandler)
+	r.Get("/api/users/{cid}/export", ExportUserDataHandler)
+	r.Get("/api/users/{cid}/preferences", GetUserPreferencesHandler)
+	r.Put("/api/users/{cid}/preferences", func(w http.ResponseWriter, r *http.Request) {
+		SaveUserPreferencesHandler(w, r, cfg)
+	})
+
+	r.Get("/api/segments", ListSegmentsHandler)
+	r.Post("/api/segments", func(w http.ResponseWriter, r *http.Request) {
+		SaveSegmentHandler(w, r, cfg)
+	})
+	r.Post("/api/segments/preview", func(w http.ResponseWriter, r *http.Request) {
+		PreviewSegmentHandler(w, r, cfg)
+	})
+	r.Post("/api/segments/refresh", RefreshSegmentsHandler)
+	r.Get("/api/segments/{id}", GetSegmentHandler)
+	r.Get("/api/segments/{id}/members", ListSegmentMembersHandler)
+	r.Delete("/api/segments/{id}", DeleteSegmentHandler)
+
+	r.Get("/api/jobs", ListJobsHandler)
+	r.Get("/api/jobs/{id}/runs", ListJobRunsHandler)
+	r.Post("/api/jobs/{id}/runs/{runId}/resume", ResumeJobRunHandler)
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		AffectedUsers int `json:"affected_users"`
+		RemovedItems  int `json:"removed_items"`
+	} `json:"data"`
+}
+
+func postWebhook(t *testing.T, cfg *config.Config, secret, body string) webhookResponse {
+	t.Helper()
+	r := chi.NewRouter()
+	RegisterRoutes(r, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook/knowledge-base", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set("X-Webhook-Secret", secret)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var resp webhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v, body=%s", err, rec.Body.String())
+	}
+	return resp
+}
+
+func TestKnowledgeBaseWebhookRejectsInvalidRequests(t *testing.T) {
+	const valid = `{"knowledge_id":"kb1","update_type":"add"}`
+	tests := []struct {
+		name       string
+		configured string
+		secret     string
+		body       string
+		wantCode   int
+	}{
+		{"未配置校验令牌", "", "s3cret", valid, models.CodeServerError},
+		{"缺少校验令牌", "s3cret", "", valid, models.CodeInvalidParams},
+		{"校验令牌错误", "s3cret", "wrong", valid, models.CodeInvalidParams},
+		{"请求体格式错误", "s3cret", "s3cret", `{"knowledge_id":`, models.CodeInvalidParams},
+		{"缺少知识库ID", "s3cret", "s3cret", `{"update_type":"add"}`, models.CodeInvalidParams},
+		{"不支持的更新类型", "s3cret", "s3cret", `{"knowledge_id":"kb1","update_type":"rename"}`, models.CodeInvalidParams},
+		{"删除时缺少文档ID", "s3cret", "s3cret", `{"knowledge_id":"kb1","update_type":"delete"}`, models.CodeInvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 被拒绝的请求不应访问数据库
+			fake := dbtest.Open(t)
+			cfg := &config.Config{}
+			cfg.Webhook.Secret = tt.configured
+
+			resp := postWebhook(t, cfg, tt.secret, tt.body)
+			if resp.Code != tt.wantCode {
+				t.Errorf("响应码为 %d（%s），期望 %d", resp.Code, resp.Message, tt.wantCode)
+			}
+			if executed := fake.Executed(); len(executed) != 0 {
+				t.Errorf("被拒绝的请求写入了数据库: %v", executed)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBaseWebhookDeleteRemovesItems(t *testing.T) {
+	cached := map[string]string{
+		// u1 的缓存中有被删除的文档和其他文档，u2 只有被删除的文档，u3 没有受影响的文档
+		"u1": `{"recommendations":[{"source":"knowledge_base","title":"旧文档","ref_id":"doc1","knowledge_id":"kb1"},{"source":"knowledge_base","title":"其他文档","ref_id":"doc2","knowledge_id":"kb1"}]}`,
+		"u2": `{"recommendations":[{"source":"knowledge_base","title":"旧文档","ref_id":"doc1"}]}`,
+		"u3": `{"recommendations":[{"source":"knowledge_base","title":"同名文档","ref_id":"doc1","knowledge_id":"kb2"}]}`,
+	}
+
+	fake := dbtest.Open(t)
+	fake.OnQuery("FOR UPDATE", func(args []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"recommendations"}, [][]driver.Value{{cached[args[0].(string)]}}, nil
+	})
+	fake.OnQuery("SELECT cid, recommendations", func([]driver.Value) ([]string, [][]driver.Value, error) {
+		rows := make([][]driver.Value, 0, len(cached))
+		for cid, recs := range cached {
+			rows = append(rows, []driver.Value{cid, recs})
+		}
+		return []string{"cid", "recommendations"}, rows, nil
+	})
+
+	cfg := &config.Config{}
+	cfg.Webhook.Secret = "s3cret"
+	resp := postWebhook(t, cfg, "s3cret", `{"knowledge_id":"kb1","update_type":"delete","document_ids":["doc1"]}`)
+	if resp.Code != models.CodeSuccess {
+		t.Fatalf("响应码为 %d（%s），期望成功", resp.Code, resp.Message)
+	}
+	if resp.Data.AffectedUsers != 2 || resp.Data.RemovedItems != 2 {
+		t.Errorf("affected_users=%d removed_items=%d，期望 2/2", resp.Data.AffectedUsers, resp.Data.RemovedItems)
+	}
+
+	updates := fake.ExecutedMatching("UPDATE recommendation_cache")
+	if len(updates) != 1 || updates[0].Args[1] != "u1" {
+		t.Fatalf("更新语句为 %v，期望只更新 u1", updates)
+	}
+	if kept := updates[0].Args[0].(string); strings.Contains(kept, "doc1") || !strings.Contains(kept, "doc2") {
+		t.Errorf("u1 保留的推荐内容为 %s，期望只保留 doc2", kept)
+	}
+	deletes := fake.ExecutedMatching("DELETE FROM recommendation_cache")
+	if len(deletes) != 1 || deletes[0].Args[0] != "u2" {
+		t.Errorf("删除语句为 %v，期望只删除 u2 的缓存", deletes)
+	}
+	if commits := fake.ExecutedMatching("COMMIT"); len(commits) != 2 {
+		t.Errorf("提交了 %d 个事务，期望 2 个", len(commits))
+	}
+}
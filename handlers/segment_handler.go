@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// ListSegmentsHandler godoc
+// @Summary 获取用户分群
+// @Description 获取全部分群及其规则、上次计算的成员数和计算时间
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments [get]
+func ListSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	segments, err := services.ListSegments()
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, segments)
+}
+
+// SaveSegmentHandler godoc
+// @Summary 保存用户分群
+// @Description 按名称创建或更新分群，保存后立即计算成员；之后每次画像生成完成都会重新计算
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Param request body models.Segment true "分群名称、描述和规则"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments [post]
+func SaveSegmentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	var segment models.Segment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	if segment.Name == "" {
+		utils.WriteErrorResponse(w, models.CodeMissingParams, map[string]interface{}{
+			"param": "name",
+		})
+		return
+	}
+	if err := services.ValidateSegmentRules(cfg, &segment.Rules); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	saved, err := services.SaveSegment(cfg, &segment)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, saved)
+}
+
+// PreviewSegmentHandler godoc
+// @Summary 试算用户分群
+// @Description 按规则统计满足条件的用户数并返回部分成员，不保存分群
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Param request body models.SegmentRules true "分群规则"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments/preview [post]
+func PreviewSegmentHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	var rules models.SegmentRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	if err := services.ValidateSegmentRules(cfg, &rules); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	preview, err := services.PreviewSegment(&rules)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, preview)
+}
+
+// RefreshSegmentsHandler godoc
+// @Summary 重新计算用户分群
+// @Description 按当前画像重新计算全部分群的成员
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments/refresh [post]
+func RefreshSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := services.RefreshSegments(); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	segments, err := services.ListSegments()
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, segments)
+}
+
+// GetSegmentHandler godoc
+// @Summary 获取单个用户分群
+// @Description 获取分群的规则、成员数和计算时间
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Param id path int true "分群ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments/{id} [get]
+func GetSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSegmentID(w, r)
+	if !ok {
+		return
+	}
+
+	segment, err := services.GetSegment(id)
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, segment)
+}
+
+// ListSegmentMembersHandler godoc
+// @Summary 获取分群成员
+// @Description 分页获取分群成员的用户ID（上次计算的结果）
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Param id path int true "分群ID"
+// @Param limit query int false "每页数量，默认100，最多1000"
+// @Param offset query int false "偏移量，默认0"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments/{id}/members [get]
+func ListSegmentMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSegmentID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := 0, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的limit", map[string]interface{}{})
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的offset", map[string]interface{}{})
+			return
+		}
+		offset = n
+	}
+
+	members, err := services.ListSegmentMembers(id, limit, offset)
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"segment_id": id,
+		"members":    members,
+	})
+}
+
+// DeleteSegmentHandler godoc
+// @Summary 删除用户分群
+// @Description 删除分群及其成员
+// @Tags 用户分群
+// @Accept json
+// @Produce json
+// @Param id path int true "分群ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/segments/{id} [delete]
+func DeleteSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSegmentID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteSegment(id); err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// parseSegmentID 解析路径中的分群ID，无效时写入错误响应
+func parseSegmentID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的分群ID", map[string]interface{}{})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// ListSynonymsHandler godoc
+// @Summary 获取同义词词典
+// @Description 获取全部规范词及其同义词
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms [get]
+func ListSynonymsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := services.ListSynonymGroups()
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, groups)
+}
+
+// SaveSynonymGroupHandler godoc
+// @Summary 保存同义词组
+// @Description 保存规范词及其同义词，替换该规范词下原有的同义词；已属于其他规范词的同义词改为归属当前规范词
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Param request body models.SynonymGroup true "同义词组"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms [put]
+func SaveSynonymGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var group models.SynonymGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	if err := services.ValidateSynonymGroup(&group); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	if err := services.SaveSynonymGroup(&group); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, group)
+}
+
+// DeleteSynonymGroupHandler godoc
+// @Summary 删除同义词组
+// @Description 删除规范词及其全部同义词
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Param canonical query string true "规范词"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms [delete]
+func DeleteSynonymGroupHandler(w http.ResponseWriter, r *http.Request) {
+	canonical := r.URL.Query().Get("canonical")
+	if canonical == "" {
+		utils.WriteErrorResponse(w, models.CodeMissingParams, map[string]interface{}{
+			"param": "canonical",
+		})
+		return
+	}
+
+	if err := services.DeleteSynonymGroup(canonical); err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"canonical": canonical,
+	})
+}
+
+// GenerateSynonymSuggestionsHandler godoc
+// @Summary 生成同义词建议
+// @Description 调用LLM分析关键词的不同写法，生成的建议进入审核队列，审核通过后才加入词典
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Param request body models.SynonymSuggestRequest false "待分析的关键词，为空时使用画像中出现最多且未收录的关键词"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms/suggestions/generate [post]
+func GenerateSynonymSuggestionsHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	var req models.SynonymSuggestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+			return
+		}
+	}
+
+	added, err := services.GenerateSynonymSuggestions(cfg, req.Terms)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeThirdPartyAPIError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, map[string]interface{}{
+		"added": added,
+	})
+}
+
+// ListSynonymSuggestionsHandler godoc
+// @Summary 获取同义词建议
+// @Description 获取同义词建议审核队列
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Param status query string false "审核状态（pending/approved/rejected），默认pending"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms/suggestions [get]
+func ListSynonymSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.SuggestionPending
+	}
+
+	suggestions, err := services.ListSynonymSuggestions(status)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, suggestions)
+}
+
+// ReviewSynonymSuggestionHandler godoc
+// @Summary 审核同义词建议
+// @Description 通过（approve）后加入词典，拒绝（reject）后不再出现在待审核队列
+// @Tags 同义词
+// @Accept json
+// @Produce json
+// @Param id path int true "建议ID"
+// @Param action path string true "approve 或 reject"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/synonyms/suggestions/{id}/{action} [post]
+func ReviewSynonymSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "无效的建议ID", map[string]interface{}{})
+		return
+	}
+
+	action := chi.URLParam(r, "action")
+	if action != "approve" && action != "reject" {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "action只能是approve或reject", map[string]interface{}{})
+		return
+	}
+
+	suggestion, err := services.ReviewSynonymSuggestion(id, action == "approve")
+	if err != nil {
+		utils.HandleServiceError(w, err, models.CodeNotFound)
+		return
+	}
+	utils.WriteSuccessResponse(w, suggestion)
+}
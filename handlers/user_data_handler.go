@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/services"
+	"ai_push_message/utils"
+)
+
+// DeleteUserDataHandler godoc
+// @Summary 删除用户数据
+// @Description 删除用户的画像、画像历史、覆盖设置、推荐内容、推送记录、反馈、分群成员和审核记录，并禁止之后重新生成画像。群聊消息、社区发帖等源数据不在此删除
+// @Tags 用户数据
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/users/{cid} [delete]
+func DeleteUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	result, err := services.DeleteUserData(cid)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeDatabaseError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, result)
+}
+
+// ExportUserDataHandler godoc
+// @Summary 导出用户数据
+// @Description 以JSON导出系统为用户生成和保存的全部数据：画像及历史版本、覆盖设置、推送偏好、推荐内容、推送记录、反馈、所属分群、审核记录和删除记录
+// @Tags 用户数据
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/users/{cid}/export [get]
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	export, err := services.ExportUserData(cid)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeDatabaseError, err.Error(), map[string]interface{}{})
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "user_"+cid+"_export.json"))
+	utils.WriteSuccessResponse(w, export)
+}
+
+// GetUserPreferencesHandler godoc
+// @Summary 获取推送偏好
+// @Description 获取用户的全局退订状态、退订的话题和知识库以及推送渠道
+// @Tags 用户数据
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/users/{cid}/preferences [get]
+func GetUserPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	prefs, err := services.GetUserPreferences(cid)
+	if err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, prefs)
+}
+
+// SaveUserPreferencesHandler godoc
+// @Summary 保存推送偏好
+// @Description 替换用户的推送偏好。全局退订后不再推送任何内容（群发时也排除该用户）；退订的话题和知识库的内容不再推送给该用户
+// @Tags 用户数据
+// @Accept json
+// @Produce json
+// @Param cid path string true "用户ID"
+// @Param request body models.UserPreferences true "推送偏好"
+// @Success 200 {object} map[string]interface{} "成功"
+// @Failure 400 {object} map[string]interface{} "参数错误"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Router /api/users/{cid}/preferences [put]
+func SaveUserPreferencesHandler(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	cid := chi.URLParam(r, "cid")
+	if !utils.ValidateCID(w, cid) {
+		return
+	}
+
+	var prefs models.UserPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, "请求体格式错误: "+err.Error(), map[string]interface{}{})
+		return
+	}
+	prefs.CID = cid
+	if err := services.ValidateUserPreferences(cfg, &prefs); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeInvalidParams, err.Error(), map[string]interface{}{})
+		return
+	}
+
+	if err := services.SaveUserPreferences(&prefs); err != nil {
+		utils.WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
+		return
+	}
+	utils.WriteSuccessResponse(w, prefs)
+}
@@ -16,6 +16,7 @@ import (
 	"ai_push_message/handlers"
 	"ai_push_message/logger"
 	"ai_push_message/scheduler"
+	"ai_push_message/services"
 )
 
 func main() {
@@ -42,6 +43,12 @@ func main() {
 	r.Use(middleware.Recoverer)
 
 	handlers.RegisterRoutes(r, cfg)
+	if cfg.Webhook.Secret == "" {
+		logger.Error("未配置webhook.secret（KB_WEBHOOK_SECRET），知识库更新通知接口将拒绝所有请求")
+	}
+
+	// RAG服务不可用时使用的本地全文索引
+	services.StartFallbackIndex(cfg)
 
 	// start cron
 	scheduler.Start(cfg)
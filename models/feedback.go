@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// 推送内容的反馈行为
+const (
+	FeedbackClick = "click" // 点击
+)
+
+// PushLog 推送给用户的一条内容
+type PushLog struct {
+	ID        int64              `json:"id"`
+	CID       string             `json:"cid"`
+	ItemKey   string             `json:"item_key"` // 推送内容的唯一标识（标题和内容的SHA1）
+	Item      RecommendationItem `json:"item"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// ItemFeedback 用户对推送内容的一条反馈
+type ItemFeedback struct {
+	CID       string    `json:"cid"`
+	ItemKey   string    `json:"item_key"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"` // 最近一次反馈时间
+}
+
+// FeedbackRequest 上报推送内容反馈的请求体，item_key 为空时按标题和内容计算
+type FeedbackRequest struct {
+	CID     string `json:"cid" example:"user123"`
+	ItemKey string `json:"item_key,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Content string `json:"content,omitempty"`
+	Action  string `json:"action" example:"click"` // 目前只支持 click
+}
+
+// SimilarUser 关键词向量相似的用户
+type SimilarUser struct {
+	CID        string  `json:"cid"`
+	Similarity float64 `json:"similarity"` // 余弦相似度
+}
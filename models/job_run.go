@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 定时任务执行状态
+const (
+	JobRunRunning     = "running"     // 执行中
+	JobRunSucceeded   = "succeeded"   // 执行成功
+	JobRunFailed      = "failed"      // 执行失败
+	JobRunInterrupted = "interrupted" // 进程退出导致执行中断
+)
+
+// 完整流程的阶段
+const (
+	StageProfile   = "profile"   // 画像生成
+	StageRecommend = "recommend" // 推荐生成
+	StagePush      = "push"      // 推送，完整流程中包含热门话题群发
+)
+
+// 流程检查点中用户在某个阶段的处理状态
+const (
+	CheckpointStarted = "started" // 已开始处理，推送阶段表示推送结果未知
+	CheckpointDone    = "done"    // 处理完成
+	CheckpointFailed  = "failed"  // 处理失败，恢复执行时重试
+)
+
+// maxStageErrors 每个阶段最多保留的错误摘要条数
+const maxStageErrors = 20
+
+// StageCounts 一个阶段处理的用户数
+type StageCounts struct {
+	Processed   int      `json:"processed"`        // 处理的用户数
+	Regenerated int      `json:"regenerated"`      // 重新生成画像或推荐的用户数，推送阶段不使用
+	Pushed      int      `json:"pushed"`           // 推送成功的用户数，仅推送阶段使用
+	Failed      int      `json:"failed"`           // 失败的用户数
+	Skipped     int      `json:"skipped"`          // 跳过的用户数：恢复执行时已完成的用户，以及推送阶段已退订或内容未通过审核的用户
+	Errors      []string `json:"errors,omitempty"` // 错误摘要，最多保留前20条
+}
+
+// AddError 记录一个失败的用户
+func (c *StageCounts) AddError(cid string, err error) {
+	c.Failed++
+	if len(c.Errors) < maxStageErrors {
+		c.Errors = append(c.Errors, fmt.Sprintf("%s: %v", cid, err))
+	}
+}
+
+// JobStage 一次任务执行中的一个阶段
+type JobStage struct {
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	StageCounts
+	Error string `json:"error,omitempty"` // 导致阶段中止的错误
+}
+
+// Completed 阶段是否已执行完成（没有中止），恢复执行时只重试其中失败的用户
+func (s *JobStage) Completed() bool {
+	return s.Error == ""
+}
+
+// JobRun 定时任务的一次执行记录
+type JobRun struct {
+	ID         int64      `json:"id"`
+	Job        string     `json:"job"`
+	Instance   string     `json:"instance"` // 执行任务的实例
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms"` // 执行耗时，恢复执行的记录为最后一次执行的耗时
+	Stages     []JobStage `json:"stages"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// JobInfo 定时任务及其调度状态
+type JobInfo struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Enabled     bool       `json:"enabled"`
+	Cron        string     `json:"cron,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"`
+	IsRunning   bool       `json:"is_running"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastRun     *JobRun    `json:"last_run,omitempty"` // 最近一次执行记录
+	Lease       *JobLease  `json:"lease,omitempty"`    // 任务租约，未启用 scheduler.lock 时为空
+}
+
+// JobLease 任务的执行租约，多实例部署时同一次调度只有持有租约的实例执行
+type JobLease struct {
+	Job         string    `json:"job"`
+	Owner       string    `json:"owner"`        // 最近一次获取租约的实例
+	Slot        int64     `json:"slot"`         // 最近一次获取租约时的调度时间点（Unix秒）
+	DoneSlot    int64     `json:"done_slot"`    // 已执行完成的调度时间点（Unix秒）
+	HeartbeatAt time.Time `json:"heartbeat_at"` // 最近一次续期时间
+	ExpiresAt   time.Time `json:"expires_at"`   // 租约过期时间，执行完成后立即过期
+	Held        bool      `json:"held"`         // 租约是否未过期，即是否有实例正在执行
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// 审核状态
+const (
+	ReviewPending  = "pending"  // 待审核
+	ReviewApproved = "approved" // 审核通过，已推送
+	ReviewRejected = "rejected" // 审核拒绝，不再推送
+)
+
+// CommunityRisk 社区帖子的风险字段（simi_community_history 中的 law/politics/ad/score）
+type CommunityRisk struct {
+	Law      string
+	Politics string
+	Ad       string
+	Score    string
+}
+
+// ModerationReview 审核未通过、等待人工审核的推送内容
+type ModerationReview struct {
+	ID         int64              `json:"id"`
+	CID        string             `json:"cid"`      // 推送对象，为空表示群发
+	ItemKey    string             `json:"item_key"` // 推送内容的唯一标识
+	Item       RecommendationItem `json:"item"`
+	Reason     string             `json:"reason"` // 未通过审核的原因
+	Status     string             `json:"status"` // pending/approved/rejected
+	CreatedAt  time.Time          `json:"created_at"`
+	ReviewedAt *time.Time         `json:"reviewed_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PushChannelDefault 默认推送渠道，使用 external_api.tag_push_url
+const PushChannelDefault = "app"
+
+// UserPreferences 用户的推送偏好
+type UserPreferences struct {
+	CID                string    `json:"cid"`
+	OptOut             bool      `json:"opt_out"`             // 全局退订，不再推送任何内容（包括群发）
+	UnsubscribedTopics []string  `json:"unsubscribed_topics"` // 退订的话题，关键词、标题或内容包含该话题的内容不再推送
+	UnsubscribedKBs    []string  `json:"unsubscribed_kbs"`    // 退订的知识库ID
+	PreferredChannel   string    `json:"preferred_channel"`   // 推送渠道，默认 app
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// HasUnsubscriptions 是否退订了部分话题或知识库
+func (p *UserPreferences) HasUnsubscriptions() bool {
+	return len(p.UnsubscribedTopics) > 0 || len(p.UnsubscribedKBs) > 0
+}
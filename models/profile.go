@@ -1,6 +1,14 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type UserProfile struct {
 	CID        string    `db:"cid" json:"cid"`
@@ -11,6 +19,548 @@ type UserProfile struct {
 
 // WeightedKeyword 带权重的关键词
 type WeightedKeyword struct {
-	Keyword string  `json:"keyword"` // 关键词
-	Weight  float64 `json:"weight"`  // 权重，范围0-1
+	Keyword  string  `json:"keyword"`             // 关键词
+	Weight   float64 `json:"weight"`              // 权重，范围0-1
+	LastSeen string  `json:"last_seen,omitempty"` // 最近一次在用户数据中出现的时间（RFC3339）
+	Evidence int     `json:"evidence,omitempty"`  // 累计出现次数
+}
+
+// ProfileSchemaVersion 当前画像结构版本，未标注版本的画像视为版本0
+// 版本2起加权关键词带有 last_seen 和 evidence
+const ProfileSchemaVersion = 2
+
+// 活跃度等级，按从低到高排列
+var activityLevels = []string{"minimal", "low", "medium", "high"}
+
+// DefaultUserType 无法确定用户类型时使用的类型
+const DefaultUserType = "新手"
+
+// ProfileContentSources 降级生成画像时记录的数据量
+type ProfileContentSources struct {
+	CommunityPostsCount     int      `json:"community_posts_count"`
+	GroupMessagesCount      int      `json:"group_messages_count"`
+	AssistantQuestionsCount int      `json:"assistant_questions_count"`
+	ActiveGroups            []string `json:"active_groups"`
+}
+
+// Profile 用户画像（user_profiles.profile_json 的结构）
+// 读写画像都应通过 ParseProfile / ParseUserProfile 和 Encode，保证字段规则一致
+type Profile struct {
+	SchemaVersion    int                    `json:"schema_version"`
+	UserID           string                 `json:"user_id,omitempty"`
+	Interests        []string               `json:"interests"`
+	WeightedKeywords []WeightedKeyword      `json:"weighted_keywords"`
+	ActivityLevel    string                 `json:"activity_level"`
+	UserType         string                 `json:"user_type"`
+	UpdatedAt        string                 `json:"updated_at"`
+	DataSources      map[string]bool        `json:"data_sources,omitempty"`
+	ContentSources   *ProfileContentSources `json:"content_sources,omitempty"`
+
+	// Extra 未识别的字段，原样保留
+	Extra map[string]json.RawMessage `json:"-"`
+
+	// legacyKeywords 旧版画像中的 keywords 字段，迁移时用于生成加权关键词
+	legacyKeywords []string
+}
+
+// profileFields 画像的已知字段
+type profileFields Profile
+
+// UnmarshalJSON 兼容旧版画像的多种写法：interests 为逗号分隔字符串、
+// weighted_keywords 为字符串数组或 关键词->权重 对象、权重为字符串等
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = Profile{Extra: make(map[string]json.RawMessage)}
+	for key, value := range raw {
+		switch key {
+		case "schema_version":
+			p.SchemaVersion = int(decodeNumber(value))
+		case "user_id":
+			p.UserID = decodeString(value)
+		case "interests":
+			p.Interests = decodeStringList(value)
+		case "weighted_keywords":
+			p.WeightedKeywords = decodeWeightedKeywords(value)
+		case "keywords":
+			p.legacyKeywords = decodeStringList(value)
+		case "activity_level":
+			p.ActivityLevel = decodeString(value)
+		case "user_type":
+			p.UserType = decodeString(value)
+		case "updated_at":
+			p.UpdatedAt = decodeString(value)
+		case "data_sources":
+			_ = json.Unmarshal(value, &p.DataSources)
+		case "content_sources":
+			_ = json.Unmarshal(value, &p.ContentSources)
+		default:
+			p.Extra[key] = value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 输出已知字段，并附带保留的未识别字段
+func (p Profile) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal(profileFields(p))
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Extra) == 0 {
+		return known, nil
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(known, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range p.Extra {
+		if _, ok := merged[key]; !ok {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// ParseProfile 解析 profile_json，迁移到当前版本并做一致性整理
+func ParseProfile(profileJSON string) (*Profile, error) {
+	p := &Profile{}
+	if strings.TrimSpace(profileJSON) != "" {
+		if err := json.Unmarshal([]byte(profileJSON), p); err != nil {
+			return nil, fmt.Errorf("解析画像数据失败: %v", err)
+		}
+	}
+	p.migrate()
+	p.Normalize()
+	return p, nil
+}
+
+// ParseUserProfile 解析数据库中的画像记录；画像JSON中没有关键词时使用 keywords 列
+func ParseUserProfile(up *UserProfile) (*Profile, error) {
+	if up == nil {
+		return nil, fmt.Errorf("用户画像为空")
+	}
+	p := &Profile{}
+	if strings.TrimSpace(up.ProfileRaw) != "" {
+		if err := json.Unmarshal([]byte(up.ProfileRaw), p); err != nil {
+			return nil, fmt.Errorf("解析画像数据失败: %v", err)
+		}
+	}
+	if len(p.WeightedKeywords) == 0 && len(p.legacyKeywords) == 0 && up.Keywords != "" {
+		p.legacyKeywords = decodeStringList(json.RawMessage(up.Keywords))
+	}
+	if p.UserID == "" {
+		p.UserID = up.CID
+	}
+	p.migrate()
+	p.Normalize()
+	return p, nil
+}
+
+// migrate 将旧版本画像迁移到当前版本
+func (p *Profile) migrate() {
+	if p.SchemaVersion >= ProfileSchemaVersion {
+		return
+	}
+	// 版本0：部分画像只有 keywords 字段，按位置分配递减权重
+	if len(p.WeightedKeywords) == 0 && len(p.legacyKeywords) > 0 {
+		p.WeightedKeywords = positionalWeights(p.legacyKeywords)
+	}
+	p.legacyKeywords = nil
+	// 版本1：关键词没有出现时间，以画像更新时间作为最近出现时间
+	for i := range p.WeightedKeywords {
+		if p.WeightedKeywords[i].LastSeen == "" {
+			p.WeightedKeywords[i].LastSeen = p.UpdatedAt
+		}
+	}
+	p.SchemaVersion = ProfileSchemaVersion
+}
+
+// Normalize 画像一致性整理，所有画像在保存和使用前都经过这里：
+// 关键词和兴趣去空白、去重；同一关键词保留最高权重，权重限制在0-1并按权重降序排列；
+// 只有兴趣时按位置生成加权关键词，只有关键词时用关键词作为兴趣；
+// 活跃度和用户类型取值规范化；关键词缺少出现时间和次数时以画像更新时间、1次补齐
+func (p *Profile) Normalize() {
+	p.SchemaVersion = ProfileSchemaVersion
+	p.Interests = dedupeTerms(p.Interests)
+	if p.UpdatedAt == "" {
+		p.UpdatedAt = time.Now().Format(time.RFC3339)
+	}
+
+	if len(p.WeightedKeywords) == 0 && len(p.Interests) > 0 {
+		p.WeightedKeywords = positionalWeights(p.Interests)
+	}
+
+	// 同一关键词合并为一条：权重取最高，出现时间取最近，出现次数累加
+	merged := make(map[string]*WeightedKeyword)
+	order := make([]string, 0, len(p.WeightedKeywords))
+	for _, wk := range p.WeightedKeywords {
+		wk.Keyword = strings.Join(strings.Fields(wk.Keyword), " ")
+		if wk.Keyword == "" {
+			continue
+		}
+		if wk.Weight < 0 {
+			wk.Weight = 0
+		} else if wk.Weight > 1 {
+			wk.Weight = 1
+		}
+		if wk.LastSeen == "" {
+			wk.LastSeen = p.UpdatedAt
+		}
+		if wk.Evidence <= 0 {
+			wk.Evidence = 1
+		}
+		existing, ok := merged[wk.Keyword]
+		if !ok {
+			entry := wk
+			merged[wk.Keyword] = &entry
+			order = append(order, wk.Keyword)
+			continue
+		}
+		if wk.Weight > existing.Weight {
+			existing.Weight = wk.Weight
+		}
+		if parseTime(wk.LastSeen).After(parseTime(existing.LastSeen)) {
+			existing.LastSeen = wk.LastSeen
+		}
+		existing.Evidence += wk.Evidence
+	}
+	keywords := make([]WeightedKeyword, 0, len(order))
+	for _, kw := range order {
+		keywords = append(keywords, *merged[kw])
+	}
+	sort.SliceStable(keywords, func(i, j int) bool { return keywords[i].Weight > keywords[j].Weight })
+	p.WeightedKeywords = keywords
+
+	if len(p.Interests) == 0 && len(p.WeightedKeywords) > 0 {
+		p.Interests = p.Keywords()
+	}
+
+	p.ActivityLevel = strings.ToLower(strings.TrimSpace(p.ActivityLevel))
+	if activityRank(p.ActivityLevel) < 0 {
+		p.ActivityLevel = "low"
+	}
+
+	p.UserType = strings.TrimSpace(p.UserType)
+	if p.UserType == "" || p.UserType == "无法确定" {
+		p.UserType = DefaultUserType
+	}
+}
+
+// Keywords 按权重顺序返回关键词列表，即 user_profiles.keywords 的内容
+func (p *Profile) Keywords() []string {
+	keywords := make([]string, 0, len(p.WeightedKeywords))
+	for _, wk := range p.WeightedKeywords {
+		keywords = append(keywords, wk.Keyword)
+	}
+	return keywords
+}
+
+// IsEmpty 画像是否既没有兴趣也没有关键词
+func (p *Profile) IsEmpty() bool {
+	return len(p.Interests) == 0 && len(p.WeightedKeywords) == 0
+}
+
+// Encode 整理后序列化为 profile_json 和 keywords 两列的内容
+func (p *Profile) Encode() (string, string, error) {
+	p.Normalize()
+	profileJSON, err := json.Marshal(p)
+	if err != nil {
+		return "", "", err
+	}
+	keywordsJSON, err := json.Marshal(p.Keywords())
+	if err != nil {
+		return "", "", err
+	}
+	return string(profileJSON), string(keywordsJSON), nil
+}
+
+// KeywordDecay 合并画像时旧关键词的衰减参数
+type KeywordDecay struct {
+	HalfLife       time.Duration // 半衰期，为0时不衰减
+	PruneThreshold float64       // 衰减后权重低于该值的关键词被移除
+	Now            time.Time     // 计算衰减的当前时间，为零值时使用 time.Now()
+}
+
+// MergeProfiles 合并两份画像：兴趣取并集，同一关键词取最高权重，活跃度取较高者，
+// 用户类型和数据来源以新画像为准，未识别字段以旧画像为准
+func MergeProfiles(oldProfile, newProfile *Profile) *Profile {
+	return MergeProfilesWithDecay(oldProfile, newProfile, KeywordDecay{})
+}
+
+// MergeProfilesWithDecay 合并两份画像，旧画像中的关键词权重按距上次合并的时间指数衰减：
+// weight × 0.5^(间隔/半衰期)，多次合并的累计衰减等于按最近出现时间一次性衰减。新画像中出现的关键词记为本次出现，出现次数累加；
+// 衰减后低于阈值的关键词被移除，仅属于被移除关键词的旧兴趣一并移除
+func MergeProfilesWithDecay(oldProfile, newProfile *Profile, decay KeywordDecay) *Profile {
+	now := decay.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	nowStr := now.Format(time.RFC3339)
+
+	merged := &Profile{
+		UserID:         oldProfile.UserID,
+		ActivityLevel:  oldProfile.ActivityLevel,
+		UserType:       oldProfile.UserType,
+		UpdatedAt:      nowStr,
+		DataSources:    oldProfile.DataSources,
+		ContentSources: oldProfile.ContentSources,
+		Extra:          make(map[string]json.RawMessage),
+	}
+	if newProfile.UserID != "" {
+		merged.UserID = newProfile.UserID
+	}
+
+	// 合并关键词：旧关键词先衰减，再与新关键词取最高权重
+	keywords := make(map[string]WeightedKeyword)
+	order := make([]string, 0, len(oldProfile.WeightedKeywords)+len(newProfile.WeightedKeywords))
+	pruned := make(map[string]bool)
+	// 旧画像中保存的权重已衰减到上次合并（旧画像更新时间）为止，这里只衰减之后经过的时间，
+	// 否则每次合并都会从 last_seen 起重复计算整段衰减
+	decayedAt := parseTime(oldProfile.UpdatedAt)
+	for _, wk := range oldProfile.WeightedKeywords {
+		if decay.HalfLife > 0 {
+			since := decayedAt
+			if lastSeen := parseTime(wk.LastSeen); lastSeen.After(since) {
+				since = lastSeen
+			}
+			if !since.IsZero() && now.After(since) {
+				wk.Weight *= math.Pow(0.5, float64(now.Sub(since))/float64(decay.HalfLife))
+			}
+		}
+		keywords[wk.Keyword] = wk
+		order = append(order, wk.Keyword)
+	}
+	for _, wk := range newProfile.WeightedKeywords {
+		evidence := wk.Evidence
+		if evidence <= 0 {
+			evidence = 1
+		}
+		wk.LastSeen = nowStr
+		wk.Evidence = evidence
+		if old, ok := keywords[wk.Keyword]; ok {
+			if old.Weight > wk.Weight {
+				wk.Weight = old.Weight
+			}
+			wk.Evidence += old.Evidence
+		} else {
+			order = append(order, wk.Keyword)
+		}
+		keywords[wk.Keyword] = wk
+	}
+	for _, kw := range order {
+		wk, ok := keywords[kw]
+		if !ok {
+			continue
+		}
+		delete(keywords, kw)
+		if decay.PruneThreshold > 0 && wk.Weight < decay.PruneThreshold {
+			pruned[kw] = true
+			continue
+		}
+		merged.WeightedKeywords = append(merged.WeightedKeywords, wk)
+	}
+
+	// 合并兴趣
+	for _, interest := range oldProfile.Interests {
+		if !pruned[interest] {
+			merged.Interests = append(merged.Interests, interest)
+		}
+	}
+	merged.Interests = append(merged.Interests, newProfile.Interests...)
+
+	if activityRank(newProfile.ActivityLevel) > activityRank(merged.ActivityLevel) {
+		merged.ActivityLevel = newProfile.ActivityLevel
+	}
+	// 新画像只得到默认类型时保留旧画像中已确定的类型
+	if newProfile.UserType != "" && (newProfile.UserType != DefaultUserType || merged.UserType == "") {
+		merged.UserType = newProfile.UserType
+	}
+	if newProfile.DataSources != nil {
+		merged.DataSources = newProfile.DataSources
+	}
+	if newProfile.ContentSources != nil {
+		merged.ContentSources = newProfile.ContentSources
+	}
+
+	for key, value := range newProfile.Extra {
+		merged.Extra[key] = value
+	}
+	for key, value := range oldProfile.Extra {
+		merged.Extra[key] = value
+	}
+
+	merged.Normalize()
+	return merged
+}
+
+// DecayKeywords 没有新内容时只对画像关键词做时间衰减，等同于与空画像合并
+// changed 表示有关键词被移除，或有关键词的权重下降不少于 minDelta，调用方据此决定是否保存；
+// 不保存时衰减基准（画像更新时间）不变，之后再次衰减的结果相同
+func DecayKeywords(profile *Profile, decay KeywordDecay, minDelta float64) (decayed *Profile, changed bool) {
+	decayed = MergeProfilesWithDecay(profile, &Profile{}, decay)
+	if len(decayed.WeightedKeywords) != len(profile.WeightedKeywords) {
+		return decayed, true
+	}
+	before := make(map[string]float64, len(profile.WeightedKeywords))
+	for _, wk := range profile.WeightedKeywords {
+		before[wk.Keyword] = wk.Weight
+	}
+	for _, wk := range decayed.WeightedKeywords {
+		old, ok := before[wk.Keyword]
+		if !ok || old-wk.Weight >= minDelta {
+			return decayed, true
+		}
+	}
+	return decayed, false
+}
+
+// parseTime 解析 RFC3339 时间，失败时返回零值
+func parseTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// IsValidActivityLevel 是否为有效的活跃度等级
+func IsValidActivityLevel(level string) bool {
+	return activityRank(level) >= 0
+}
+
+// activityRank 活跃度等级的序号，无效取值返回-1
+func activityRank(level string) int {
+	for i, l := range activityLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// positionalWeights 按位置分配递减权重，首个关键词权重最高
+func positionalWeights(terms []string) []WeightedKeyword {
+	keywords := make([]WeightedKeyword, 0, len(terms))
+	for i, term := range dedupeTerms(terms) {
+		weight := 0.9 - float64(i)*0.1
+		if weight < 0.1 {
+			weight = 0.1
+		}
+		keywords = append(keywords, WeightedKeyword{Keyword: term, Weight: weight})
+	}
+	return keywords
+}
+
+// dedupeTerms 去除空白和重复项，保持原有顺序
+func dedupeTerms(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	seen := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		t = strings.Join(strings.Fields(t), " ")
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// decodeString 解析字符串字段，非字符串时返回空串
+func decodeString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// decodeNumber 解析数字字段，兼容字符串形式的数字
+func decodeNumber(raw json.RawMessage) float64 {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0
+	}
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f
+	}
+	return 0
+}
+
+// decodeStringList 解析字符串列表，兼容逗号、顿号等分隔的单个字符串
+func decodeStringList(raw json.RawMessage) []string {
+	var list []interface{}
+	if err := json.Unmarshal(raw, &list); err == nil {
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.FieldsFunc(s, func(r rune) bool {
+			return strings.ContainsRune(",，、;；", r)
+		})
+	}
+	return nil
+}
+
+// decodeWeightedKeywords 解析加权关键词，兼容对象数组、字符串数组和 关键词->权重 对象
+func decodeWeightedKeywords(raw json.RawMessage) []WeightedKeyword {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err == nil {
+		out := make([]WeightedKeyword, 0, len(items))
+		plain := make([]string, 0)
+		for _, item := range items {
+			var obj struct {
+				Keyword  string          `json:"keyword"`
+				Weight   json.RawMessage `json:"weight"`
+				LastSeen string          `json:"last_seen"`
+				Evidence json.RawMessage `json:"evidence"`
+			}
+			if err := json.Unmarshal(item, &obj); err == nil {
+				out = append(out, WeightedKeyword{
+					Keyword:  obj.Keyword,
+					Weight:   decodeNumber(obj.Weight),
+					LastSeen: obj.LastSeen,
+					Evidence: int(decodeNumber(obj.Evidence)),
+				})
+				continue
+			}
+			if s := decodeString(item); s != "" {
+				plain = append(plain, s)
+			}
+		}
+		// 只有关键词没有权重时按位置分配权重
+		return append(out, positionalWeights(plain)...)
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err == nil {
+		out := make([]WeightedKeyword, 0, len(m))
+		for kw, w := range m {
+			out = append(out, WeightedKeyword{Keyword: kw, Weight: decodeNumber(w)})
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Weight != out[j].Weight {
+				return out[i].Weight > out[j].Weight
+			}
+			return out[i].Keyword < out[j].Keyword
+		})
+		return out
+	}
+	return nil
 }
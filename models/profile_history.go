@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// 画像来源
+const (
+	ProfileSourceLLM       = "llm"        // LLM分析生成
+	ProfileSourceFallback  = "fallback"   // LLM失败时按关键词频率降级生成
+	ProfileSourceMerge     = "merge"      // 新生成的画像与旧画像合并
+	ProfileSourceManual    = "manual"     // 人工修改
+	ProfileSourceColdStart = "cold_start" // 没有内容数据时按所在群组生成
+	ProfileSourceDecay     = "decay"      // 没有新内容时按时间衰减关键词
+)
+
+// ProfileHistory 用户画像的一个历史版本
+type ProfileHistory struct {
+	ID            int64     `json:"id"`
+	CID           string    `json:"cid"`
+	ProfileRaw    string    `json:"-"`
+	Keywords      string    `json:"-"`
+	Source        string    `json:"source"`         // 画像来源：llm/fallback/merge/manual/cold_start
+	Model         string    `json:"model"`          // 生成画像使用的模型
+	PromptVersion string    `json:"prompt_version"` // 生成画像使用的提示词版本
+	CreatedAt     time.Time `json:"created_at"`
+
+	Profile *Profile `json:"profile,omitempty"` // 解析后的画像
+}
+
+// KeywordWeightChange 关键词权重变化
+type KeywordWeightChange struct {
+	Keyword   string  `json:"keyword"`
+	OldWeight float64 `json:"old_weight"` // 旧版本中的权重，新增关键词为0
+	NewWeight float64 `json:"new_weight"` // 新版本中的权重，移除的关键词为0
+}
+
+// ProfileDiff 两个画像版本之间的差异
+type ProfileDiff struct {
+	CID              string                `json:"cid"`
+	From             *ProfileHistory       `json:"from"`
+	To               *ProfileHistory       `json:"to"`
+	AddedInterests   []string              `json:"added_interests"`
+	RemovedInterests []string              `json:"removed_interests"`
+	AddedKeywords    []KeywordWeightChange `json:"added_keywords"`
+	RemovedKeywords  []KeywordWeightChange `json:"removed_keywords"`
+	ChangedKeywords  []KeywordWeightChange `json:"changed_keywords"` // 权重发生变化的关键词
+}
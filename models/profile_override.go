@@ -0,0 +1,75 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ProfileOverrides 人工维护的画像覆盖设置，每次生成或合并画像后重新应用，不会被覆盖
+type ProfileOverrides struct {
+	CID             string            `json:"cid"`
+	PinnedKeywords  []WeightedKeyword `json:"pinned_keywords"`  // 固定的关键词及权重，始终保留在画像中
+	BlockedKeywords []string          `json:"blocked_keywords"` // 屏蔽的关键词，从关键词和兴趣中移除
+	UserType        string            `json:"user_type"`        // 强制的用户类型，为空表示不覆盖
+	ActivityLevel   string            `json:"activity_level"`   // 强制的活跃度（minimal/low/medium/high），为空表示不覆盖
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// IsEmpty 是否没有任何覆盖设置
+func (o *ProfileOverrides) IsEmpty() bool {
+	return len(o.PinnedKeywords) == 0 && len(o.BlockedKeywords) == 0 && o.UserType == "" && o.ActivityLevel == ""
+}
+
+// ApplyOverrides 在画像上应用覆盖设置：移除屏蔽的关键词和兴趣，固定关键词使用指定权重，
+// 强制的用户类型和活跃度覆盖生成结果。屏蔽和固定的关键词按不区分大小写匹配
+func (p *Profile) ApplyOverrides(o *ProfileOverrides) {
+	if o == nil || o.IsEmpty() {
+		return
+	}
+
+	blocked := make(map[string]bool, len(o.BlockedKeywords))
+	for _, kw := range o.BlockedKeywords {
+		blocked[strings.ToLower(strings.TrimSpace(kw))] = true
+	}
+	pinned := make(map[string]WeightedKeyword, len(o.PinnedKeywords))
+	for _, wk := range o.PinnedKeywords {
+		pinned[strings.ToLower(strings.TrimSpace(wk.Keyword))] = wk
+	}
+
+	keywords := make([]WeightedKeyword, 0, len(p.WeightedKeywords)+len(o.PinnedKeywords))
+	for _, wk := range p.WeightedKeywords {
+		key := strings.ToLower(wk.Keyword)
+		if blocked[key] {
+			continue
+		}
+		if pin, ok := pinned[key]; ok {
+			wk.Weight = pin.Weight
+			delete(pinned, key)
+		}
+		keywords = append(keywords, wk)
+	}
+	for _, wk := range o.PinnedKeywords {
+		key := strings.ToLower(strings.TrimSpace(wk.Keyword))
+		if _, ok := pinned[key]; ok {
+			keywords = append(keywords, WeightedKeyword{Keyword: wk.Keyword, Weight: wk.Weight})
+			delete(pinned, key)
+		}
+	}
+	p.WeightedKeywords = keywords
+
+	interests := make([]string, 0, len(p.Interests))
+	for _, interest := range p.Interests {
+		if !blocked[strings.ToLower(interest)] {
+			interests = append(interests, interest)
+		}
+	}
+	p.Interests = interests
+
+	if o.UserType != "" {
+		p.UserType = o.UserType
+	}
+	if o.ActivityLevel != "" {
+		p.ActivityLevel = o.ActivityLevel
+	}
+	p.Normalize()
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	profile := &Profile{
+		UserType:      "新手",
+		ActivityLevel: "low",
+		Interests:     []string{"比特币", "合约", "NFT"},
+		WeightedKeywords: []WeightedKeyword{
+			{Keyword: "比特币", Weight: 0.9, Evidence: 5},
+			{Keyword: "合约", Weight: 0.7},
+			{Keyword: "NFT", Weight: 0.3},
+		},
+	}
+	profile.ApplyOverrides(&ProfileOverrides{
+		PinnedKeywords: []WeightedKeyword{
+			{Keyword: "nft", Weight: 0.8}, // 已有关键词使用固定权重
+			{Keyword: "质押", Weight: 0.6},  // 新关键词追加到画像
+		},
+		BlockedKeywords: []string{"合约 "},
+		UserType:        "投资者",
+		ActivityLevel:   "high",
+	})
+
+	weights := make(map[string]float64)
+	for _, wk := range profile.WeightedKeywords {
+		weights[wk.Keyword] = wk.Weight
+	}
+	want := map[string]float64{"比特币": 0.9, "NFT": 0.8, "质押": 0.6}
+	if len(weights) != len(want) {
+		t.Fatalf("关键词为 %+v，期望 %v", profile.WeightedKeywords, want)
+	}
+	for kw, w := range want {
+		if got, ok := weights[kw]; !ok || got != w {
+			t.Errorf("关键词 %s 权重为 %v（存在: %v），期望 %v", kw, got, ok, w)
+		}
+	}
+	for _, wk := range profile.WeightedKeywords {
+		if wk.Keyword == "比特币" && wk.Evidence != 5 {
+			t.Errorf("未固定的关键词不应改变，出现次数为 %d", wk.Evidence)
+		}
+	}
+
+	if slices.Contains(profile.Interests, "合约") {
+		t.Errorf("屏蔽的兴趣应被移除，实际 %v", profile.Interests)
+	}
+	if !slices.Contains(profile.Interests, "比特币") {
+		t.Errorf("未屏蔽的兴趣应保留，实际 %v", profile.Interests)
+	}
+	if profile.UserType != "投资者" || profile.ActivityLevel != "high" {
+		t.Errorf("用户类型和活跃度为 %s/%s，期望 投资者/high", profile.UserType, profile.ActivityLevel)
+	}
+}
+
+func TestApplyOverridesBlockBeatsExisting(t *testing.T) {
+	profile := &Profile{
+		Interests:        []string{"Meme"},
+		WeightedKeywords: []WeightedKeyword{{Keyword: "Meme", Weight: 1}},
+	}
+	profile.ApplyOverrides(&ProfileOverrides{BlockedKeywords: []string{"meme"}})
+	if len(profile.WeightedKeywords) != 0 || len(profile.Interests) != 0 {
+		t.Errorf("屏蔽后关键词为 %+v，兴趣为 %v，期望全部移除", profile.WeightedKeywords, profile.Interests)
+	}
+}
+
+func TestApplyOverridesEmpty(t *testing.T) {
+	profile := &Profile{UserType: "新手", WeightedKeywords: []WeightedKeyword{{Keyword: "比特币", Weight: 0.5}}}
+	profile.ApplyOverrides(&ProfileOverrides{})
+	profile.ApplyOverrides(nil)
+	if profile.UserType != "新手" || len(profile.WeightedKeywords) != 1 || profile.WeightedKeywords[0].Weight != 0.5 {
+		t.Errorf("没有覆盖设置时画像不应改变，实际 %+v", profile)
+	}
+}
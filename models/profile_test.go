@@ -0,0 +1,119 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMergeProfilesWithDecayRepeatedMerges(t *testing.T) {
+	start := time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC)
+	decay := KeywordDecay{HalfLife: 30 * 24 * time.Hour, PruneThreshold: 0.1}
+
+	profile := &Profile{
+		UserID:    "u1",
+		UpdatedAt: start.Format(time.RFC3339),
+		WeightedKeywords: []WeightedKeyword{
+			{Keyword: "比特币", Weight: 0.9, Evidence: 1, LastSeen: start.Format(time.RFC3339)},
+		},
+	}
+
+	// 每天合并一次，新画像中不再出现该关键词
+	for day := 1; day <= 90; day++ {
+		decay.Now = start.AddDate(0, 0, day)
+		profile = MergeProfilesWithDecay(profile, &Profile{}, decay)
+
+		want := 0.9 * math.Pow(0.5, float64(day)/30)
+		if len(profile.WeightedKeywords) != 1 {
+			t.Fatalf("第%d天关键词被移除，期望权重 %.3f", day, want)
+		}
+		if got := profile.WeightedKeywords[0].Weight; math.Abs(got-want) > 0.01 {
+			t.Fatalf("第%d天权重为 %.3f，期望 %.3f", day, got, want)
+		}
+	}
+
+	// 约三个月后降到阈值以下被移除
+	decay.Now = start.AddDate(0, 0, 100)
+	profile = MergeProfilesWithDecay(profile, &Profile{}, decay)
+	if len(profile.WeightedKeywords) != 0 {
+		t.Errorf("第100天关键词应被移除，实际权重 %.3f", profile.WeightedKeywords[0].Weight)
+	}
+}
+
+func TestMergeProfilesWithDecayRefreshedKeyword(t *testing.T) {
+	start := time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC)
+	decay := KeywordDecay{HalfLife: 30 * 24 * time.Hour, PruneThreshold: 0.1}
+
+	profile := &Profile{
+		UserID:    "u1",
+		UpdatedAt: start.Format(time.RFC3339),
+		WeightedKeywords: []WeightedKeyword{
+			{Keyword: "以太坊", Weight: 0.8, Evidence: 1, LastSeen: start.Format(time.RFC3339)},
+		},
+	}
+
+	// 第10天再次出现后，衰减从该次出现重新计算
+	decay.Now = start.AddDate(0, 0, 10)
+	profile = MergeProfilesWithDecay(profile, &Profile{
+		WeightedKeywords: []WeightedKeyword{{Keyword: "以太坊", Weight: 0.8}},
+	}, decay)
+	decay.Now = start.AddDate(0, 0, 40)
+	profile = MergeProfilesWithDecay(profile, &Profile{}, decay)
+
+	if len(profile.WeightedKeywords) != 1 {
+		t.Fatalf("关键词不应被移除")
+	}
+	if got, want := profile.WeightedKeywords[0].Weight, 0.4; math.Abs(got-want) > 0.01 {
+		t.Errorf("权重为 %.3f，期望 %.3f", got, want)
+	}
+	if got := profile.WeightedKeywords[0].Evidence; got != 2 {
+		t.Errorf("出现次数为 %d，期望 2", got)
+	}
+}
+
+func TestDecayKeywordsWithoutNewData(t *testing.T) {
+	start := time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC)
+	decay := KeywordDecay{HalfLife: 30 * 24 * time.Hour, PruneThreshold: 0.1}
+
+	profile := &Profile{
+		UserID:    "u1",
+		UpdatedAt: start.Format(time.RFC3339),
+		Interests: []string{"比特币", "以太坊"},
+		WeightedKeywords: []WeightedKeyword{
+			{Keyword: "比特币", Weight: 0.9, Evidence: 3, LastSeen: start.Format(time.RFC3339)},
+			{Keyword: "以太坊", Weight: 0.15, Evidence: 1, LastSeen: start.Format(time.RFC3339)},
+		},
+	}
+
+	// 1天内权重下降不足0.05，不需要保存；未保存时衰减基准不变
+	decay.Now = start.AddDate(0, 0, 1)
+	if _, changed := DecayKeywords(profile, decay, 0.05); changed {
+		t.Error("权重变化很小时不应要求保存")
+	}
+
+	// 20天后 以太坊 降到阈值以下被移除，比特币 按半衰期衰减
+	decay.Now = start.AddDate(0, 0, 20)
+	decayed, changed := DecayKeywords(profile, decay, 0.05)
+	if !changed {
+		t.Fatal("关键词被移除时应要求保存")
+	}
+	if len(decayed.WeightedKeywords) != 1 || decayed.WeightedKeywords[0].Keyword != "比特币" {
+		t.Fatalf("衰减后的关键词为 %+v，期望只保留 比特币", decayed.WeightedKeywords)
+	}
+	if got, want := decayed.WeightedKeywords[0].Weight, 0.9*math.Pow(0.5, 20.0/30); math.Abs(got-want) > 0.01 {
+		t.Errorf("权重为 %.3f，期望 %.3f", got, want)
+	}
+	if got := decayed.WeightedKeywords[0].Evidence; got != 3 {
+		t.Errorf("没有新内容时出现次数不应变化，实际 %d", got)
+	}
+	if len(decayed.Interests) != 1 || decayed.Interests[0] != "比特币" {
+		t.Errorf("兴趣为 %v，期望移除 以太坊", decayed.Interests)
+	}
+
+	// 保存后从新的更新时间继续衰减，不重复计算已衰减的时间
+	decay.Now = start.AddDate(0, 0, 50)
+	again, _ := DecayKeywords(decayed, decay, 0.05)
+	if got, want := again.WeightedKeywords[0].Weight, 0.9*math.Pow(0.5, 50.0/30); math.Abs(got-want) > 0.01 {
+		t.Errorf("再次衰减后权重为 %.3f，期望 %.3f", got, want)
+	}
+}
@@ -4,8 +4,10 @@ type RecommendationItem struct {
 	Source        string  `json:"source"` // group_summary / rag / knowledge_base
 	Title         string  `json:"title"`
 	URL           string  `json:"url,omitempty"`
-	Score         float64 `json:"score,omitempty"`
+	Score         float64 `json:"score,omitempty"`       // 原始相关性分数
+	FusedScore    float64 `json:"fused_score,omitempty"` // 多路结果融合后的排序分数，仅用于排序
 	RefID         string  `json:"ref_id,omitempty"`
+	KnowledgeID   string  `json:"knowledge_id,omitempty"`   // 来源知识库ID
 	SearchKeyword string  `json:"search_keyword,omitempty"` // 用于搜索的关键词
 	Content       string  `json:"content,omitempty"`        // 推荐内容摘要
 }
@@ -11,6 +11,7 @@ const (
 	CodeUserNotFound    = 1002 // 用户不存在
 	CodeNoUserProfile   = 1003 // 用户没有画像
 	CodeNoRecommendData = 1004 // 没有推荐数据
+	CodeNotFound        = 1005 // 数据不存在
 
 	// 服务端错误 (2000-2999)
 	CodeServerError        = 2000 // 服务器内部错误
@@ -28,6 +29,7 @@ var CodeMessages = map[int]string{
 	CodeUserNotFound:       "用户不存在",
 	CodeNoUserProfile:      "用户没有画像",
 	CodeNoRecommendData:    "没有推荐数据",
+	CodeNotFound:           "数据不存在",
 	CodeServerError:        "服务器内部错误",
 	CodeDatabaseError:      "数据库错误",
 	CodeProfileGenError:    "画像生成错误",
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// SegmentRules 分群规则，不同条件之间为"且"，同一条件的多个取值之间为"或"，未设置的条件不限制
+type SegmentRules struct {
+	UserTypes        []string             `json:"user_types,omitempty"`         // 用户类型，如 投资者、技术爱好者
+	ActivityLevels   []string             `json:"activity_levels,omitempty"`    // 活跃度（minimal/low/medium/high）
+	Keywords         []SegmentKeywordRule `json:"keywords,omitempty"`           // 关键词权重阈值，需全部满足
+	ActiveWithinDays int                  `json:"active_within_days,omitempty"` // 最近N天内活跃
+}
+
+// SegmentKeywordRule 关键词权重阈值
+type SegmentKeywordRule struct {
+	Keyword   string  `json:"keyword" example:"质押"`
+	MinWeight float64 `json:"min_weight" example:"0.5"` // 关键词权重不低于该值，为0时关键词出现在兴趣中也算满足
+}
+
+// Segment 用户分群
+type Segment struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name" example:"关注质押的投资者"`
+	Description string       `json:"description"`
+	Rules       SegmentRules `json:"rules"`
+	MemberCount int          `json:"member_count"`           // 上次计算时的成员数
+	RefreshedAt *time.Time   `json:"refreshed_at,omitempty"` // 上次计算时间
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// SegmentPreview 按规则试算的分群结果
+type SegmentPreview struct {
+	Count   int      `json:"count"`
+	Members []string `json:"members"` // 部分成员 cid
+}
+
+// Match 画像是否满足分群规则，lastActive 为用户最近活跃时间
+func (r *SegmentRules) Match(p *Profile, lastActive, now time.Time) bool {
+	if len(r.UserTypes) > 0 && !containsFold(r.UserTypes, p.UserType) {
+		return false
+	}
+	if len(r.ActivityLevels) > 0 && !containsFold(r.ActivityLevels, p.ActivityLevel) {
+		return false
+	}
+	if r.ActiveWithinDays > 0 && lastActive.Before(now.AddDate(0, 0, -r.ActiveWithinDays)) {
+		return false
+	}
+	for _, rule := range r.Keywords {
+		if !p.hasKeyword(rule.Keyword, rule.MinWeight) {
+			return false
+		}
+	}
+	return true
+}
+
+// LastActive 用户最近活跃时间：关键词最近一次出现的时间，没有记录时使用 fallback
+func (p *Profile) LastActive(fallback time.Time) time.Time {
+	latest := time.Time{}
+	for _, wk := range p.WeightedKeywords {
+		if t := parseTime(wk.LastSeen); t.After(latest) {
+			latest = t
+		}
+	}
+	if latest.IsZero() {
+		return fallback
+	}
+	return latest
+}
+
+// hasKeyword 画像中是否有权重不低于 minWeight 的关键词（不区分大小写）
+func (p *Profile) hasKeyword(keyword string, minWeight float64) bool {
+	for _, wk := range p.WeightedKeywords {
+		if strings.EqualFold(wk.Keyword, keyword) && wk.Weight >= minWeight {
+			return true
+		}
+	}
+	return minWeight <= 0 && containsFold(p.Interests, keyword)
+}
+
+// containsFold 列表中是否包含指定字符串（不区分大小写）
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
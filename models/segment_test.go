@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSegmentRulesMatch(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	profile := &Profile{
+		UserType:      "投资者",
+		ActivityLevel: "high",
+		Interests:     []string{"比特币", "DeFi"},
+		WeightedKeywords: []WeightedKeyword{
+			{Keyword: "比特币", Weight: 0.8},
+			{Keyword: "质押", Weight: 0.4},
+		},
+	}
+	recent := now.AddDate(0, 0, -3)
+
+	tests := []struct {
+		name       string
+		rules      SegmentRules
+		lastActive time.Time
+		want       bool
+	}{
+		{"空规则匹配全部", SegmentRules{}, recent, true},
+		{"关键词权重达到阈值", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "比特币", MinWeight: 0.8}}}, recent, true},
+		{"关键词权重低于阈值", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "质押", MinWeight: 0.5}}}, recent, false},
+		{"关键词不区分大小写", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "defi", MinWeight: 0}}}, recent, true},
+		{"阈值为0时兴趣也算满足", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "DeFi", MinWeight: 0}}}, recent, true},
+		{"阈值大于0时只看加权关键词", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "DeFi", MinWeight: 0.1}}}, recent, false},
+		{"多个关键词需全部满足", SegmentRules{Keywords: []SegmentKeywordRule{{Keyword: "比特币", MinWeight: 0.5}, {Keyword: "以太坊"}}}, recent, false},
+		{"最近活跃", SegmentRules{ActiveWithinDays: 7}, recent, true},
+		{"活跃时间刚好在边界", SegmentRules{ActiveWithinDays: 7}, now.AddDate(0, 0, -7), true},
+		{"超过活跃天数", SegmentRules{ActiveWithinDays: 7}, now.AddDate(0, 0, -8), false},
+		{"用户类型任一匹配", SegmentRules{UserTypes: []string{"技术爱好者", "投资者"}}, recent, true},
+		{"用户类型不匹配", SegmentRules{UserTypes: []string{"技术爱好者"}}, recent, false},
+		{"活跃度不区分大小写", SegmentRules{ActivityLevels: []string{"medium", "HIGH"}}, recent, true},
+		{"活跃度不匹配", SegmentRules{ActivityLevels: []string{"low"}}, recent, false},
+		{"条件之间为且", SegmentRules{UserTypes: []string{"投资者"}, ActivityLevels: []string{"low"}}, recent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Match(profile, tt.lastActive, now); got != tt.want {
+				t.Errorf("Match() = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileLastActive(t *testing.T) {
+	fallback := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &Profile{WeightedKeywords: []WeightedKeyword{
+		{Keyword: "a", LastSeen: "2026-02-01T00:00:00Z"},
+		{Keyword: "b", LastSeen: "2026-02-10T00:00:00Z"},
+		{Keyword: "c"},
+	}}
+	if got, want := p.LastActive(fallback), time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("LastActive() = %v，期望 %v", got, want)
+	}
+	if got := (&Profile{}).LastActive(fallback); !got.Equal(fallback) {
+		t.Errorf("没有关键词时 LastActive() = %v，期望 %v", got, fallback)
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// 同义词建议的审核状态
+const (
+	SuggestionPending  = "pending"
+	SuggestionApproved = "approved"
+	SuggestionRejected = "rejected"
+)
+
+// KeywordSynonym 同义词到规范词的映射
+type KeywordSynonym struct {
+	ID        int64     `json:"id"`
+	Canonical string    `json:"canonical"` // 规范词
+	Synonym   string    `json:"synonym"`   // 同义词或变体写法
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SynonymGroup 规范词及其全部同义词
+type SynonymGroup struct {
+	Canonical string   `json:"canonical" example:"DW20"`
+	Synonyms  []string `json:"synonyms" example:"dw20代币,DW20币"`
+}
+
+// SynonymSuggestion 待审核的同义词建议
+type SynonymSuggestion struct {
+	ID         int64      `json:"id"`
+	Canonical  string     `json:"canonical"`
+	Synonym    string     `json:"synonym"`
+	Source     string     `json:"source"` // llm
+	Status     string     `json:"status"` // pending / approved / rejected
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// SynonymSuggestRequest 生成同义词建议的请求体
+type SynonymSuggestRequest struct {
+	Terms []string `json:"terms"` // 待分析的关键词，为空时使用画像中出现最多且不在词典中的关键词
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// UserSuppression 已删除全部数据的用户，之后不再为其生成画像和推荐
+type UserSuppression struct {
+	CID       string    `json:"cid"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserDataExport 系统为用户生成和保存的全部数据
+type UserDataExport struct {
+	CID               string               `json:"cid"`
+	ExportedAt        time.Time            `json:"exported_at"`
+	Profile           *Profile             `json:"profile"`            // 当前画像，没有画像时为 null
+	ProfileUpdatedAt  *time.Time           `json:"profile_updated_at"` // 当前画像的更新时间
+	ProfileHistory    []ProfileHistory     `json:"profile_history"`
+	Overrides         *ProfileOverrides    `json:"overrides"`   // 画像覆盖设置，没有设置时为 null
+	Preferences       *UserPreferences     `json:"preferences"` // 推送偏好，没有设置时为 null
+	Recommendations   []RecommendationItem `json:"recommendations"`
+	PushLogs          []PushLog            `json:"push_logs"`
+	Feedback          []ItemFeedback       `json:"feedback"`
+	Segments          []string             `json:"segments"` // 所属的分群名称
+	ModerationReviews []ModerationReview   `json:"moderation_reviews"`
+	Suppression       *UserSuppression     `json:"suppression"` // 已删除数据时的记录
+}
+
+// UserDataDeletion 删除用户数据的结果
+type UserDataDeletion struct {
+	CID     string           `json:"cid"`
+	Deleted map[string]int64 `json:"deleted"` // 表名 -> 删除的行数
+}
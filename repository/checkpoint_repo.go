@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"strings"
+)
+
+// =====================
+// 流程检查点
+// =====================
+
+// ListCheckpointCIDs 获取执行记录在某个阶段处于给定状态的用户
+func ListCheckpointCIDs(runID int64, stage string, statuses []string) ([]string, error) {
+	if len(statuses) == 0 {
+		return []string{}, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ",")
+	args := make([]any, 0, len(statuses)+2)
+	args = append(args, runID, stage)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	// 群发的检查点 cid 为空，不能使用会过滤空值的 queryStrings
+	rows, err := db.DB.Query(`SELECT cid FROM pipeline_checkpoints WHERE run_id = ? AND stage = ? AND status IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]string, 0)
+	for rows.Next() {
+		var cid string
+		if err := rows.Scan(&cid); err == nil {
+			out = append(out, cid)
+		}
+	}
+	return out, rows.Err()
+}
+
+// SaveCheckpoint 记录用户在某个阶段的处理状态
+func SaveCheckpoint(runID int64, stage, cid, status string) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO pipeline_checkpoints (run_id, stage, cid, status, updated_at)
+		VALUES (?, ?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE status = VALUES(status), updated_at = NOW()
+	`, runID, stage, cid, status)
+	return err
+}
+
+// ClaimCheckpoint 将用户在某个阶段的状态原子地置为 status，仅当该用户还没有检查点或上次处理失败时成功
+// 多个执行者同时处理同一次执行时只有一个能领取成功，返回是否领取成功
+func ClaimCheckpoint(runID int64, stage, cid, status, retryStatus string) (bool, error) {
+	res, err := db.DB.Exec(`
+		INSERT IGNORE INTO pipeline_checkpoints (run_id, stage, cid, status, updated_at)
+		VALUES (?, ?, ?, ?, NOW())
+	`, runID, stage, cid, status)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+
+	res, err = db.DB.Exec(`
+		UPDATE pipeline_checkpoints SET status = ?, updated_at = NOW()
+		WHERE run_id = ? AND stage = ? AND cid = ? AND status = ?
+	`, status, runID, stage, cid, retryStatus)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"time"
+)
+
+// =====================
+// 过期数据清理
+// =====================
+
+// DeleteExpiredRecords 删除 before 之前的推送记录、反馈、已审核内容和流程检查点，返回每张表删除的行数
+// 待审核的内容不会被清理
+func DeleteExpiredRecords(before time.Time) (map[string]int64, error) {
+	queries := []struct {
+		table string
+		query string
+		args  []any
+	}{
+		{"push_logs", `DELETE FROM push_logs WHERE created_at < ?`, []any{before}},
+		{"item_feedback", `DELETE FROM item_feedback WHERE created_at < ?`, []any{before}},
+		{"moderation_reviews", `DELETE FROM moderation_reviews WHERE status <> ? AND reviewed_at < ?`, []any{models.ReviewPending, before}},
+		{"pipeline_checkpoints", `DELETE FROM pipeline_checkpoints WHERE updated_at < ?`, []any{before}},
+	}
+
+	deleted := make(map[string]int64, len(queries))
+	for _, q := range queries {
+		res, err := db.DB.Exec(q.query, q.args...)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted[q.table] = n
+	}
+	return deleted, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+)
+
+// =====================
+// 定时任务租约
+// =====================
+
+const jobLeaseColumns = `job_name, owner, slot, done_slot, heartbeat_at, expires_at, expires_at > NOW()`
+
+// TryAcquireJobLease 尝试获取任务在调度时间点 slot 的租约，返回是否获取成功
+// 租约已过期（执行完成或持有的实例停止续期）且该时间点尚未执行完成时才能获取；token 每次获取都不同，用于续期和释放
+func TryAcquireJobLease(job, owner, token string, slot int64, ttlSec int) (bool, error) {
+	if _, err := db.DB.Exec(`
+		INSERT IGNORE INTO job_leases (job_name, owner, token, slot, done_slot, acquired_at, heartbeat_at, expires_at)
+		VALUES (?, '', '', 0, 0, NOW(), NOW(), NOW() - INTERVAL 1 SECOND)
+	`, job); err != nil {
+		return false, err
+	}
+
+	res, err := db.DB.Exec(`
+		UPDATE job_leases
+		SET owner = ?, token = ?, slot = ?, acquired_at = NOW(), heartbeat_at = NOW(), expires_at = NOW() + INTERVAL ? SECOND
+		WHERE job_name = ? AND expires_at < NOW() AND done_slot < ? AND slot <= ?
+	`, owner, token, slot, ttlSec, job, slot, slot)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RenewJobLease 续期租约，返回租约是否仍由 token 持有
+func RenewJobLease(job, token string, ttlSec int) (bool, error) {
+	res, err := db.DB.Exec(`
+		UPDATE job_leases SET heartbeat_at = NOW(), expires_at = NOW() + INTERVAL ? SECOND
+		WHERE job_name = ? AND token = ?
+	`, ttlSec, job, token)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseJobLease 释放租约，并将持有时的调度时间点标记为已执行完成
+func ReleaseJobLease(job, token string) error {
+	_, err := db.DB.Exec(`
+		UPDATE job_leases SET done_slot = slot, token = '', expires_at = NOW() - INTERVAL 1 SECOND
+		WHERE job_name = ? AND token = ?
+	`, job, token)
+	return err
+}
+
+// GetJobLease 获取任务的租约
+func GetJobLease(job string) (*models.JobLease, error) {
+	row := db.DB.QueryRow(`SELECT `+jobLeaseColumns+` FROM job_leases WHERE job_name = ?`, job)
+	return scanJobLease(row)
+}
+
+// ListJobLeases 获取全部任务的租约
+func ListJobLeases() (map[string]models.JobLease, error) {
+	rows, err := db.DB.Query(`SELECT ` + jobLeaseColumns + ` FROM job_leases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]models.JobLease)
+	for rows.Next() {
+		lease, err := scanJobLease(rows)
+		if err == nil {
+			out[lease.Job] = *lease
+		}
+	}
+	return out, rows.Err()
+}
+
+// scanJobLease 扫描一行任务租约
+func scanJobLease(row interface{ Scan(...any) error }) (*models.JobLease, error) {
+	l := &models.JobLease{}
+	if err := row.Scan(&l.Job, &l.Owner, &l.Slot, &l.DoneSlot, &l.HeartbeatAt, &l.ExpiresAt, &l.Held); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
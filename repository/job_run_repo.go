@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// =====================
+// 定时任务执行记录
+// =====================
+
+const jobRunColumns = `id, job_name, instance, status, started_at, finished_at, duration_ms, stages_json, error`
+
+// InsertJobRun 记录实例开始执行的任务，返回记录ID
+func InsertJobRun(job, instance string) (int64, error) {
+	res, err := db.DB.Exec(`
+		INSERT INTO job_runs (job_name, instance, status, started_at, stages_json)
+		VALUES (?, ?, ?, NOW(), '[]')
+	`, job, instance, models.JobRunRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ResumeJobRun 将中断或失败的执行记录恢复为执行中，由 instance 继续执行
+func ResumeJobRun(id int64, instance string) error {
+	_, err := db.DB.Exec(`
+		UPDATE job_runs SET instance = ?, status = ?, finished_at = NULL, error = ''
+		WHERE id = ?
+	`, instance, models.JobRunRunning, id)
+	return err
+}
+
+// UpdateJobRunStages 更新执行中任务已完成的阶段
+// 只更新由 instance 执行的记录，记录被其他实例接管后不再覆盖
+func UpdateJobRunStages(id int64, instance string, stages []models.JobStage) error {
+	stagesJSON, err := json.Marshal(stages)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`UPDATE job_runs SET stages_json = ? WHERE id = ? AND instance = ?`, string(stagesJSON), id, instance)
+	return err
+}
+
+// FinishJobRun 记录任务的执行结果，只更新由 run.Instance 执行的记录
+func FinishJobRun(run *models.JobRun) error {
+	stagesJSON, err := json.Marshal(run.Stages)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		UPDATE job_runs SET status = ?, finished_at = NOW(), duration_ms = ?, stages_json = ?, error = ?
+		WHERE id = ? AND instance = ?
+	`, run.Status, run.DurationMs, string(stagesJSON), run.Error, run.ID, run.Instance)
+	return err
+}
+
+// MarkInterruptedJobRuns 将任务仍为执行中的记录标记为已中断，job 为空时处理全部任务
+// 用于进程重启或接管过期租约后清理未结束的记录
+func MarkInterruptedJobRuns(job string) (int64, error) {
+	query := `UPDATE job_runs SET status = ?, finished_at = NOW(), error = '进程退出，任务未执行完成' WHERE status = ?`
+	args := []any{models.JobRunInterrupted, models.JobRunRunning}
+	if job != "" {
+		query += ` AND job_name = ?`
+		args = append(args, job)
+	}
+	res, err := db.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetJobRun 获取单条执行记录
+func GetJobRun(id int64) (*models.JobRun, error) {
+	row := db.DB.QueryRow(`SELECT `+jobRunColumns+` FROM job_runs WHERE id = ?`, id)
+	return scanJobRun(row)
+}
+
+// GetResumableJobRun 获取任务最近一次执行记录，仅当其状态为给定状态之一且在 withinHours 小时内开始时返回，否则返回 sql.ErrNoRows
+func GetResumableJobRun(job string, statuses []string, withinHours int) (*models.JobRun, error) {
+	if len(statuses) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ",")
+	args := make([]any, 0, len(statuses)+3)
+	args = append(args, job)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, withinHours, job)
+
+	row := db.DB.QueryRow(`
+		SELECT `+jobRunColumns+` FROM job_runs
+		WHERE job_name = ? AND status IN (`+placeholders+`) AND started_at >= NOW() - INTERVAL ? HOUR
+			AND id = (SELECT MAX(id) FROM job_runs WHERE job_name = ?)
+	`, args...)
+	return scanJobRun(row)
+}
+
+// ListJobRuns 按开始时间倒序获取任务的执行记录
+func ListJobRuns(job string, limit, offset int) ([]models.JobRun, error) {
+	rows, err := db.DB.Query(`SELECT `+jobRunColumns+` FROM job_runs WHERE job_name = ? ORDER BY id DESC LIMIT ? OFFSET ?`, job, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.JobRun, 0)
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err == nil {
+			out = append(out, *run)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ListLatestJobRuns 获取每个任务最近一次的执行记录
+func ListLatestJobRuns() (map[string]models.JobRun, error) {
+	rows, err := db.DB.Query(`SELECT ` + jobRunColumns + ` FROM job_runs WHERE id IN (SELECT MAX(id) FROM job_runs GROUP BY job_name)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]models.JobRun)
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err == nil {
+			out[run.Job] = *run
+		}
+	}
+	return out, rows.Err()
+}
+
+// scanJobRun 扫描一行任务执行记录
+func scanJobRun(row interface{ Scan(...any) error }) (*models.JobRun, error) {
+	run := &models.JobRun{}
+	var finishedAt sql.NullTime
+	var stagesJSON string
+	if err := row.Scan(&run.ID, &run.Job, &run.Instance, &run.Status, &run.StartedAt, &finishedAt, &run.DurationMs, &stagesJSON, &run.Error); err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time
+		run.FinishedAt = &t
+	}
+	run.Stages = make([]models.JobStage, 0)
+	if stagesJSON != "" {
+		if err := json.Unmarshal([]byte(stagesJSON), &run.Stages); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// =====================
+// 推送内容审核队列
+// =====================
+
+// InsertModerationReview 将推送内容加入审核队列，同一用户的相同内容已存在时忽略
+func InsertModerationReview(cid, itemKey string, item models.RecommendationItem, reason string) error {
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		INSERT IGNORE INTO moderation_reviews (cid, item_key, item_json, reason, status, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
+	`, cid, itemKey, string(itemJSON), reason, models.ReviewPending)
+	return err
+}
+
+// GetModerationStatuses 获取用户指定内容的审核状态，返回 item_key -> status
+func GetModerationStatuses(cid string, itemKeys []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(itemKeys))
+	if len(itemKeys) == 0 {
+		return statuses, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(itemKeys)), ",")
+	query := `SELECT item_key, status FROM moderation_reviews WHERE cid = ? AND item_key IN (` + placeholders + `)`
+	args := make([]any, 0, len(itemKeys)+1)
+	args = append(args, cid)
+	for _, key := range itemKeys {
+		args = append(args, key)
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, status string
+		if err := rows.Scan(&key, &status); err == nil {
+			statuses[key] = status
+		}
+	}
+	return statuses, rows.Err()
+}
+
+// ListModerationReviews 按状态获取审核记录，status 为空时返回全部
+func ListModerationReviews(status string, limit int) ([]models.ModerationReview, error) {
+	query := `SELECT id, cid, item_key, item_json, reason, status, created_at, reviewed_at FROM moderation_reviews`
+	args := make([]any, 0, 2)
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.ModerationReview, 0)
+	for rows.Next() {
+		r, err := scanModerationReview(rows)
+		if err == nil {
+			out = append(out, *r)
+		}
+	}
+	return out, rows.Err()
+}
+
+// GetModerationReview 获取单条审核记录
+func GetModerationReview(id int64) (*models.ModerationReview, error) {
+	row := db.DB.QueryRow(`SELECT id, cid, item_key, item_json, reason, status, created_at, reviewed_at FROM moderation_reviews WHERE id = ?`, id)
+	return scanModerationReview(row)
+}
+
+// TransitionModerationReviewStatus 仅当审核状态为 from 时更新为 to，返回是否更新成功
+// 并发审核同一条内容时只有一个请求能更新成功；to 为待审核时清空审核时间
+func TransitionModerationReviewStatus(id int64, from, to string) (bool, error) {
+	res, err := db.DB.Exec(`
+		UPDATE moderation_reviews SET status = ?, reviewed_at = IF(? = ?, NULL, NOW())
+		WHERE id = ? AND status = ?
+	`, to, to, models.ReviewPending, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// scanModerationReview 扫描一行审核记录
+func scanModerationReview(row interface{ Scan(...any) error }) (*models.ModerationReview, error) {
+	r := &models.ModerationReview{}
+	var itemJSON string
+	var reviewedAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.CID, &r.ItemKey, &itemJSON, &r.Reason, &r.Status, &r.CreatedAt, &reviewedAt); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(itemJSON), &r.Item)
+	if reviewedAt.Valid {
+		t := reviewedAt.Time
+		r.ReviewedAt = &t
+	}
+	return r, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"encoding/json"
+)
+
+// =====================
+// 用户推送偏好
+// =====================
+
+const userPreferenceColumns = `cid, opt_out, unsubscribed_topics, unsubscribed_kbs, preferred_channel, updated_at`
+
+// GetUserPreferences 获取用户的推送偏好，没有设置时返回 sql.ErrNoRows
+func GetUserPreferences(cid string) (*models.UserPreferences, error) {
+	row := db.DB.QueryRow(`SELECT `+userPreferenceColumns+` FROM user_preferences WHERE cid = ?`, cid)
+	return scanUserPreferences(row)
+}
+
+// ListUserPreferences 获取全局退订或退订了部分内容的用户的推送偏好
+func ListUserPreferences() ([]models.UserPreferences, error) {
+	rows, err := db.DB.Query(`
+		SELECT ` + userPreferenceColumns + ` FROM user_preferences
+		WHERE opt_out = 1 OR JSON_LENGTH(unsubscribed_topics) > 0 OR JSON_LENGTH(unsubscribed_kbs) > 0
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.UserPreferences, 0)
+	for rows.Next() {
+		p, err := scanUserPreferences(rows)
+		if err == nil {
+			out = append(out, *p)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ListOptedOutCIDs 获取全局退订的用户
+func ListOptedOutCIDs() (map[string]bool, error) {
+	cids, err := queryStrings(`SELECT cid FROM user_preferences WHERE opt_out = 1`)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(cids))
+	for _, cid := range cids {
+		out[cid] = true
+	}
+	return out, nil
+}
+
+// UpsertUserPreferences 保存用户的推送偏好
+func UpsertUserPreferences(p *models.UserPreferences) error {
+	topics, err := json.Marshal(p.UnsubscribedTopics)
+	if err != nil {
+		return err
+	}
+	kbs, err := json.Marshal(p.UnsubscribedKBs)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO user_preferences (cid, opt_out, unsubscribed_topics, unsubscribed_kbs, preferred_channel, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE opt_out = VALUES(opt_out), unsubscribed_topics = VALUES(unsubscribed_topics),
+			unsubscribed_kbs = VALUES(unsubscribed_kbs), preferred_channel = VALUES(preferred_channel), updated_at = NOW()
+	`, p.CID, p.OptOut, string(topics), string(kbs), p.PreferredChannel)
+	return err
+}
+
+// scanUserPreferences 扫描一行推送偏好
+func scanUserPreferences(row interface{ Scan(...any) error }) (*models.UserPreferences, error) {
+	p := &models.UserPreferences{}
+	var topics, kbs string
+	if err := row.Scan(&p.CID, &p.OptOut, &topics, &kbs, &p.PreferredChannel, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(topics), &p.UnsubscribedTopics); err != nil {
+		logger.Warn("解析退订话题失败", "cid", p.CID, "error", err)
+	}
+	if err := json.Unmarshal([]byte(kbs), &p.UnsubscribedKBs); err != nil {
+		logger.Warn("解析退订知识库失败", "cid", p.CID, "error", err)
+	}
+	return p, nil
+}
@@ -5,6 +5,7 @@ import (
 	"ai_push_message/logger"
 	"ai_push_message/models"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
 	"time"
@@ -70,18 +71,109 @@ func UpsertProfile(p *models.UserProfile) error {
 	return err
 }
 
+// UpsertProfileWithHistory 保存用户画像，并在同一事务中追加一条历史版本
+// 用户已删除数据（包括生成画像期间被删除）时回滚并返回 ErrUserSuppressed
+func UpsertProfileWithHistory(p *models.UserProfile, h *models.ProfileHistory) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveProfileWithHistoryTx(tx, p, h); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateProfileWithHistory 锁定用户画像后由 update 计算新画像，在同一事务中保存并追加历史版本，
+// 不会覆盖并发生成的画像。用户还没有画像时返回 sql.ErrNoRows，已删除数据时返回 ErrUserSuppressed
+func UpdateProfileWithHistory(cid string, h *models.ProfileHistory, update func(*models.UserProfile) (*models.UserProfile, error)) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing := &models.UserProfile{}
+	if err := tx.QueryRow(`SELECT cid, profile_json, keywords, updated_at FROM user_profiles WHERE cid = ? FOR UPDATE`, cid).
+		Scan(&existing.CID, &existing.ProfileRaw, &existing.Keywords, &existing.UpdatedAt); err != nil {
+		return err
+	}
+	updated, err := update(existing)
+	if err != nil {
+		return err
+	}
+	if err := saveProfileWithHistoryTx(tx, updated, h); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveProfileWithHistoryTx 在事务中保存用户画像并追加一条历史版本，用户已删除数据时返回 ErrUserSuppressed
+func saveProfileWithHistoryTx(tx *sql.Tx, p *models.UserProfile, h *models.ProfileHistory) error {
+	if _, err := tx.Exec(`
+        INSERT INTO user_profiles (cid, profile_json, keywords, updated_at, created_at)
+        VALUES (?, ?, ?, NOW(), NOW())
+        ON DUPLICATE KEY UPDATE profile_json=VALUES(profile_json), keywords=VALUES(keywords), updated_at=NOW()
+    `, p.CID, p.ProfileRaw, p.Keywords); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_profile_history (cid, profile_json, keywords, source, model, prompt_version, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+	`, p.CID, p.ProfileRaw, p.Keywords, h.Source, h.Model, h.PromptVersion); err != nil {
+		return err
+	}
+	return ensureNotSuppressedTx(tx, p.CID)
+}
+
+// ListProfileKeywords 获取所有用户画像的关键词列表，返回 cid -> 关键词
+func ListProfileKeywords() (map[string][]string, error) {
+	rows, err := db.DB.Query(`SELECT cid, keywords FROM user_profiles WHERE keywords IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]string)
+	for rows.Next() {
+		var cid, keywordsJSON string
+		if err := rows.Scan(&cid, &keywordsJSON); err != nil {
+			continue
+		}
+		var keywords []string
+		if err := json.Unmarshal([]byte(keywordsJSON), &keywords); err != nil {
+			continue
+		}
+		if len(keywords) > 0 {
+			result[cid] = keywords
+		}
+	}
+	return result, nil
+}
+
 // =====================
 // 候选用户列表
 // =====================
 
 // ListCandidateCIDs returns user CIDs for profile generation
+// 已删除数据的用户不会被返回
 func ListCandidateCIDs(lookbackDays int) ([]string, error) {
 	cids := make([]string, 0)
+
+	// 无法确认哪些用户已删除数据时不返回候选用户，避免重新生成其画像
+	suppressed, err := ListSuppressedCIDs()
+	if err != nil {
+		return nil, err
+	}
 	seen := make(map[string]bool)
 
 	localQueries := []string{
 		`SELECT DISTINCT sender_id AS cid FROM group_chat_messages WHERE sender_id IS NOT NULL AND sender_id != ''`,
 		`SELECT DISTINCT cid FROM user_community_posting_record WHERE cid IS NOT NULL AND cid != ''`,
+		`SELECT DISTINCT user_id AS cid FROM session_messages WHERE role = 'user' AND user_id != ''`,
+		`SELECT DISTINCT cid FROM user_join_exit_group_record WHERE cid IS NOT NULL AND cid != ''`,
 	}
 
 	for _, query := range localQueries {
@@ -97,7 +189,7 @@ func ListCandidateCIDs(lookbackDays int) ([]string, error) {
 				continue
 			}
 			cid = strings.TrimSpace(cid)
-			if cid != "" && !seen[cid] {
+			if cid != "" && !seen[cid] && !suppressed[cid] {
 				cids = append(cids, cid)
 				seen[cid] = true
 			}
@@ -202,35 +294,51 @@ func HasNewerDataThan(cid string, lastUpdateTime time.Time) (bool, error) {
 // =====================
 
 type CombinedUserData struct {
-	CID              string
-	CommunityPosts   []string
-	GroupMessages    []string
-	ActiveGroups     []string
-	GroupInterests   []string
-	SenderRole       string
-	MostRecent       time.Time
-	HasCommunityData bool
-	HasGroupData     bool
+	CID                string
+	CommunityPosts     []string
+	CommunityBehaviors []string // 与 CommunityPosts 一一对应的行为类型（behavior_type 原值）
+	ExcludedPosts      int      // 因风险标记被排除的社区帖子数
+	GroupMessages      []string
+	ActiveGroups       []string
+	GroupInterests     []string
+	SenderRole         string
+	MostRecent         time.Time
+	HasCommunityData   bool
+	HasGroupData       bool
+
+	AssistantQuestions []string // 用户向AI助手提出的问题
+	SessionTitles      []string // 提问所在会话的标题
+	HasSessionData     bool
+
+	JoinedGroups      []string // 当前仍在的群组名称（按入群/退群记录计算）
+	HasMembershipData bool     // 上次生成画像后是否有新的入群/退群记录
 }
 
-func GetCombinedUserData(cid string, lookbackDays int, lastTime time.Time) (*CombinedUserData, error) {
+// GetCombinedUserData 聚合用户的社区帖子、群聊消息和AI助手会话
+// excludePost 不为空时，返回 true 的社区帖子（风险标记）不计入用户数据
+func GetCombinedUserData(cid string, lookbackDays int, lastTime time.Time, excludePost func(models.CommunityRisk) bool) (*CombinedUserData, error) {
 	if cid == "" {
 		return nil, errors.New("invalid CID")
 	}
 
 	data := &CombinedUserData{
-		CID:            cid,
-		CommunityPosts: make([]string, 0),
-		GroupMessages:  make([]string, 0),
-		ActiveGroups:   make([]string, 0),
-		GroupInterests: make([]string, 0),
+		CID:                cid,
+		CommunityPosts:     make([]string, 0),
+		CommunityBehaviors: make([]string, 0),
+		GroupMessages:      make([]string, 0),
+		ActiveGroups:       make([]string, 0),
+		GroupInterests:     make([]string, 0),
+
+		AssistantQuestions: make([]string, 0),
+		SessionTitles:      make([]string, 0),
+		JoinedGroups:       make([]string, 0),
 	}
 
 	// -----------------------
 	// 社区帖子
 	// -----------------------
 	// 使用参数化查询避免SQL注入
-	queryCommunity := `SELECT a.article_text 
+	queryCommunity := `SELECT a.article_text, b.behavior_type, a.law, a.politics, a.ad, a.score
 		 FROM simi_community_history a
 		 JOIN user_community_posting_record b ON a.article_id = b.article_id
 		 WHERE b.cid = ? 
@@ -249,16 +357,24 @@ func GetCombinedUserData(cid string, lookbackDays int, lastTime time.Time) (*Com
 		}
 	}()
 
-	posts := make([]string, 0)
+	posts, behaviors := make([]string, 0), make([]string, 0)
 	for rows.Next() {
 		var text string
-		if err := rows.Scan(&text); err == nil && text != "" {
+		var behavior, law, politics, ad, score sql.NullString
+		if err := rows.Scan(&text, &behavior, &law, &politics, &ad, &score); err == nil && text != "" {
+			risk := models.CommunityRisk{Law: law.String, Politics: politics.String, Ad: ad.String, Score: score.String}
+			if excludePost != nil && excludePost(risk) {
+				data.ExcludedPosts++
+				continue
+			}
 			posts = append(posts, strings.TrimSpace(text))
+			behaviors = append(behaviors, strings.TrimSpace(behavior.String))
 		}
 	}
 
 	if len(posts) > 0 {
 		data.CommunityPosts = posts
+		data.CommunityBehaviors = behaviors
 		data.HasCommunityData = true
 	}
 
@@ -315,5 +431,224 @@ func GetCombinedUserData(cid string, lookbackDays int, lastTime time.Time) (*Com
 		data.HasGroupData = true
 	}
 
+	// -----------------------
+	// AI助手会话
+	// -----------------------
+	// 只取用户自己的提问，助手的回答不代表用户兴趣
+	querySession := `SELECT m.content, s.session_title
+		 FROM session_messages m
+		 LEFT JOIN session_summaries s ON s.session_id = m.session_id
+		 WHERE m.user_id = ?
+		   AND m.role = 'user'
+		   AND m.message_time >= DATE_SUB(NOW(), INTERVAL ? DAY)
+		   AND m.message_time > ?
+		 ORDER BY m.message_time`
+
+	rows, err = db.DB.Query(querySession, cid, lookbackDays, lastTime)
+	if err != nil {
+		logger.Error("Failed to query assistant sessions", "error", err)
+		return data, nil // 返回部分数据而不是错误
+	}
+	defer func() {
+		if rows != nil {
+			rows.Close()
+		}
+	}()
+
+	questions, sessionTitles := make([]string, 0), make([]string, 0)
+	titleSeen := make(map[string]bool)
+	for rows.Next() {
+		var content, title sql.NullString
+		if err := rows.Scan(&content, &title); err == nil {
+			if content.Valid && strings.TrimSpace(content.String) != "" {
+				questions = append(questions, strings.TrimSpace(content.String))
+			}
+			if title.Valid && strings.TrimSpace(title.String) != "" {
+				t := strings.TrimSpace(title.String)
+				if !titleSeen[t] {
+					sessionTitles = append(sessionTitles, t)
+					titleSeen[t] = true
+				}
+			}
+		}
+	}
+
+	if len(questions) > 0 {
+		data.AssistantQuestions = questions
+		data.SessionTitles = sessionTitles
+		data.HasSessionData = true
+	}
+
+	// -----------------------
+	// 入群/退群记录
+	// -----------------------
+	// 群成员关系是当前状态，不受回溯天数限制
+	joined, latest, err := getJoinedGroups(cid)
+	if err != nil {
+		logger.Error("Failed to query group membership", "error", err)
+		return data, nil // 返回部分数据而不是错误
+	}
+	data.JoinedGroups = joined
+	data.HasMembershipData = latest.After(lastTime)
+
 	return data, nil
 }
+
+// getJoinedGroups 按入群/退群记录计算用户当前所在的群组，同时返回最近一条记录的时间
+func getJoinedGroups(cid string) ([]string, time.Time, error) {
+	rows, err := db.DB.Query(`
+		SELECT group_id, group_name, operation_type, STR_TO_DATE(time, '%Y-%m-%d %H:%i:%s') AS op_time
+		FROM user_join_exit_group_record
+		WHERE cid = ?
+		ORDER BY op_time`, cid)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var latest time.Time
+	order := make([]string, 0)
+	names := make(map[string]string)
+	member := make(map[string]bool)
+	for rows.Next() {
+		var groupID, groupName, operation sql.NullString
+		var opTime sql.NullTime
+		if err := rows.Scan(&groupID, &groupName, &operation, &opTime); err != nil {
+			continue
+		}
+		id := strings.TrimSpace(groupID.String)
+		if id == "" {
+			id = strings.TrimSpace(groupName.String)
+		}
+		if id == "" {
+			continue
+		}
+		if _, seen := names[id]; !seen {
+			order = append(order, id)
+		}
+		if name := strings.TrimSpace(groupName.String); name != "" {
+			names[id] = name
+		} else if _, ok := names[id]; !ok {
+			names[id] = id
+		}
+		// 按时间顺序处理，最后一条记录决定是否仍在群中
+		member[id] = !isGroupExitOperation(operation.String)
+		if opTime.Valid && opTime.Time.After(latest) {
+			latest = opTime.Time
+		}
+	}
+
+	joined := make([]string, 0, len(order))
+	for _, id := range order {
+		if member[id] {
+			joined = append(joined, names[id])
+		}
+	}
+	return joined, latest, rows.Err()
+}
+
+// isGroupExitOperation 判断 operation_type 是否表示退群（主动退出或被移出）
+func isGroupExitOperation(operation string) bool {
+	op := strings.ToLower(strings.TrimSpace(operation))
+	for _, kw := range []string{"exit", "quit", "leave", "remove", "kick", "退", "踢", "移出"} {
+		if strings.Contains(op, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// =====================
+// 用户画像历史
+// =====================
+
+const profileHistoryColumns = `id, cid, profile_json, keywords, source, model, prompt_version, created_at`
+
+// ListProfileHistory 获取用户的画像历史版本，按时间倒序
+func ListProfileHistory(cid string, limit int) ([]models.ProfileHistory, error) {
+	rows, err := db.DB.Query(`SELECT `+profileHistoryColumns+` FROM user_profile_history WHERE cid = ? ORDER BY id DESC LIMIT ?`, cid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.ProfileHistory, 0)
+	for rows.Next() {
+		h, err := scanProfileHistory(rows)
+		if err == nil {
+			out = append(out, *h)
+		}
+	}
+	return out, rows.Err()
+}
+
+// GetProfileHistory 获取用户的指定画像版本
+func GetProfileHistory(cid string, id int64) (*models.ProfileHistory, error) {
+	row := db.DB.QueryRow(`SELECT `+profileHistoryColumns+` FROM user_profile_history WHERE cid = ? AND id = ?`, cid, id)
+	return scanProfileHistory(row)
+}
+
+// GetLatestProfileHistory 获取用户最新的画像版本
+func GetLatestProfileHistory(cid string) (*models.ProfileHistory, error) {
+	row := db.DB.QueryRow(`SELECT `+profileHistoryColumns+` FROM user_profile_history WHERE cid = ? ORDER BY id DESC LIMIT 1`, cid)
+	return scanProfileHistory(row)
+}
+
+// GetPreviousProfileHistory 获取指定版本之前的一个画像版本
+func GetPreviousProfileHistory(cid string, id int64) (*models.ProfileHistory, error) {
+	row := db.DB.QueryRow(`SELECT `+profileHistoryColumns+` FROM user_profile_history WHERE cid = ? AND id < ? ORDER BY id DESC LIMIT 1`, cid, id)
+	return scanProfileHistory(row)
+}
+
+// scanProfileHistory 扫描一行画像历史
+func scanProfileHistory(row interface{ Scan(...any) error }) (*models.ProfileHistory, error) {
+	h := &models.ProfileHistory{}
+	if err := row.Scan(&h.ID, &h.CID, &h.ProfileRaw, &h.Keywords, &h.Source, &h.Model, &h.PromptVersion, &h.CreatedAt); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// =====================
+// 用户画像覆盖设置
+// =====================
+
+// GetProfileOverrides 获取用户的画像覆盖设置，没有设置时返回 sql.ErrNoRows
+func GetProfileOverrides(cid string) (*models.ProfileOverrides, error) {
+	row := db.DB.QueryRow(`
+		SELECT cid, pinned_keywords, blocked_keywords, user_type, activity_level, updated_at
+		FROM user_profile_overrides WHERE cid = ?
+	`, cid)
+
+	o := &models.ProfileOverrides{}
+	var pinned, blocked string
+	if err := row.Scan(&o.CID, &pinned, &blocked, &o.UserType, &o.ActivityLevel, &o.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(pinned), &o.PinnedKeywords); err != nil {
+		logger.Warn("解析固定关键词失败", "cid", cid, "error", err)
+	}
+	if err := json.Unmarshal([]byte(blocked), &o.BlockedKeywords); err != nil {
+		logger.Warn("解析屏蔽关键词失败", "cid", cid, "error", err)
+	}
+	return o, nil
+}
+
+// UpsertProfileOverrides 保存用户的画像覆盖设置
+func UpsertProfileOverrides(o *models.ProfileOverrides) error {
+	pinned, err := json.Marshal(o.PinnedKeywords)
+	if err != nil {
+		return err
+	}
+	blocked, err := json.Marshal(o.BlockedKeywords)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO user_profile_overrides (cid, pinned_keywords, blocked_keywords, user_type, activity_level, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE pinned_keywords = VALUES(pinned_keywords), blocked_keywords = VALUES(blocked_keywords),
+			user_type = VALUES(user_type), activity_level = VALUES(activity_level), updated_at = NOW()
+	`, o.CID, string(pinned), string(blocked), o.UserType, o.ActivityLevel)
+	return err
+}
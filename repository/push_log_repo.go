@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// =====================
+// 推送记录
+// =====================
+
+// InsertPushLogs 记录推送给用户的内容，keys 与 items 一一对应
+func InsertPushLogs(cid string, keys []string, items []models.RecommendationItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("(?, ?, ?, NOW()),", len(items)), ",")
+	args := make([]any, 0, len(items)*3)
+	for i, item := range items {
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		args = append(args, cid, keys[i], string(itemJSON))
+	}
+	_, err := db.DB.Exec(`INSERT INTO push_logs (cid, item_key, item_json, created_at) VALUES `+placeholders, args...)
+	return err
+}
+
+// ListPushLogs 获取一批用户在 since 之后收到的推送内容
+func ListPushLogs(cids []string, since time.Time) ([]models.PushLog, error) {
+	out := make([]models.PushLog, 0)
+	if len(cids) == 0 {
+		return out, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(cids)), ",")
+	args := make([]any, 0, len(cids)+1)
+	for _, cid := range cids {
+		args = append(args, cid)
+	}
+	args = append(args, since)
+
+	rows, err := db.DB.Query(`
+		SELECT id, cid, item_key, item_json, created_at FROM push_logs
+		WHERE cid IN (`+placeholders+`) AND created_at >= ?
+		ORDER BY created_at DESC, id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.PushLog
+		var itemJSON string
+		if err := rows.Scan(&l.ID, &l.CID, &l.ItemKey, &itemJSON, &l.CreatedAt); err != nil {
+			continue
+		}
+		if err := json.Unmarshal([]byte(itemJSON), &l.Item); err != nil {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// ListPushedItemKeys 获取用户在 since 之后收到的推送内容标识
+func ListPushedItemKeys(cid string, since time.Time) (map[string]bool, error) {
+	keys, err := queryStrings(`SELECT DISTINCT item_key FROM push_logs WHERE cid = ? AND created_at >= ?`, cid, since)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		out[key] = true
+	}
+	return out, nil
+}
+
+// =====================
+// 推送内容反馈
+// =====================
+
+// InsertItemFeedback 记录用户对推送内容的反馈，相同反馈已存在时只更新时间
+func InsertItemFeedback(cid, itemKey, action string) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO item_feedback (cid, item_key, action, created_at)
+		VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE created_at = NOW()
+	`, cid, itemKey, action)
+	return err
+}
+
+// ListFeedbackItemKeys 获取一批用户在 since 之后的指定反馈，返回 cid -> 内容标识集合
+func ListFeedbackItemKeys(cids []string, action string, since time.Time) (map[string]map[string]bool, error) {
+	out := make(map[string]map[string]bool)
+	if len(cids) == 0 {
+		return out, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(cids)), ",")
+	args := make([]any, 0, len(cids)+2)
+	for _, cid := range cids {
+		args = append(args, cid)
+	}
+	args = append(args, action, since)
+
+	rows, err := db.DB.Query(`
+		SELECT cid, item_key FROM item_feedback
+		WHERE cid IN (`+placeholders+`) AND action = ? AND created_at >= ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, key string
+		if err := rows.Scan(&cid, &key); err != nil {
+			continue
+		}
+		if out[cid] == nil {
+			out[cid] = make(map[string]bool)
+		}
+		out[cid][key] = true
+	}
+	return out, rows.Err()
+}
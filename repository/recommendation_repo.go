@@ -3,10 +3,12 @@ package repository
 import (
 	"ai_push_message/db"
 	"ai_push_message/models"
+	"database/sql"
 	"encoding/json"
 	"strings"
 )
 
+// SaveRecommendationCache 保存用户推荐缓存，用户已删除数据（包括生成期间被删除）时回滚并返回 ErrUserSuppressed
 func SaveRecommendationCache(cid string, items []models.RecommendationItem, algo string, userProfile *models.UserProfile) error {
 	b, _ := json.Marshal(map[string]any{"recommendations": items})
 
@@ -18,16 +20,22 @@ func SaveRecommendationCache(cid string, items []models.RecommendationItem, algo
 		}
 	}
 
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// 检查是否已存在推荐内容
 	var count int
-	err := db.DB.QueryRow(`SELECT COUNT(*) FROM recommendation_cache WHERE cid = ?`, cid).Scan(&count)
+	err = tx.QueryRow(`SELECT COUNT(*) FROM recommendation_cache WHERE cid = ?`, cid).Scan(&count)
 	if err != nil {
 		return err
 	}
 
 	if count > 0 {
 		// 更新现有记录，同时更新用户画像信息
-		_, err = db.DB.Exec(`
+		_, err = tx.Exec(`
 			UPDATE recommendation_cache 
 			SET recommendations = CAST(? AS JSON), 
 				user_profile = CASE WHEN ? != '' THEN CAST(? AS JSON) ELSE user_profile END,
@@ -37,13 +45,20 @@ func SaveRecommendationCache(cid string, items []models.RecommendationItem, algo
 		`, string(b), userProfileJSON, userProfileJSON, algo, cid)
 	} else {
 		// 插入新记录，包含用户画像信息
-		_, err = db.DB.Exec(`
+		_, err = tx.Exec(`
 			INSERT INTO recommendation_cache (cid, recommendations, user_profile, algorithm, generated_at, pushed)
 			VALUES (?, CAST(? AS JSON), CASE WHEN ? != '' THEN CAST(? AS JSON) ELSE NULL END, ?, NOW(), 0)
 		`, cid, string(b), userProfileJSON, userProfileJSON, algo)
 	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	// 用户已删除数据时回滚，不留下推荐缓存
+	if err := ensureNotSuppressedTx(tx, cid); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func MarkPushed(cid string) error {
@@ -56,6 +71,54 @@ func SaveRecommendations(cid string, items []models.RecommendationItem, userProf
 	return SaveRecommendationCache(cid, items, "profile_based", userProfile)
 }
 
+// RemoveRecommendationItems 从用户的推荐缓存中移除 remove 返回 true 的推荐项，返回移除的条目数
+// 在同一事务中锁定缓存行后读取和写回，不会覆盖并发重新生成的推荐内容；不改变生成时间和推送状态，
+// 全部移除时删除该缓存，由热门话题群发处理
+func RemoveRecommendationItems(cid string, remove func(models.RecommendationItem) bool) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var recommendationsJSON string
+	err = tx.QueryRow(`SELECT recommendations FROM recommendation_cache WHERE cid = ? FOR UPDATE`, cid).Scan(&recommendationsJSON)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var recData struct {
+		Recommendations []models.RecommendationItem `json:"recommendations"`
+	}
+	if err := json.Unmarshal([]byte(recommendationsJSON), &recData); err != nil {
+		return 0, err
+	}
+	kept := make([]models.RecommendationItem, 0, len(recData.Recommendations))
+	for _, item := range recData.Recommendations {
+		if !remove(item) {
+			kept = append(kept, item)
+		}
+	}
+	removed := len(recData.Recommendations) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if len(kept) == 0 {
+		_, err = tx.Exec(`DELETE FROM recommendation_cache WHERE cid = ?`, cid)
+	} else {
+		b, _ := json.Marshal(map[string]any{"recommendations": kept})
+		_, err = tx.Exec(`UPDATE recommendation_cache SET recommendations = CAST(? AS JSON) WHERE cid = ?`, string(b), cid)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return removed, tx.Commit()
+}
+
 // GetRecommendations 获取用户推荐内容
 func GetRecommendations(cid string) ([]models.RecommendationItem, error) {
 	var recommendationsJSON string
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// segmentMemberBatchSize 批量写入分群成员时每条语句的行数
+const segmentMemberBatchSize = 500
+
+// =====================
+// 用户分群
+// =====================
+
+// ListProfilesAfter 按 cid 顺序获取 afterCID 之后的一页用户画像，用于分批计算分群
+func ListProfilesAfter(afterCID string, limit int) ([]models.UserProfile, error) {
+	rows, err := db.DB.Query(`SELECT cid, profile_json, keywords, updated_at FROM user_profiles WHERE cid > ? ORDER BY cid LIMIT ?`, afterCID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.UserProfile, 0)
+	for rows.Next() {
+		var p models.UserProfile
+		if err := rows.Scan(&p.CID, &p.ProfileRaw, &p.Keywords, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListSegments 获取全部分群
+func ListSegments() ([]models.Segment, error) {
+	rows, err := db.DB.Query(`SELECT id, name, description, rules_json, member_count, refreshed_at, created_at, updated_at FROM user_segments ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.Segment, 0)
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err == nil {
+			out = append(out, *s)
+		}
+	}
+	return out, rows.Err()
+}
+
+// GetSegment 获取单个分群
+func GetSegment(id int64) (*models.Segment, error) {
+	row := db.DB.QueryRow(`SELECT id, name, description, rules_json, member_count, refreshed_at, created_at, updated_at FROM user_segments WHERE id = ?`, id)
+	return scanSegment(row)
+}
+
+// UpsertSegment 按名称保存分群，返回分群ID
+func UpsertSegment(s *models.Segment) (int64, error) {
+	rulesJSON, err := json.Marshal(s.Rules)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.DB.Exec(`
+		INSERT INTO user_segments (name, description, rules_json, created_at, updated_at)
+		VALUES (?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE description = VALUES(description), rules_json = VALUES(rules_json), updated_at = NOW()
+	`, s.Name, s.Description, string(rulesJSON)); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = db.DB.QueryRow(`SELECT id FROM user_segments WHERE name = ?`, s.Name).Scan(&id)
+	return id, err
+}
+
+// DeleteSegment 删除分群及其成员，分群不存在时返回 sql.ErrNoRows
+func DeleteSegment(id int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM user_segments WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`DELETE FROM user_segment_members WHERE segment_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceSegmentMembers 用新计算的成员替换分群的全部成员，并更新成员数和计算时间
+func ReplaceSegmentMembers(id int64, cids []string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_segment_members WHERE segment_id = ?`, id); err != nil {
+		return err
+	}
+	for start := 0; start < len(cids); start += segmentMemberBatchSize {
+		end := min(start+segmentMemberBatchSize, len(cids))
+		batch := cids[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?, NOW()),", len(batch)), ",")
+		args := make([]any, 0, len(batch)*2)
+		for _, cid := range batch {
+			args = append(args, id, cid)
+		}
+		if _, err := tx.Exec(`INSERT INTO user_segment_members (segment_id, cid, created_at) VALUES `+placeholders, args...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE user_segments SET member_count = ?, refreshed_at = NOW() WHERE id = ?`, len(cids), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListSegmentMembers 分页获取分群成员的 cid
+func ListSegmentMembers(id int64, limit, offset int) ([]string, error) {
+	return queryStrings(`SELECT cid FROM user_segment_members WHERE segment_id = ? ORDER BY cid LIMIT ? OFFSET ?`, id, limit, offset)
+}
+
+// scanSegment 扫描一行分群记录
+func scanSegment(row interface{ Scan(...any) error }) (*models.Segment, error) {
+	s := &models.Segment{}
+	var rulesJSON string
+	var refreshedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.Name, &s.Description, &rulesJSON, &s.MemberCount, &refreshedAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rulesJSON), &s.Rules); err != nil {
+		return nil, err
+	}
+	if refreshedAt.Valid {
+		t := refreshedAt.Time
+		s.RefreshedAt = &t
+	}
+	return s, nil
+}
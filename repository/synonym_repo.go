@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"database/sql"
+)
+
+// =====================
+// 同义词词典
+// =====================
+
+// ListSynonyms 获取词典中的全部同义词映射
+func ListSynonyms() ([]models.KeywordSynonym, error) {
+	rows, err := db.DB.Query(`SELECT id, canonical, synonym, updated_at FROM keyword_synonyms ORDER BY canonical, synonym`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.KeywordSynonym, 0)
+	for rows.Next() {
+		var s models.KeywordSynonym
+		if err := rows.Scan(&s.ID, &s.Canonical, &s.Synonym, &s.UpdatedAt); err == nil {
+			out = append(out, s)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ReplaceSynonymGroup 用给定的同义词替换规范词下的全部同义词
+// 同义词已属于其他规范词时改为归属当前规范词
+func ReplaceSynonymGroup(canonical string, synonyms []string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM keyword_synonyms WHERE canonical = ?`, canonical); err != nil {
+		return err
+	}
+	for _, synonym := range synonyms {
+		if _, err := tx.Exec(`
+			INSERT INTO keyword_synonyms (canonical, synonym, created_at, updated_at)
+			VALUES (?, ?, NOW(), NOW())
+			ON DUPLICATE KEY UPDATE canonical = VALUES(canonical), updated_at = NOW()
+		`, canonical, synonym); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddSynonym 添加单个同义词映射
+func AddSynonym(canonical, synonym string) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO keyword_synonyms (canonical, synonym, created_at, updated_at)
+		VALUES (?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE canonical = VALUES(canonical), updated_at = NOW()
+	`, canonical, synonym)
+	return err
+}
+
+// DeleteSynonymGroup 删除规范词下的全部同义词，返回删除的条数
+func DeleteSynonymGroup(canonical string) (int64, error) {
+	res, err := db.DB.Exec(`DELETE FROM keyword_synonyms WHERE canonical = ?`, canonical)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// =====================
+// 同义词建议审核队列
+// =====================
+
+// InsertSynonymSuggestion 写入待审核的同义词建议，已存在相同建议时忽略，返回是否新写入
+func InsertSynonymSuggestion(canonical, synonym, source string) (bool, error) {
+	res, err := db.DB.Exec(`
+		INSERT IGNORE INTO keyword_synonym_suggestions (canonical, synonym, source, status, created_at)
+		VALUES (?, ?, ?, ?, NOW())
+	`, canonical, synonym, source, models.SuggestionPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListSynonymSuggestions 按状态获取同义词建议，status 为空时返回全部
+func ListSynonymSuggestions(status string, limit int) ([]models.SynonymSuggestion, error) {
+	query := `SELECT id, canonical, synonym, source, status, created_at, reviewed_at FROM keyword_synonym_suggestions`
+	args := make([]any, 0, 2)
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.SynonymSuggestion, 0)
+	for rows.Next() {
+		s, err := scanSynonymSuggestion(rows)
+		if err == nil {
+			out = append(out, *s)
+		}
+	}
+	return out, rows.Err()
+}
+
+// GetSynonymSuggestion 获取单条同义词建议
+func GetSynonymSuggestion(id int64) (*models.SynonymSuggestion, error) {
+	row := db.DB.QueryRow(`SELECT id, canonical, synonym, source, status, created_at, reviewed_at FROM keyword_synonym_suggestions WHERE id = ?`, id)
+	return scanSynonymSuggestion(row)
+}
+
+// UpdateSynonymSuggestionStatus 更新建议的审核状态
+func UpdateSynonymSuggestionStatus(id int64, status string) error {
+	_, err := db.DB.Exec(`UPDATE keyword_synonym_suggestions SET status = ?, reviewed_at = NOW() WHERE id = ?`, status, id)
+	return err
+}
+
+// scanSynonymSuggestion 扫描一行同义词建议
+func scanSynonymSuggestion(row interface{ Scan(...any) error }) (*models.SynonymSuggestion, error) {
+	s := &models.SynonymSuggestion{}
+	var reviewedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.Canonical, &s.Synonym, &s.Source, &s.Status, &s.CreatedAt, &reviewedAt); err != nil {
+		return nil, err
+	}
+	if reviewedAt.Valid {
+		t := reviewedAt.Time
+		s.ReviewedAt = &t
+	}
+	return s, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"ai_push_message/db"
+	"ai_push_message/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrUserSuppressed 用户已删除全部数据，不再为其生成或保存数据
+var ErrUserSuppressed = errors.New("用户数据已删除，禁止重新生成")
+
+// userDataTables 按 cid 保存的衍生数据表，删除用户数据时全部清除
+// 群聊消息、社区发帖等源数据表由上游系统维护，不在此删除；
+// 推送偏好保留，避免用户删除数据后重新收到已退订的推送
+var userDataTables = []string{
+	"user_profiles",
+	"user_profile_history",
+	"user_profile_overrides",
+	"recommendation_cache",
+	"push_logs",
+	"item_feedback",
+	"user_segment_members",
+	"moderation_reviews",
+	"pipeline_checkpoints",
+}
+
+// =====================
+// 用户数据删除
+// =====================
+
+// DeleteUserData 在同一事务中删除用户的全部衍生数据，并写入禁止重新生成的记录
+// 返回 表名 -> 删除的行数
+func DeleteUserData(cid, reason string) (map[string]int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make(map[string]int64, len(userDataTables))
+	for _, table := range userDataTables {
+		res, err := tx.Exec(`DELETE FROM `+table+` WHERE cid = ?`, cid)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := res.RowsAffected()
+		deleted[table] = n
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_suppressions (cid, reason, created_at)
+		VALUES (?, ?, NOW())
+		ON DUPLICATE KEY UPDATE reason = VALUES(reason), created_at = NOW()
+	`, cid, reason); err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+// GetUserSuppression 获取用户的禁止记录，没有记录时返回 sql.ErrNoRows
+func GetUserSuppression(cid string) (*models.UserSuppression, error) {
+	s := &models.UserSuppression{}
+	err := db.DB.QueryRow(`SELECT cid, reason, created_at FROM user_suppressions WHERE cid = ?`, cid).Scan(&s.CID, &s.Reason, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// IsUserSuppressed 用户是否已删除数据、禁止重新生成
+func IsUserSuppressed(cid string) (bool, error) {
+	return exists(`SELECT COUNT(1) FROM user_suppressions WHERE cid = ?`, cid)
+}
+
+// ListSuppressedCIDs 获取全部禁止重新生成的用户
+func ListSuppressedCIDs() (map[string]bool, error) {
+	cids, err := queryStrings(`SELECT cid FROM user_suppressions`)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(cids))
+	for _, cid := range cids {
+		out[cid] = true
+	}
+	return out, nil
+}
+
+// =====================
+// 用户数据导出
+// =====================
+
+// ListAllProfileHistory 获取用户的全部画像历史版本，按时间倒序
+func ListAllProfileHistory(cid string) ([]models.ProfileHistory, error) {
+	rows, err := db.DB.Query(`SELECT `+profileHistoryColumns+` FROM user_profile_history WHERE cid = ? ORDER BY id DESC`, cid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.ProfileHistory, 0)
+	for rows.Next() {
+		h, err := scanProfileHistory(rows)
+		if err == nil {
+			out = append(out, *h)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ListUserPushLogs 获取用户的全部推送记录，按时间倒序
+func ListUserPushLogs(cid string) ([]models.PushLog, error) {
+	return ListPushLogs([]string{cid}, time.Time{})
+}
+
+// ListUserFeedback 获取用户的全部反馈
+func ListUserFeedback(cid string) ([]models.ItemFeedback, error) {
+	rows, err := db.DB.Query(`SELECT cid, item_key, action, created_at FROM item_feedback WHERE cid = ? ORDER BY created_at DESC`, cid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.ItemFeedback, 0)
+	for rows.Next() {
+		var f models.ItemFeedback
+		if err := rows.Scan(&f.CID, &f.ItemKey, &f.Action, &f.CreatedAt); err == nil {
+			out = append(out, f)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ListUserSegmentNames 获取用户所属的分群名称
+func ListUserSegmentNames(cid string) ([]string, error) {
+	return queryStrings(`
+		SELECT s.name FROM user_segment_members m
+		JOIN user_segments s ON s.id = m.segment_id
+		WHERE m.cid = ? ORDER BY s.name
+	`, cid)
+}
+
+// ListUserModerationReviews 获取推送给用户的内容的审核记录
+func ListUserModerationReviews(cid string) ([]models.ModerationReview, error) {
+	rows, err := db.DB.Query(`SELECT id, cid, item_key, item_json, reason, status, created_at, reviewed_at FROM moderation_reviews WHERE cid = ? ORDER BY created_at DESC, id DESC`, cid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.ModerationReview, 0)
+	for rows.Next() {
+		r, err := scanModerationReview(rows)
+		if err == nil {
+			out = append(out, *r)
+		}
+	}
+	return out, rows.Err()
+}
+
+// ensureNotSuppressedTx 在事务中以加锁读确认用户没有删除数据，已删除时返回 ErrUserSuppressed
+// 加锁读会等待并发的删除事务提交并读到其最新结果，在事务中写入用户数据后调用，删除请求之后不会残留数据
+func ensureNotSuppressedTx(tx *sql.Tx, cid string) error {
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM user_suppressions WHERE cid = ? LOCK IN SHARE MODE`, cid).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrUserSuppressed
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "time/tzdata" // 内置时区数据库，容器内缺少 zoneinfo 时也能加载时区
+)
+
+// cronField 单个字段的取值范围和可用名称
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = cronField{name: "分钟", min: 0, max: 59}
+	hourField   = cronField{name: "小时", min: 0, max: 23}
+	domField    = cronField{name: "日", min: 1, max: 31}
+	monthField  = cronField{name: "月", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 星期允许0-7，0和7都表示周日
+	dowField = cronField{name: "星期", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cronMacros 常用的预定义表达式
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule 解析后的cron表达式
+// 标准5段格式：分 时 日 月 周；另支持 @daily 等预定义表达式和 @every <间隔>
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和星期字段是否以*开头；两者都有限制时满足任一即可（与Vixie cron一致）
+	domStar, dowStar bool
+	// every 不为0时表示固定间隔执行，忽略其他字段；执行时间按间隔对齐，多个实例的调度时间点一致
+	every time.Duration
+}
+
+// parseCron 解析cron表达式
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("cron表达式为空")
+	}
+
+	if strings.HasPrefix(expr, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("无效的执行间隔 %q: %w", expr, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("执行间隔不能小于1秒: %q", expr)
+		}
+		return &cronSchedule{every: every}, nil
+	}
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式需要5个字段（分 时 日 月 周），实际为%d个: %q", len(fields), expr)
+	}
+
+	s := &cronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 与 0 都表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField 解析单个字段，支持 *、列表(,)、范围(-)、步长(/)和名称
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s字段的步长无效: %q", field.name, part)
+			}
+			rangeExpr, step = part[:i], n
+		}
+
+		var lo, hi int
+		switch {
+		case rangeExpr == "*":
+			lo, hi = field.min, field.max
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], field); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s字段的范围无效: %q", field.name, part)
+			}
+		default:
+			v, err := parseCronValue(rangeExpr, field)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			// 形如 5/15 表示从5开始每15个单位
+			if step > 1 {
+				hi = field.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue 解析字段中的单个数值或名称
+func parseCronValue(s string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("%s字段的取值无效: %q（范围%d-%d）", field.name, s, field.min, field.max)
+	}
+	return v, nil
+}
+
+// next 返回 t 之后的下一次执行时间，按 t 所在时区计算；5年内没有匹配的时间时返回零值
+// 夏令时开始时，执行时间落在被跳过时段的任务在跳过时段结束时执行（与Vixie cron一致）；
+// 夏令时结束时，重复出现的时段只执行第一次
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(s.every).Add(s.every)
+	}
+
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.matchesSkippedWallClock(t) {
+			return t
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// 按时长前进到下一个整点，不重建墙上时间：夏令时跳过的02:00会被time.Date归一化回01:00
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		// 夏令时结束当天重复出现的时段只执行第一次
+		if s.minute&(1<<uint(t.Minute())) == 0 || wallClockRepeated(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// advance 返回按墙上时间计算出的下一个检查点；夏令时切换在午夜时 time.Date 可能归一化到 t 之前，
+// 此时改为前进到下一个整点，保证每一步都向后推进
+func advance(t, candidate time.Time) time.Time {
+	if candidate.After(t) {
+		return candidate
+	}
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// wallClockRepeated 判断 t 的墙上时间是否在时钟回拨前已经出现过一次
+func wallClockRepeated(t time.Time) bool {
+	_, cur := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= cur {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-cur) * time.Second)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// matchesSkippedWallClock 判断 t 是否为夏令时开始时被跳过时段的结束时刻，
+// 且被跳过的墙上时间中有满足小时和分钟字段的时间
+func (s *cronSchedule) matchesSkippedWallClock(t time.Time) bool {
+	prev := t.Add(-time.Minute)
+	_, cur := t.Zone()
+	_, before := prev.Zone()
+	if cur <= before {
+		return false
+	}
+
+	// 被跳过的墙上时间为 prev 之后的 (cur-before) 分钟，在UTC中按墙上时间逐分钟计算
+	wall := time.Date(prev.Year(), prev.Month(), prev.Day(), prev.Hour(), prev.Minute(), 0, 0, time.UTC)
+	for i := 1; i <= (cur-before)/60; i++ {
+		skipped := wall.Add(time.Duration(i) * time.Minute)
+		if skipped.Day() != t.Day() {
+			continue
+		}
+		if s.hour&(1<<uint(skipped.Hour())) != 0 && s.minute&(1<<uint(skipped.Minute())) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dayMatches 判断日期是否满足日和星期字段
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNextDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("加载时区失败: %v", err)
+	}
+	at := func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, ny)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// 2026-03-08 02:00 EST 跳到 03:00 EDT
+		{"夏令时开始-跨过缺失时段", "0 4 * * *", at(2026, 3, 7, 23, 0), at(2026, 3, 8, 4, 0)},
+		{"夏令时开始-执行时间落在缺失时段", "30 2 * * *", at(2026, 3, 7, 23, 0), at(2026, 3, 8, 3, 0)},
+		{"夏令时开始-缺失时段结束后不重复执行", "30 2 * * *", at(2026, 3, 8, 3, 0), at(2026, 3, 9, 2, 30)},
+		{"夏令时开始-当天不执行的任务", "30 2 * * 1", at(2026, 3, 7, 23, 0), at(2026, 3, 9, 2, 30)},
+		{"夏令时开始-缺失时段之后", "0 3 * * *", at(2026, 3, 8, 0, 0), at(2026, 3, 8, 3, 0)},
+		{"夏令时开始-每小时", "0 * * * *", at(2026, 3, 8, 1, 30), at(2026, 3, 8, 3, 0)},
+		// 2026-11-01 02:00 EDT 回拨到 01:00 EST
+		{"夏令时结束-跨过重复时段", "0 4 * * *", at(2026, 10, 31, 23, 0), at(2026, 11, 1, 4, 0)},
+		{"夏令时结束-重复时段首次执行", "30 1 * * *", at(2026, 10, 31, 23, 0), at(2026, 11, 1, 1, 30)},
+		{"夏令时结束-重复时段不再执行", "30 1 * * *", at(2026, 11, 1, 1, 30), at(2026, 11, 2, 1, 30)},
+		{"夏令时结束-每小时", "0 * * * *", at(2026, 11, 1, 0, 30), at(2026, 11, 1, 1, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("解析 %q 失败: %v", tt.expr, err)
+			}
+			done := make(chan time.Time, 1)
+			go func() { done <- s.next(tt.from) }()
+			select {
+			case got := <-done:
+				if !got.Equal(tt.want) {
+					t.Errorf("next(%v) = %v, 期望 %v", tt.from, got, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("next(%v) 未在2秒内返回", tt.from)
+			}
+		})
+	}
+}
+
+func TestCronNextRepeatedHourFiresOnce(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("加载时区失败: %v", err)
+	}
+	s, err := parseCron("0 * * * *")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	// 01:00 EDT 执行后，01:00 EST 不应再次执行
+	first := time.Date(2026, 11, 1, 1, 0, 0, 0, ny)
+	got := s.next(first)
+	if want := first.Add(2 * time.Hour); !got.Equal(want) {
+		t.Errorf("next(%v) = %v, 期望 %v", first, got, want)
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	bits := func(values ...int) uint64 {
+		var b uint64
+		for _, v := range values {
+			b |= 1 << uint(v)
+		}
+		return b
+	}
+	rangeBits := func(lo, hi, step int) uint64 {
+		var b uint64
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+		return b
+	}
+
+	tests := []struct {
+		expr string
+		want cronSchedule
+	}{
+		{"30 2 * * *", cronSchedule{minute: bits(30), hour: bits(2), dom: rangeBits(1, 31, 1), month: rangeBits(1, 12, 1), dow: rangeBits(0, 7, 1), domStar: true, dowStar: true}},
+		{"0,15,45 9-17 1 * mon-fri", cronSchedule{minute: bits(0, 15, 45), hour: rangeBits(9, 17, 1), dom: bits(1), month: rangeBits(1, 12, 1), dow: rangeBits(1, 5, 1), dowStar: false}},
+		{"*/15 */6 1-10/3 jan,JUL 0", cronSchedule{minute: bits(0, 15, 30, 45), hour: bits(0, 6, 12, 18), dom: bits(1, 4, 7, 10), month: bits(1, 7), dow: bits(0)}},
+		{"5/20 0 * * 7", cronSchedule{minute: bits(5, 25, 45), hour: bits(0), dom: rangeBits(1, 31, 1), month: rangeBits(1, 12, 1), dow: bits(0, 7), domStar: true}},
+		{"@daily", cronSchedule{minute: bits(0), hour: bits(0), dom: rangeBits(1, 31, 1), month: rangeBits(1, 12, 1), dow: rangeBits(0, 7, 1), domStar: true, dowStar: true}},
+		{"@every 90m", cronSchedule{every: 90 * time.Minute}},
+	}
+	for _, tt := range tests {
+		got, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("解析 %q 失败: %v", tt.expr, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parseCron(%q) = %+v，期望 %+v", tt.expr, *got, tt.want)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"10-5 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@weekdays",
+		"@every",
+		"@every abc",
+		"@every 500ms",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCronNextFieldsAndEvery(t *testing.T) {
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatalf("加载时区失败: %v", err)
+	}
+	at := func(m time.Month, d, h, min int) time.Time {
+		return time.Date(2026, m, d, h, min, 0, 0, sh)
+	}
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", at(1, 1, 10, 7), at(1, 1, 10, 15)},
+		{"0 9-17/4 * * *", at(1, 1, 14, 0), at(1, 1, 17, 0)},
+		{"0 0 1 * *", at(1, 15, 8, 0), at(2, 1, 0, 0)},
+		{"0 8 * * mon", at(1, 1, 9, 0), at(1, 5, 8, 0)}, // 2026-01-01 为周四
+		{"0 8 13 * 5", at(2, 1, 0, 0), at(2, 6, 8, 0)},  // 日和星期都有限制时满足任一即可
+		{"0 0 29 2 *", at(1, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, sh)},
+		{"@daily", at(3, 3, 23, 59), at(3, 4, 0, 0)},
+		{"@every 30m", at(3, 3, 10, 1), at(3, 3, 10, 30)},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", tt.expr, err)
+		}
+		if got := s.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q next(%v) = %v，期望 %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
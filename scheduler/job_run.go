@@ -0,0 +1,324 @@
+package scheduler
+
+import (
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+	"ai_push_message/services"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxRunErrorLength 执行记录中错误信息的最大长度（字符数）
+const maxRunErrorLength = 2000
+
+var (
+	// ErrJobNotResumable 任务不支持恢复执行
+	ErrJobNotResumable = errors.New("该任务不支持恢复执行")
+	// ErrRunNotResumable 执行记录不是可恢复的状态
+	ErrRunNotResumable = errors.New("只能恢复已中断或失败的执行记录")
+	// ErrJobRunning 任务正在本实例执行
+	ErrJobRunning = errors.New("任务正在执行，请等待执行完成")
+)
+
+// current 已启动的调度器，供任务状态接口查询
+var current *Scheduler
+
+// runRecorder 记录一次任务执行中各阶段的耗时和处理数
+type runRecorder struct {
+	runID    int64  // 执行记录ID，为0表示记录写入失败，只在日志中输出
+	instance string // 执行任务的实例，记录被其他实例接管后不再更新
+	stages   []models.JobStage
+}
+
+// completed 阶段是否已在之前的执行中完成，且没有需要重试的失败用户
+// 已完成的阶段中有失败的用户时返回 false，恢复执行时重新执行该阶段，检查点中已完成的用户仍会跳过
+func (r *runRecorder) completed(name string) bool {
+	done := false
+	for i := range r.stages {
+		if r.stages[i].Name == name && r.stages[i].Completed() {
+			done = true
+			break
+		}
+	}
+	if !done || r.runID == 0 {
+		return done
+	}
+
+	hasFailed, err := services.HasFailedCheckpoints(r.runID, name)
+	if err != nil {
+		logger.Warn("获取失败用户的检查点失败，跳过已完成的阶段", "run_id", r.runID, "stage", name, "error", err)
+		return true
+	}
+	return !hasFailed
+}
+
+// checkpoint 加载阶段的检查点，执行记录写入失败时不记录检查点
+func (r *runRecorder) checkpoint(stage string) (*services.RunCheckpoint, error) {
+	if r.runID == 0 {
+		return nil, nil
+	}
+	return services.LoadRunCheckpoint(r.runID, stage)
+}
+
+// stage 执行一个阶段并记录耗时、处理数和错误，每个阶段结束后立即写入执行记录
+func (r *runRecorder) stage(name string, fn func() (models.StageCounts, error)) error {
+	start := time.Now()
+	counts, err := fn()
+
+	stage := models.JobStage{
+		Name:        name,
+		StartedAt:   start,
+		DurationMs:  time.Since(start).Milliseconds(),
+		StageCounts: counts,
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	r.stages = append(r.stages, stage)
+
+	logger.Info("任务阶段完成", "stage", name, "cost_ms", stage.DurationMs,
+		"processed", counts.Processed, "regenerated", counts.Regenerated, "pushed", counts.Pushed, "failed", counts.Failed, "skipped", counts.Skipped)
+
+	if r.runID > 0 {
+		if updateErr := repository.UpdateJobRunStages(r.runID, r.instance, r.stages); updateErr != nil {
+			logger.Warn("更新任务执行记录失败", "run_id", r.runID, "error", updateErr)
+		}
+	}
+	return err
+}
+
+// startRun 写入一条执行中的记录；resume 不为 nil 时继续该记录，保留其中已完成的阶段
+func startRun(job, instance string, resume *models.JobRun) *runRecorder {
+	if resume != nil {
+		if err := repository.ResumeJobRun(resume.ID, instance); err != nil {
+			logger.Error("恢复任务执行记录失败，重新开始执行", "job", job, "run_id", resume.ID, "error", err)
+		} else {
+			stages := make([]models.JobStage, 0, len(resume.Stages))
+			for _, stage := range resume.Stages {
+				if stage.Completed() {
+					stages = append(stages, stage)
+				}
+			}
+			return &runRecorder{runID: resume.ID, instance: instance, stages: stages}
+		}
+	}
+
+	runID, err := repository.InsertJobRun(job, instance)
+	if err != nil {
+		logger.Error("写入任务执行记录失败", "job", job, "error", err)
+	}
+	return &runRecorder{runID: runID, instance: instance, stages: make([]models.JobStage, 0)}
+}
+
+// finishRun 写入任务的执行结果
+func finishRun(job string, rec *runRecorder, start time.Time, runErr error) {
+	if rec.runID == 0 {
+		return
+	}
+
+	run := &models.JobRun{
+		ID:         rec.runID,
+		Job:        job,
+		Instance:   rec.instance,
+		Status:     models.JobRunSucceeded,
+		DurationMs: time.Since(start).Milliseconds(),
+		Stages:     rec.stages,
+	}
+	if runErr != nil {
+		run.Status = models.JobRunFailed
+		run.Error = runErr.Error()
+		if r := []rune(run.Error); len(r) > maxRunErrorLength {
+			run.Error = string(r[:maxRunErrorLength])
+		}
+	}
+	if err := repository.FinishJobRun(run); err != nil {
+		logger.Error("更新任务执行结果失败", "job", job, "run_id", rec.runID, "error", err)
+	}
+}
+
+// ListJobs 获取全部可调度任务的配置、调度状态和最近一次执行记录
+func ListJobs() ([]models.JobInfo, error) {
+	out := make([]models.JobInfo, 0)
+	s := current
+	if s == nil {
+		return out, nil
+	}
+
+	latest, err := repository.ListLatestJobRuns()
+	if err != nil {
+		return nil, err
+	}
+	leases := make(map[string]models.JobLease)
+	if s.cfg.Scheduler.Lock.Enabled {
+		if leases, err = repository.ListJobLeases(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.registered {
+		info := models.JobInfo{Name: job.Name, Description: job.Description}
+		if j, ok := s.jobs[job.Name]; ok {
+			info.Enabled = true
+			info.Cron = j.status.Cron
+			info.Timezone = j.status.Timezone
+			info.IsRunning = j.status.IsRunning
+			if !j.status.NextRun.IsZero() {
+				next := j.status.NextRun
+				info.NextRun = &next
+			}
+		}
+		if run, ok := latest[job.Name]; ok {
+			info.LastRun = &run
+		}
+		if lease, ok := leases[job.Name]; ok {
+			info.Lease = &lease
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// ListJobRuns 按时间倒序获取任务的执行记录，任务不存在时返回 sql.ErrNoRows
+func ListJobRuns(job string, limit, offset int) ([]models.JobRun, error) {
+	if s := current; s != nil && !s.isRegistered(job) {
+		return nil, sql.ErrNoRows
+	}
+	if limit <= 0 {
+		limit = 20 // 默认值
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return repository.ListJobRuns(job, limit, offset)
+}
+
+// resumeWithinHours 自动恢复中断任务的时间范围（小时）
+func (s *Scheduler) resumeWithinHours() int {
+	hours := s.cfg.Scheduler.ResumeWithinHours
+	if hours <= 0 {
+		hours = 12 // 默认值
+	}
+	return hours
+}
+
+// findResumableRun 获取任务最近一次处于给定状态、且在 resume_within_hours 内开始的执行记录，没有时返回 nil
+func (s *Scheduler) findResumableRun(job string, statuses []string) *models.JobRun {
+	run, err := repository.GetResumableJobRun(job, statuses, s.resumeWithinHours())
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logger.Error("获取可恢复的任务执行记录失败，重新开始执行", "job", job, "error", err)
+		}
+		return nil
+	}
+	return run
+}
+
+// resumeInterrupted 启动时在后台恢复上次进程退出时中断的任务
+// 启用租约时中断的记录可能仍为执行中（由崩溃的实例留下），获取租约后才能确定
+func (s *Scheduler) resumeInterrupted() {
+	statuses := []string{models.JobRunInterrupted}
+	if s.cfg.Scheduler.Lock.Enabled {
+		statuses = append(statuses, models.JobRunRunning)
+	}
+
+	for _, j := range s.jobs {
+		if !j.job.Resumable {
+			continue
+		}
+		run := s.findResumableRun(j.job.Name, statuses)
+		if run == nil {
+			continue
+		}
+
+		logger.Info("发现中断的任务，准备恢复执行", "job", j.job.Name, "run_id", run.ID)
+		go func(j *scheduledJob, runID int64) {
+			j.runMu.Lock()
+			defer j.runMu.Unlock()
+			s.resumeRun(j, runID)
+		}(j, run.ID)
+	}
+}
+
+// resumeRun 继续执行中断或失败的记录，跳过已完成的阶段和用户
+func (s *Scheduler) resumeRun(j *scheduledJob, runID int64) {
+	ctx := context.Background()
+	if s.cfg.Scheduler.Lock.Enabled {
+		lease := s.acquireLease(j.job.Name, time.Now())
+		if lease == nil {
+			return
+		}
+		defer lease.release()
+		ctx = lease.ctx
+	}
+
+	// 获取租约后重新读取，等待期间可能已由其他实例恢复执行完成
+	run, err := repository.GetJobRun(runID)
+	if err != nil {
+		logger.Error("获取任务执行记录失败，无法恢复执行", "job", j.job.Name, "run_id", runID, "error", err)
+		return
+	}
+	if run.Status != models.JobRunInterrupted && run.Status != models.JobRunFailed {
+		logger.Info("执行记录无需恢复", "job", j.job.Name, "run_id", runID, "status", run.Status)
+		return
+	}
+	s.runJob(ctx, j, run)
+}
+
+// ResumeJobRun 在后台恢复执行任务的一条中断或失败的记录，跳过已完成的阶段和用户
+// 任务或记录不存在时返回 sql.ErrNoRows
+func ResumeJobRun(job string, runID int64) error {
+	s := current
+	if s == nil {
+		return errors.New("调度器未启动")
+	}
+
+	var registered *Job
+	for i := range s.registered {
+		if s.registered[i].Name == job {
+			registered = &s.registered[i]
+		}
+	}
+	if registered == nil {
+		return sql.ErrNoRows
+	}
+	if !registered.Resumable {
+		return ErrJobNotResumable
+	}
+
+	run, err := repository.GetJobRun(runID)
+	if err != nil {
+		return err
+	}
+	if run.Job != job {
+		return sql.ErrNoRows
+	}
+	// 启用租约时执行中的记录可能由已崩溃的实例留下，获取租约后再确认
+	resumable := run.Status == models.JobRunInterrupted || run.Status == models.JobRunFailed ||
+		(s.cfg.Scheduler.Lock.Enabled && run.Status == models.JobRunRunning)
+	if !resumable {
+		return ErrRunNotResumable
+	}
+
+	// 未启用定时调度的任务也可以手动恢复
+	j, ok := s.jobs[job]
+	if !ok {
+		j = &scheduledJob{job: *registered, status: &JobStatus{Name: job, Description: registered.Description}}
+	}
+	if !j.runMu.TryLock() {
+		return ErrJobRunning
+	}
+
+	go func() {
+		defer j.runMu.Unlock()
+		s.resumeRun(j, runID)
+	}()
+	return nil
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"ai_push_message/logger"
+	"ai_push_message/repository"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errLeaseLost 租约被其他实例接管或长时间续期失败，任务需要停止执行
+var errLeaseLost = errors.New("任务租约已丢失，停止执行")
+
+// jobLease 当前实例持有的任务租约，持有期间定期续期
+// 租约丢失时取消 ctx，任务不再开始处理新的用户，避免与接管的实例同时执行
+type jobLease struct {
+	job    string
+	token  string
+	ttlSec int
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// defaultInstanceID 默认实例标识：主机名-进程号
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// newLeaseToken 生成租约令牌
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// leaseTTLSec 租约有效期（秒）
+func (s *Scheduler) leaseTTLSec() int {
+	ttl := s.cfg.Scheduler.Lock.TTLSec
+	if ttl <= 0 {
+		ttl = 60 // 默认值
+	}
+	// 续期间隔为有效期的1/3，过短会导致续期时数据库中的时间没有变化
+	if ttl < 15 {
+		ttl = 15
+	}
+	return ttl
+}
+
+// acquireLease 获取任务在调度时间点 slot 的租约
+// 其他实例正在执行同一时间点时等待其完成或租约过期；该时间点已由其他实例执行完成或获取失败时返回 nil
+func (s *Scheduler) acquireLease(job string, slot time.Time) *jobLease {
+	ttl := s.leaseTTLSec()
+	pollInterval := time.Duration(ttl) * time.Second / 3
+
+	for {
+		token, err := newLeaseToken()
+		if err != nil {
+			logger.Error("生成任务租约令牌失败，跳过本次执行", "job", job, "error", err)
+			return nil
+		}
+
+		acquired, err := repository.TryAcquireJobLease(job, s.instanceID, token, slot.Unix(), ttl)
+		if err != nil {
+			logger.Error("获取任务租约失败，跳过本次执行", "job", job, "error", err)
+			return nil
+		}
+		if acquired {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			lease := &jobLease{job: job, token: token, ttlSec: ttl, ctx: ctx, cancel: cancel, stop: make(chan struct{}), done: make(chan struct{})}
+			go lease.heartbeat()
+
+			// 持有租约时没有其他实例在执行该任务，之前未结束的执行记录来自已崩溃的实例
+			if n, err := repository.MarkInterruptedJobRuns(job); err != nil {
+				logger.Warn("标记中断的任务执行记录失败", "job", job, "error", err)
+			} else if n > 0 {
+				logger.Warn("接管了已中断的任务", "job", job, "count", n)
+			}
+			return lease
+		}
+
+		current, err := repository.GetJobLease(job)
+		if err != nil {
+			logger.Error("获取任务租约状态失败，跳过本次执行", "job", job, "error", err)
+			return nil
+		}
+		if current.DoneSlot >= slot.Unix() || current.Slot > slot.Unix() {
+			logger.Info("任务已由其他实例执行，跳过本次执行", "job", job, "owner", current.Owner)
+			return nil
+		}
+
+		logger.Debug("任务正由其他实例执行，等待其完成或租约过期", "job", job, "owner", current.Owner)
+		time.Sleep(pollInterval)
+	}
+}
+
+// heartbeat 定期续期租约，直到任务执行完成
+// 租约被其他实例接管，或续期持续失败超过有效期（其他实例可能已接管）时取消任务
+func (l *jobLease) heartbeat() {
+	defer close(l.done)
+
+	ttl := time.Duration(l.ttlSec) * time.Second
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			held, err := repository.RenewJobLease(l.job, l.token, l.ttlSec)
+			if err != nil {
+				if time.Since(renewedAt) < ttl {
+					logger.Warn("任务租约续期失败", "job", l.job, "error", err)
+					continue
+				}
+				logger.Error("任务租约续期持续失败超过有效期，停止执行任务", "job", l.job, "error", err)
+				l.cancel(errLeaseLost)
+				return
+			}
+			if !held {
+				logger.Error("任务租约已过期并被其他实例接管，停止执行任务", "job", l.job)
+				l.cancel(errLeaseLost)
+				return
+			}
+			renewedAt = time.Now()
+		}
+	}
+}
+
+// lost 租约是否已丢失
+func (l *jobLease) lost() bool {
+	return l.ctx.Err() != nil
+}
+
+// release 停止续期并释放租约，该调度时间点标记为已执行完成；租约已丢失时不释放，由接管的实例负责
+func (l *jobLease) release() {
+	close(l.stop)
+	<-l.done
+	defer l.cancel(nil)
+	if l.lost() {
+		return
+	}
+	if err := repository.ReleaseJobLease(l.job, l.token); err != nil {
+		logger.Error("释放任务租约失败", "job", l.job, "error", err)
+	}
+}
@@ -3,18 +3,17 @@ package scheduler
 import (
 	"ai_push_message/config"
 	"ai_push_message/logger"
+	"ai_push_message/models"
 	"ai_push_message/repository"
 	"ai_push_message/services"
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// 将秒数转换为时间间隔
-func secondsToDuration(seconds int) time.Duration {
-	return time.Duration(seconds) * time.Second
-}
-
 // 验证小时和分钟是否有效
 func validateHourMinute(cfg *config.Config, hour, minute int) (int, int) {
 	defaultHour := cfg.Scheduler.DefaultHour
@@ -31,36 +30,54 @@ func validateHourMinute(cfg *config.Config, hour, minute int) (int, int) {
 	return hour, minute
 }
 
-// 计算下一个指定时间点
-func getNextTimePoint(now time.Time, hour, minute int) time.Time {
-	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
-	if next.Before(now) {
-		next = next.Add(24 * time.Hour)
-	}
-	return next
-}
-
-// 任务类型
-type TaskType int
-
+// 任务名称，与配置 scheduler.jobs 中的键对应
 const (
-	TaskPush TaskType = iota
-	TaskProfileGeneration
+	JobPipeline       = "pipeline"       // 完整流程：画像生成 → 推荐生成 → 推送 → 群发
+	JobProfile        = "profile"        // 用户画像生成
+	JobRecommendation = "recommendation" // 推荐内容生成
+	JobPush           = "push"           // 推送用户推荐内容
+	JobBroadcast      = "broadcast"      // 热门话题群发
+	JobCleanup        = "cleanup"        // 过期数据清理
 )
 
+// Job 可调度的任务，Run 通过 runRecorder 记录各阶段的耗时和处理数
+// 启用租约时 ctx 在租约丢失后取消，任务应停止处理新的用户
+type Job struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, rec *runRecorder) error
+	Resumable   bool // 按用户记录检查点，中断后可恢复执行
+}
+
 // 任务状态
-type TaskStatus struct {
+type JobStatus struct {
+	Name        string
+	Description string
+	Cron        string
+	Timezone    string
 	LastRun     time.Time
 	NextRun     time.Time
 	IsRunning   bool
-	Description string
+	LastError   string
+}
+
+// scheduledJob 已启用的任务及其调度计划
+type scheduledJob struct {
+	job      Job
+	schedule *cronSchedule
+	location *time.Location
+	status   *JobStatus
+	// runMu 保证同一任务在本实例内不会同时执行（定时执行与恢复执行之间）
+	runMu sync.Mutex
 }
 
 // 任务调度器
 type Scheduler struct {
 	cfg         *config.Config
 	concurrency int
-	tasks       map[TaskType]*TaskStatus
+	instanceID  string
+	registered  []Job
+	jobs        map[string]*scheduledJob
 	mutex       sync.Mutex
 }
 
@@ -71,10 +88,16 @@ func NewScheduler(cfg *config.Config) *Scheduler {
 		concurrency = 10
 	}
 
+	instanceID := cfg.Scheduler.Lock.InstanceID
+	if instanceID == "" {
+		instanceID = defaultInstanceID()
+	}
+
 	return &Scheduler{
 		cfg:         cfg,
 		concurrency: concurrency,
-		tasks:       make(map[TaskType]*TaskStatus),
+		instanceID:  instanceID,
+		jobs:        make(map[string]*scheduledJob),
 		mutex:       sync.Mutex{},
 	}
 }
@@ -84,163 +107,346 @@ func Start(cfg *config.Config) {
 	scheduler := NewScheduler(cfg)
 
 	// 初始化任务
-	scheduler.initTasks()
-
-	// 启动主循环
-	go scheduler.run()
+	scheduler.initJobs()
+	current = scheduler
+
+	// 上次进程退出时未执行完的任务；启用租约时其他实例可能正在执行，改为获取租约后再标记
+	if !cfg.Scheduler.Lock.Enabled {
+		if n, err := repository.MarkInterruptedJobRuns(""); err != nil {
+			logger.Error("标记中断的任务执行记录失败", "error", err)
+		} else if n > 0 {
+			logger.Warn("上次进程退出时有任务未执行完成", "count", n)
+		}
+	}
 
-	checkInterval := cfg.Scheduler.CheckIntervalSec
-	if checkInterval <= 0 {
-		checkInterval = 60 // 默认值
+	// 每个任务独立调度，同一任务上一次未执行完时不会重复执行
+	for _, j := range scheduler.jobs {
+		go scheduler.runLoop(j)
 	}
-	logger.Info("调度器已启动", "check_interval_sec", checkInterval)
+
+	// 恢复上次进程退出时中断的任务
+	scheduler.resumeInterrupted()
+
+	logger.Info("调度器已启动", "job_count", len(scheduler.jobs), "instance", scheduler.instanceID, "lock_enabled", cfg.Scheduler.Lock.Enabled)
 }
 
-// 初始化任务
-func (s *Scheduler) initTasks() {
-	now := time.Now()
-
-	// 用户画像生成任务 - 根据debug模式决定运行频率
-	if s.cfg.Debug.Enabled {
-		// Debug模式：按配置的秒数间隔生成一次，执行完整流程（画像生成 → 推荐生成 → 推送）
-		freqSeconds := s.cfg.Debug.RecommendationFreq
-		profileInterval := time.Duration(freqSeconds) * time.Second
-		nextProfileRun := now.Add(profileInterval)
-
-		s.tasks[TaskProfileGeneration] = &TaskStatus{
-			LastRun:     now.Add(-profileInterval),
-			NextRun:     nextProfileRun,
-			IsRunning:   false,
-			Description: fmt.Sprintf("完整推荐流程 (Debug模式: 每%d秒)", freqSeconds),
-		}
-		logger.Info("Debug模式已启用", "frequency_seconds", freqSeconds, "workflow", "画像生成 → 推荐生成 → 推送")
-	} else {
-		// 正常模式：每天在指定时间点运行完整流程
-		hour, minute := validateHourMinute(s.cfg, s.cfg.Cron.ProfileHour, s.cfg.Cron.ProfileMin)
-		nextProfileRun := getNextTimePoint(now, hour, minute)
-
-		s.tasks[TaskProfileGeneration] = &TaskStatus{
-			LastRun:     nextProfileRun.Add(-24 * time.Hour),
-			NextRun:     nextProfileRun,
-			IsRunning:   false,
-			Description: fmt.Sprintf("完整推荐流程 (%02d:%02d)", hour, minute),
-		}
-		logger.Info("正常模式", "schedule_time", fmt.Sprintf("%02d:%02d", hour, minute), "workflow", "画像生成 → 推荐生成 → 推送")
+// registry 全部可调度的任务
+func (s *Scheduler) registry() []Job {
+	return []Job{
+		{Name: JobPipeline, Description: "完整推荐流程（画像生成 → 推荐生成 → 推送）", Run: s.runPipeline, Resumable: true},
+		{Name: JobProfile, Description: "用户画像生成", Run: s.runProfileJob},
+		{Name: JobRecommendation, Description: "推荐内容生成", Run: s.runRecommendationJob},
+		{Name: JobPush, Description: "推送用户推荐内容", Run: s.runPushJob},
+		{Name: JobBroadcast, Description: "热门话题群发", Run: s.runBroadcastJob},
+		{Name: JobCleanup, Description: "过期数据清理", Run: s.runCleanupJob},
 	}
-
-	logger.Info("定时任务初始化完成", "task_count", len(s.tasks))
 }
 
-// 主循环
-func (s *Scheduler) run() {
-	checkInterval := s.cfg.Scheduler.CheckIntervalSec
-	if checkInterval <= 0 {
-		checkInterval = 60 // 默认值
+// jobSchedules 获取各任务的调度配置
+// 未配置 pipeline 时沿用原有的调度方式：debug模式按 recommendation_freq 间隔执行，否则每天在 profile_hour:profile_min 执行
+func (s *Scheduler) jobSchedules() map[string]config.JobSchedule {
+	schedules := make(map[string]config.JobSchedule, len(s.cfg.Scheduler.Jobs)+1)
+	for name, sc := range s.cfg.Scheduler.Jobs {
+		schedules[name] = sc
 	}
-	ticker := time.NewTicker(time.Duration(checkInterval) * time.Second)
-	defer ticker.Stop()
 
-	for {
-		select {
-		case now := <-ticker.C:
-			s.checkTasks(now)
+	if _, ok := schedules[JobPipeline]; !ok {
+		if s.cfg.Debug.Enabled {
+			freqSeconds := s.cfg.Debug.RecommendationFreq
+			if freqSeconds <= 0 {
+				freqSeconds = 1800
+			}
+			schedules[JobPipeline] = config.JobSchedule{Cron: fmt.Sprintf("@every %ds", freqSeconds)}
+			logger.Info("Debug模式已启用", "frequency_seconds", freqSeconds, "workflow", "画像生成 → 推荐生成 → 推送")
+		} else {
+			hour, minute := validateHourMinute(s.cfg, s.cfg.Cron.ProfileHour, s.cfg.Cron.ProfileMin)
+			schedules[JobPipeline] = config.JobSchedule{Cron: fmt.Sprintf("%d %d * * *", minute, hour)}
+			logger.Info("正常模式", "schedule_time", fmt.Sprintf("%02d:%02d", hour, minute), "workflow", "画像生成 → 推荐生成 → 推送")
 		}
 	}
+	return schedules
 }
 
-// 检查任务
-func (s *Scheduler) checkTasks(now time.Time) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// 初始化任务
+func (s *Scheduler) initJobs() {
+	schedules := s.jobSchedules()
+	registry := s.registry()
+	s.registered = registry
+
+	known := make(map[string]bool, len(registry))
+	for _, job := range registry {
+		known[job.Name] = true
+	}
+	unknown := make([]string, 0)
+	for name := range schedules {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		logger.Warn("配置中存在未知的定时任务，已忽略", "jobs", unknown)
+	}
 
-	for taskType, status := range s.tasks {
-		// 如果任务正在运行，跳过
-		if status.IsRunning {
+	for _, job := range registry {
+		sc, ok := schedules[job.Name]
+		if !ok || sc.Disabled || strings.TrimSpace(sc.Cron) == "" {
 			continue
 		}
 
-		// 如果任务的NextRun为零值，跳过（表示不需要定期调度）
-		if status.NextRun.IsZero() {
+		schedule, err := parseCron(sc.Cron)
+		if err != nil {
+			logger.Error("无效的cron表达式，跳过该任务", "job", job.Name, "cron", sc.Cron, "error", err)
+			continue
+		}
+		location, err := s.jobLocation(sc.Timezone)
+		if err != nil {
+			logger.Error("无效的时区，跳过该任务", "job", job.Name, "timezone", sc.Timezone, "error", err)
 			continue
 		}
 
-		// 如果到达或超过下次运行时间，执行任务
-		if now.After(status.NextRun) || now.Equal(status.NextRun) {
-			status.IsRunning = true
-			go s.runTask(taskType, now)
+		s.jobs[job.Name] = &scheduledJob{
+			job:      job,
+			schedule: schedule,
+			location: location,
+			status: &JobStatus{
+				Name:        job.Name,
+				Description: job.Description,
+				Cron:        sc.Cron,
+				Timezone:    location.String(),
+			},
 		}
+		logger.Info("已注册定时任务", "job", job.Name, "cron", sc.Cron, "timezone", location.String())
 	}
+
+	logger.Info("定时任务初始化完成", "task_count", len(s.jobs))
 }
 
-// 运行任务
-func (s *Scheduler) runTask(taskType TaskType, now time.Time) {
-	defer func() {
-		s.mutex.Lock()
-		defer s.mutex.Unlock()
-
-		status := s.tasks[taskType]
-		status.IsRunning = false
-		status.LastRun = now
-
-		// 更新下次运行时间
-		switch taskType {
-		case TaskProfileGeneration:
-			if s.cfg.Debug.Enabled {
-				// Debug模式：按配置的秒数间隔
-				freqSeconds := s.cfg.Debug.RecommendationFreq
-				if freqSeconds <= 0 {
-					freqSeconds = 1800
-				}
-				profileInterval := time.Duration(freqSeconds) * time.Second
-				status.NextRun = now.Add(profileInterval)
-			} else {
-				// 正常模式：获取下一个每日时间点
-				hour, minute := validateHourMinute(s.cfg, s.cfg.Cron.ProfileHour, s.cfg.Cron.ProfileMin)
-				status.NextRun = getNextTimePoint(now, hour, minute)
-			}
+// jobLocation 获取任务使用的时区，未配置时使用 scheduler.timezone，仍为空则使用服务器本地时区
+func (s *Scheduler) jobLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		timezone = s.cfg.Scheduler.Timezone
+	}
+	if timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(timezone)
+}
+
+// isRegistered 任务名是否在注册表中
+func (s *Scheduler) isRegistered(name string) bool {
+	for _, job := range s.registered {
+		if job.Name == name {
+			return true
 		}
+	}
+	return false
+}
 
-		logger.Info("任务执行完成", "task", status.Description, "next_run", status.NextRun.Format("2006-01-02 15:04:05"))
-	}()
+// runLoop 按调度计划循环执行任务
+func (s *Scheduler) runLoop(j *scheduledJob) {
+	for {
+		next := j.schedule.next(time.Now().In(j.location))
+		if next.IsZero() {
+			logger.Warn("任务没有下一次执行时间，停止调度", "job", j.job.Name, "cron", j.status.Cron)
+			return
+		}
 
-	logger.Info("开始执行任务", "task", func() string {
 		s.mutex.Lock()
-		defer s.mutex.Unlock()
-		if status, ok := s.tasks[taskType]; ok {
-			return status.Description
+		j.status.NextRun = next
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		<-timer.C
+		s.runScheduled(j, next)
+	}
+}
+
+// runScheduled 执行调度时间点 slot 的任务，启用租约时只有获取到租约的实例执行
+func (s *Scheduler) runScheduled(j *scheduledJob, slot time.Time) {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
+	if !s.cfg.Scheduler.Lock.Enabled {
+		s.runJob(context.Background(), j, nil)
+		return
+	}
+
+	lease := s.acquireLease(j.job.Name, slot)
+	if lease == nil {
+		return
+	}
+	defer lease.release()
+	s.runJob(lease.ctx, j, nil)
+}
+
+// runJob 执行一次任务，更新任务状态并写入执行记录
+// resume 为要继续执行的记录；为 nil 时，支持恢复的任务会继续最近一次在 resume_within_hours 内中断的记录
+func (s *Scheduler) runJob(ctx context.Context, j *scheduledJob, resume *models.JobRun) {
+	if resume == nil && j.job.Resumable {
+		resume = s.findResumableRun(j.job.Name, []string{models.JobRunInterrupted})
+	}
+
+	start := time.Now()
+	s.mutex.Lock()
+	j.status.IsRunning = true
+	j.status.LastRun = start
+	s.mutex.Unlock()
+
+	if resume != nil {
+		logger.Info("恢复执行中断的任务", "job", j.job.Name, "run_id", resume.ID, "started_at", resume.StartedAt)
+	} else {
+		logger.Info("开始执行任务", "job", j.job.Name, "task", j.job.Description)
+	}
+	rec := startRun(j.job.Name, s.instanceID, resume)
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务执行异常: %v", r)
+			}
+		}()
+		return j.job.Run(ctx, rec)
+	}()
+	finishRun(j.job.Name, rec, start, err)
+
+	s.mutex.Lock()
+	j.status.IsRunning = false
+	j.status.LastError = ""
+	if err != nil {
+		j.status.LastError = err.Error()
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		logger.Error("任务执行失败", "job", j.job.Name, "cost", time.Since(start).String(), "error", err)
+		return
+	}
+	logger.Info("任务执行完成", "job", j.job.Name, "cost", time.Since(start).String())
+}
+
+// listCandidateCIDs 获取回溯期内的候选用户
+func (s *Scheduler) listCandidateCIDs() ([]string, error) {
+	cids, err := repository.ListCandidateCIDs(s.cfg.Cron.LookbackDays)
+	if err != nil {
+		return nil, fmt.Errorf("获取候选用户列表失败: %w", err)
+	}
+	logger.Info("找到候选用户", "count", len(cids), "concurrency", s.concurrency)
+	return cids, nil
+}
+
+// generateProfiles 为候选用户生成画像，cp 不为 nil 时跳过已完成的用户
+func (s *Scheduler) generateProfiles(ctx context.Context, cids []string, cp *services.RunCheckpoint) (models.StageCounts, error) {
+	counts := services.GenerateProfilesWithCheckpoint(ctx, s.cfg, cids, s.concurrency, cp)
+	return counts, context.Cause(ctx)
+}
+
+// generateRecommendations 为候选用户生成推荐内容，跳过全局退订推送的用户；cp 不为 nil 时跳过已完成的用户
+func (s *Scheduler) generateRecommendations(ctx context.Context, cids []string, cp *services.RunCheckpoint) (models.StageCounts, error) {
+	subscribed, err := services.FilterOptedOutCIDs(cids)
+	if err != nil {
+		return models.StageCounts{}, fmt.Errorf("获取退订用户失败: %w", err)
+	}
+	if skipped := len(cids) - len(subscribed); skipped > 0 {
+		logger.Info("跳过已退订推送的用户", "count", skipped)
+	}
+	counts := services.GenerateRecommendationsWithCheckpoint(ctx, s.cfg, subscribed, s.concurrency, cp)
+	return counts, context.Cause(ctx)
+}
+
+// runPipeline 执行完整推荐流程：画像生成 → 推荐生成 → 推送
+// 每个用户在每个阶段的处理结果都记录检查点，恢复执行时跳过已完成的阶段和用户
+func (s *Scheduler) runPipeline(ctx context.Context, rec *runRecorder) error {
+	cids, err := s.listCandidateCIDs()
+	if err != nil {
+		return err
+	}
+
+	// 步骤1：使用并发控制生成用户画像
+	if err := s.runPipelineStage(rec, "[步骤1/3]", "用户画像生成", models.StageProfile, func(cp *services.RunCheckpoint) (models.StageCounts, error) {
+		return s.generateProfiles(ctx, cids, cp)
+	}); err != nil {
+		return err
+	}
+
+	// 步骤2：生成推荐内容
+	if err := s.runPipelineStage(rec, "[步骤2/3]", "推荐内容生成", models.StageRecommend, func(cp *services.RunCheckpoint) (models.StageCounts, error) {
+		return s.generateRecommendations(ctx, cids, cp)
+	}); err != nil {
+		return fmt.Errorf("跳过推送: %w", err)
+	}
+
+	// 步骤3：执行推送，已推送和推送结果未知的用户不再推送
+	return s.runPipelineStage(rec, "[步骤3/3]", "推送任务", models.StagePush, func(cp *services.RunCheckpoint) (models.StageCounts, error) {
+		counts, err := services.PushAllWithCheckpoint(ctx, s.cfg, cp)
+		if err == nil {
+			err = context.Cause(ctx)
 		}
-		return "Unknown Task"
-	}())
-
-	switch taskType {
-	case TaskProfileGeneration:
-		// 执行完整推荐流程：画像生成 → 推荐生成 → 推送
-		// 获取所有候选用户
-		cids, err := repository.ListCandidateCIDs(s.cfg.Cron.LookbackDays)
+		return counts, err
+	})
+}
+
+// runPipelineStage 执行完整流程的一个阶段，恢复执行时跳过已完成的阶段
+func (s *Scheduler) runPipelineStage(rec *runRecorder, step, name, stage string, fn func(cp *services.RunCheckpoint) (models.StageCounts, error)) error {
+	if rec.completed(stage) {
+		logger.Info(step+" "+name+"已完成，跳过", "run_id", rec.runID)
+		return nil
+	}
+
+	logger.Info(step + " 开始执行" + name)
+	err := rec.stage(stage, func() (models.StageCounts, error) {
+		cp, err := rec.checkpoint(stage)
 		if err != nil {
-			logger.Error("获取候选用户列表失败", "error", err)
-			return
+			return models.StageCounts{}, fmt.Errorf("加载流程检查点失败: %w", err)
 		}
+		return fn(cp)
+	})
+	if err != nil {
+		return fmt.Errorf("%s %s执行错误: %w", step, name, err)
+	}
+	logger.Info(step + " " + name + "执行完成")
+	return nil
+}
 
-		logger.Info("找到候选用户", "count", len(cids), "concurrency", s.concurrency, "workflow", "完整推荐流程")
-
-		// 步骤1：使用并发控制生成用户画像
-		logger.Info("[步骤1/3] 开始生成用户画像")
-		services.GenerateProfilesWithConcurrency(s.cfg, cids, s.concurrency)
-		logger.Info("[步骤1/3] 用户画像生成完成")
+// runProfileJob 为候选用户生成画像
+func (s *Scheduler) runProfileJob(ctx context.Context, rec *runRecorder) error {
+	cids, err := s.listCandidateCIDs()
+	if err != nil {
+		return err
+	}
+	return rec.stage(models.StageProfile, func() (models.StageCounts, error) {
+		return s.generateProfiles(ctx, cids, nil)
+	})
+}
 
-		// 步骤2：生成推荐内容
-		logger.Info("[步骤2/3] 开始生成推荐内容")
-		services.GenerateRecommendationsWithConcurrency(s.cfg, cids, s.concurrency)
-		logger.Info("[步骤2/3] 推荐内容生成完成")
+// runRecommendationJob 为候选用户生成推荐内容
+func (s *Scheduler) runRecommendationJob(ctx context.Context, rec *runRecorder) error {
+	cids, err := s.listCandidateCIDs()
+	if err != nil {
+		return err
+	}
+	return rec.stage(models.StageRecommend, func() (models.StageCounts, error) {
+		return s.generateRecommendations(ctx, cids, nil)
+	})
+}
 
-		// 步骤3：执行推送
-		logger.Info("[步骤3/3] 开始执行推送任务")
-		if err := services.PushAll(s.cfg); err != nil {
-			logger.Error("[步骤3/3] 推送任务执行错误", "error", err)
-		} else {
-			logger.Info("[步骤3/3] 推送任务执行完成")
+// runPushJob 推送已生成的用户推荐内容
+func (s *Scheduler) runPushJob(ctx context.Context, rec *runRecorder) error {
+	return rec.stage(models.StagePush, func() (models.StageCounts, error) {
+		counts, err := services.PushRecommendationsContext(ctx, s.cfg)
+		if err == nil {
+			err = context.Cause(ctx)
 		}
-		logger.Info("完整推荐流程执行完成")
-	}
+		return counts, err
+	})
+}
+
+// runBroadcastJob 发送热门话题群发消息
+func (s *Scheduler) runBroadcastJob(ctx context.Context, rec *runRecorder) error {
+	return services.PushHotTopicsBroadcast(s.cfg)
+}
+
+// runCleanupJob 清理过期数据
+func (s *Scheduler) runCleanupJob(ctx context.Context, rec *runRecorder) error {
+	return services.CleanupExpiredData(s.cfg)
 }
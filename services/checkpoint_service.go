@@ -0,0 +1,104 @@
+package services
+
+import (
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+	"context"
+)
+
+// broadcastCheckpointCID 热门话题群发在推送阶段检查点中使用的 cid
+const broadcastCheckpointCID = ""
+
+// RunCheckpoint 完整推荐流程某次执行中一个阶段的用户处理进度，中断后恢复执行时跳过已完成的用户
+// 为 nil 时不记录进度，所有用户都会处理
+type RunCheckpoint struct {
+	runID int64
+	stage string
+	// 推送阶段在推送前先记录，推送结果未知的用户恢复执行时也跳过，避免重复推送
+	atMostOnce bool
+	completed  map[string]bool
+}
+
+// LoadRunCheckpoint 加载执行记录在某个阶段已完成的用户
+func LoadRunCheckpoint(runID int64, stage string) (*RunCheckpoint, error) {
+	atMostOnce := stage == models.StagePush
+	statuses := []string{models.CheckpointDone}
+	if atMostOnce {
+		statuses = append(statuses, models.CheckpointStarted)
+	}
+
+	cids, err := repository.ListCheckpointCIDs(runID, stage, statuses)
+	if err != nil {
+		return nil, err
+	}
+	completed := make(map[string]bool, len(cids))
+	for _, cid := range cids {
+		completed[cid] = true
+	}
+	return &RunCheckpoint{runID: runID, stage: stage, atMostOnce: atMostOnce, completed: completed}, nil
+}
+
+// HasFailedCheckpoints 执行记录在某个阶段是否有处理失败、需要重试的用户
+func HasFailedCheckpoints(runID int64, stage string) (bool, error) {
+	cids, err := repository.ListCheckpointCIDs(runID, stage, []string{models.CheckpointFailed})
+	if err != nil {
+		return false, err
+	}
+	return len(cids) > 0, nil
+}
+
+// Completed 用户在本阶段是否已处理完成，推送阶段推送结果未知的用户也视为已完成
+func (c *RunCheckpoint) Completed(cid string) bool {
+	return c != nil && c.completed[cid]
+}
+
+// pending 过滤掉已完成的用户，返回待处理的用户和跳过的用户数
+func (c *RunCheckpoint) pending(cids []string) ([]string, int) {
+	if c == nil || len(c.completed) == 0 {
+		return cids, 0
+	}
+	out := make([]string, 0, len(cids))
+	for _, cid := range cids {
+		if !c.completed[cid] {
+			out = append(out, cid)
+		}
+	}
+	return out, len(cids) - len(out)
+}
+
+// Begin 开始处理用户前调用；推送阶段先原子地领取该用户，只有没有检查点或上次推送失败的用户能领取成功
+// 返回 false 或错误时调用方不应继续推送：其他执行者已领取该用户，或检查点写入失败
+func (c *RunCheckpoint) Begin(cid string) (bool, error) {
+	if c == nil || !c.atMostOnce {
+		return true, nil
+	}
+	return repository.ClaimCheckpoint(c.runID, c.stage, cid, models.CheckpointStarted, models.CheckpointFailed)
+}
+
+// Finish 记录用户的处理结果，失败的用户恢复执行时重试
+func (c *RunCheckpoint) Finish(cid string, err error) {
+	if c == nil {
+		return
+	}
+	status := models.CheckpointDone
+	if err != nil {
+		status = models.CheckpointFailed
+	}
+	if saveErr := repository.SaveCheckpoint(c.runID, c.stage, cid, status); saveErr != nil {
+		logger.Warn("记录流程检查点失败", "run_id", c.runID, "stage", c.stage, "cid", cid, "error", saveErr)
+	}
+}
+
+// acquireSlot 批量处理时获取一个并发名额，ctx 已取消时返回 false，调用方不应再开始处理新的用户
+func acquireSlot(ctx context.Context, semaphore chan struct{}) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case semaphore <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/repository"
+)
+
+// CleanupExpiredData 清理超过保留天数的推送记录、反馈、已审核内容和流程检查点，以及过期的RAG检索缓存
+func CleanupExpiredData(cfg *config.Config) error {
+	retentionDays := cfg.Scheduler.CleanupRetentionDays
+	if retentionDays <= 0 {
+		retentionDays = 90 // 默认值
+	}
+	// 相似用户推荐依赖回溯期内的推送和点击记录，保留天数不能比回溯期短
+	if lookbackDays := cfg.Collaborative.LookbackDays; lookbackDays > retentionDays {
+		retentionDays = lookbackDays
+	}
+
+	before := time.Now().AddDate(0, 0, -retentionDays)
+	deleted, err := repository.DeleteExpiredRecords(before)
+	if err != nil {
+		logger.Error("清理过期数据失败", "retention_days", retentionDays, "deleted", deleted, "error", err)
+		return err
+	}
+
+	purged := PurgeExpiredRAGCache()
+	logger.Info("过期数据清理完成", "retention_days", retentionDays, "deleted", deleted, "rag_cache_purged", purged)
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"strings"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// defaultGroupRules 内置的群组画像规则，按优先级排列，用户类型取第一个命中的规则
+var defaultGroupRules = []config.GroupProfileRule{
+	{GroupKeywords: []string{"技术", "开发", "节点", "dev"}, UserType: "技术爱好者", Interests: []string{"区块链技术", "智能合约", "节点部署"}},
+	{GroupKeywords: []string{"投资", "交易", "行情"}, UserType: "投资者", Interests: []string{"DW20", "数字货币投资", "交易策略"}},
+	{GroupKeywords: []string{"新手", "入门", "萌新"}, UserType: "新手", Interests: []string{"区块链入门", "数字货币基础", "钱包使用"}},
+}
+
+// groupProfileRules 获取群组画像规则
+func groupProfileRules(cfg *config.Config) []config.GroupProfileRule {
+	if len(cfg.Profile.GroupRules) > 0 {
+		return cfg.Profile.GroupRules
+	}
+	return defaultGroupRules
+}
+
+// groupSignal 从用户所在群组推断出的用户类型和兴趣
+type groupSignal struct {
+	userType  string
+	interests []string
+}
+
+// deriveGroupSignal 按群组画像规则匹配用户所在的群组
+func deriveGroupSignal(cfg *config.Config, groups []string) groupSignal {
+	var signal groupSignal
+	seen := make(map[string]bool)
+	for _, rule := range groupProfileRules(cfg) {
+		if !groupsMatchRule(groups, rule) {
+			continue
+		}
+		if signal.userType == "" {
+			signal.userType = rule.UserType
+		}
+		for _, interest := range rule.Interests {
+			if !seen[interest] {
+				seen[interest] = true
+				signal.interests = append(signal.interests, interest)
+			}
+		}
+	}
+
+	// 没有命中规则时，从群名中提取话题作为兴趣
+	if len(signal.interests) == 0 {
+		for _, group := range groups {
+			for _, topic := range repository.ExtractTopicsFromMessage(group, "") {
+				if !seen[topic] {
+					seen[topic] = true
+					signal.interests = append(signal.interests, topic)
+				}
+			}
+		}
+	}
+	return signal
+}
+
+// groupsMatchRule 是否有群名包含规则中的任一关键词
+func groupsMatchRule(groups []string, rule config.GroupProfileRule) bool {
+	for _, group := range groups {
+		name := strings.ToLower(group)
+		for _, kw := range rule.GroupKeywords {
+			if kw != "" && strings.Contains(name, strings.ToLower(kw)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coldStartProfile 没有可分析的内容时，根据用户所在的群组生成初始画像
+// 群组也无法提供信息时使用默认的"新手"画像
+func coldStartProfile(cfg *config.Config, cid string, userData *repository.CombinedUserData) *models.Profile {
+	signal := deriveGroupSignal(cfg, userData.JoinedGroups)
+	if len(signal.interests) == 0 {
+		profile := defaultBeginnerProfile()
+		profile.UserID = cid
+		if signal.userType != "" {
+			profile.UserType = signal.userType
+		}
+		return profile
+	}
+
+	profile := &models.Profile{
+		UserID:        cid,
+		Interests:     signal.interests,
+		UserType:      signal.userType,
+		ActivityLevel: determineActivityLevel(userData),
+		DataSources: map[string]bool{
+			"group_membership": len(userData.JoinedGroups) > 0,
+		},
+	}
+	profile.Normalize()
+	return profile
+}
+
+// applyGroupSignal 用户类型无法从内容中确定时，使用所在群组推断的用户类型
+func applyGroupSignal(cfg *config.Config, profile *models.Profile, groups []string) {
+	if profile.UserType != models.DefaultUserType || len(groups) == 0 {
+		return
+	}
+	if signal := deriveGroupSignal(cfg, groups); signal.userType != "" {
+		profile.UserType = signal.userType
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+)
+
+// 社区行为类别
+const (
+	behaviorPost    = "post"
+	behaviorComment = "comment"
+	behaviorShare   = "share"
+	behaviorLike    = "like"
+)
+
+// communityBehaviors 行为类别，按对兴趣的代表性从高到低排列
+var communityBehaviors = []string{behaviorPost, behaviorComment, behaviorShare, behaviorLike}
+
+// behaviorLabels 行为类别在提示词中的名称
+var behaviorLabels = map[string]string{
+	behaviorPost:    "发帖",
+	behaviorComment: "评论",
+	behaviorShare:   "转发",
+	behaviorLike:    "点赞",
+}
+
+// defaultBehaviorTypes 内置的 behavior_type 取值映射，可通过 profile.behavior_types 补充或覆盖
+var defaultBehaviorTypes = map[string]string{
+	"post":    behaviorPost,
+	"publish": behaviorPost,
+	"发帖":      behaviorPost,
+	"发布":      behaviorPost,
+	"comment": behaviorComment,
+	"reply":   behaviorComment,
+	"评论":      behaviorComment,
+	"回复":      behaviorComment,
+	"share":   behaviorShare,
+	"forward": behaviorShare,
+	"repost":  behaviorShare,
+	"转发":      behaviorShare,
+	"分享":      behaviorShare,
+	"like":    behaviorLike,
+	"点赞":      behaviorLike,
+}
+
+// unmappedBehaviorLogInterval 同一个无法识别的 behavior_type 取值两次警告日志的最小间隔
+const unmappedBehaviorLogInterval = time.Hour
+
+// maxUnmappedBehaviors 最多跟踪的无法识别取值个数，超过后清空重新计数
+const maxUnmappedBehaviors = 1000
+
+var (
+	unmappedBehaviorMu     sync.Mutex
+	unmappedBehaviorCounts = make(map[string]int)       // 取值 -> 上次记录日志之后的出现次数
+	unmappedBehaviorLogged = make(map[string]time.Time) // 取值 -> 上次记录日志的时间
+)
+
+// reportUnmappedBehavior 记录无法识别的 behavior_type 取值，同一取值每个间隔内最多记录一次警告日志，附带期间的出现次数
+func reportUnmappedBehavior(raw string) {
+	now := time.Now()
+	unmappedBehaviorMu.Lock()
+	if _, ok := unmappedBehaviorLogged[raw]; !ok && len(unmappedBehaviorLogged) >= maxUnmappedBehaviors {
+		unmappedBehaviorCounts = make(map[string]int)
+		unmappedBehaviorLogged = make(map[string]time.Time)
+	}
+	unmappedBehaviorCounts[raw]++
+	if last, ok := unmappedBehaviorLogged[raw]; ok && now.Sub(last) < unmappedBehaviorLogInterval {
+		unmappedBehaviorMu.Unlock()
+		return
+	}
+	count := unmappedBehaviorCounts[raw]
+	unmappedBehaviorCounts[raw] = 0
+	unmappedBehaviorLogged[raw] = now
+	unmappedBehaviorMu.Unlock()
+
+	logger.Warn("无法识别的社区行为类型，按发帖处理，可在 profile.behavior_types 中配置映射",
+		"behavior_type", raw, "count", count)
+}
+
+// classifyBehavior 将 behavior_type 原值归类为行为类别，为空时按发帖处理；
+// 无法识别的取值也按发帖处理，并记录警告日志
+func classifyBehavior(cfg *config.Config, behaviorType string) string {
+	raw := strings.TrimSpace(behaviorType)
+	if raw == "" {
+		return behaviorPost
+	}
+	key := strings.ToLower(raw)
+	for _, k := range []string{raw, key} {
+		if category, ok := cfg.Profile.BehaviorTypes[k]; ok {
+			if _, known := behaviorLabels[category]; known {
+				return category
+			}
+		}
+	}
+	if category, ok := defaultBehaviorTypes[key]; ok {
+		return category
+	}
+	reportUnmappedBehavior(raw)
+	return behaviorPost
+}
+
+// behaviorWeight 获取行为类别的权重
+func behaviorWeight(cfg *config.Config, category string) float64 {
+	weights := cfg.Profile.BehaviorWeights
+	switch category {
+	case behaviorComment:
+		if weights.Comment > 0 {
+			return weights.Comment
+		}
+		return 0.7 // 默认值
+	case behaviorShare:
+		if weights.Share > 0 {
+			return weights.Share
+		}
+		return 0.6 // 默认值
+	case behaviorLike:
+		if weights.Like > 0 {
+			return weights.Like
+		}
+		return 0.3 // 默认值
+	default:
+		if weights.Post > 0 {
+			return weights.Post
+		}
+		return 1.0 // 默认值
+	}
+}
+
+// communityBehaviorAt 获取第 i 条社区内容的行为类别
+func communityBehaviorAt(cfg *config.Config, behaviors []string, i int) string {
+	if i < len(behaviors) {
+		return classifyBehavior(cfg, behaviors[i])
+	}
+	return behaviorPost
+}
+
+// describeCommunityBehaviors 按行为类别统计社区内容条数，用于提示词，如"发帖 3 条（权重 1.0）、点赞 5 条（权重 0.3）"
+func describeCommunityBehaviors(cfg *config.Config, posts, behaviors []string) string {
+	counts := make(map[string]int)
+	for i := range posts {
+		counts[communityBehaviorAt(cfg, behaviors, i)]++
+	}
+
+	parts := make([]string, 0, len(communityBehaviors))
+	for _, category := range communityBehaviors {
+		if counts[category] == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %d 条（权重 %.1f）", behaviorLabels[category], counts[category], behaviorWeight(cfg, category)))
+	}
+	if len(parts) == 0 {
+		return "无"
+	}
+	return strings.Join(parts, "、")
+}
+
+// labelCommunityPosts 为每条社区内容标注行为类别，如"[点赞] 内容"
+func labelCommunityPosts(cfg *config.Config, posts, behaviors []string) []string {
+	labeled := make([]string, 0, len(posts))
+	for i, post := range posts {
+		labeled = append(labeled, fmt.Sprintf("[%s] %s", behaviorLabels[communityBehaviorAt(cfg, behaviors, i)], post))
+	}
+	return labeled
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	"ai_push_message/config"
+)
+
+func TestClassifyBehavior(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Profile.BehaviorTypes = map[string]string{
+		"2":     behaviorLike,
+		"reply": behaviorShare, // 覆盖内置映射
+		"9":     "unknown",     // 无效的行为类别不生效
+	}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"post", behaviorPost},
+		{" Comment ", behaviorComment},
+		{"转发", behaviorShare},
+		{"点赞", behaviorLike},
+		{"2", behaviorLike},
+		{"reply", behaviorShare},
+		{"", behaviorPost},
+		{"9", behaviorPost},
+		{"collect", behaviorPost},
+	}
+	for _, tt := range tests {
+		if got := classifyBehavior(cfg, tt.raw); got != tt.want {
+			t.Errorf("classifyBehavior(%q) = %s，期望 %s", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyBehaviorReportsUnmappedValues(t *testing.T) {
+	cfg := &config.Config{}
+	for i := 0; i < 3; i++ {
+		classifyBehavior(cfg, "收藏")
+	}
+	classifyBehavior(cfg, "like")
+
+	unmappedBehaviorMu.Lock()
+	defer unmappedBehaviorMu.Unlock()
+	// 首次出现时记录日志，之后间隔内的出现只计数
+	if _, logged := unmappedBehaviorLogged["收藏"]; !logged {
+		t.Error("无法识别的取值应记录日志")
+	}
+	if got := unmappedBehaviorCounts["收藏"]; got != 2 {
+		t.Errorf("间隔内的出现次数为 %d，期望 2", got)
+	}
+	if _, logged := unmappedBehaviorLogged["like"]; logged {
+		t.Error("可以识别的取值不应记录")
+	}
+}
+
+func TestBehaviorWeight(t *testing.T) {
+	cfg := &config.Config{}
+	defaults := map[string]float64{behaviorPost: 1.0, behaviorComment: 0.7, behaviorShare: 0.6, behaviorLike: 0.3}
+	for category, want := range defaults {
+		if got := behaviorWeight(cfg, category); got != want {
+			t.Errorf("%s 的默认权重为 %.1f，期望 %.1f", category, got, want)
+		}
+	}
+
+	cfg.Profile.BehaviorWeights.Like = 0.5
+	if got := behaviorWeight(cfg, behaviorLike); got != 0.5 {
+		t.Errorf("配置的点赞权重为 %.1f，期望 0.5", got)
+	}
+
+	got := describeCommunityBehaviors(cfg, []string{"a", "b", "c"}, []string{"点赞", "post", "like"})
+	if want := "发帖 1 条（权重 1.0）、点赞 2 条（权重 0.5）"; got != want {
+		t.Errorf("describeCommunityBehaviors = %q，期望 %q", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/utils"
+)
+
+// diversityCandidate 多样性重排的候选项
+type diversityCandidate struct {
+	item      models.RecommendationItem
+	relevance float64 // 归一化后的相关性分数，范围0-1
+	shingles  map[string]struct{}
+}
+
+// diversitySelector 记录已选结果及各文档、知识库的配额占用
+type diversitySelector struct {
+	cfg        *config.Config
+	candidates []diversityCandidate
+	used       []bool
+	selected   []int
+	perDoc     map[string]int
+	perKB      map[string]int
+}
+
+// diversifyRecommendations 对检索结果做多样性重排
+// 先保证前几个兴趣点各有代表内容，再用最大边际相关性（MMR）补足剩余位置，
+// 同时限制同一文档和同一知识库的条目数，并剔除近似重复的内容
+// interests 为按权重从高到低排列的用户兴趣关键词
+func diversifyRecommendations(cfg *config.Config, items []models.RecommendationItem, interests []string, topN int) []models.RecommendationItem {
+	if !cfg.Diversity.Enabled || len(items) == 0 {
+		if topN > 0 && len(items) > topN {
+			return items[:topN]
+		}
+		return items
+	}
+	if topN <= 0 {
+		topN = len(items)
+	}
+
+	shingleSize := cfg.Diversity.ShingleSize
+	if shingleSize <= 0 {
+		shingleSize = 2
+	}
+
+	maxScore := 0.0
+	for _, item := range items {
+		if score := rankingScore(item); score > maxScore {
+			maxScore = score
+		}
+	}
+
+	candidates := make([]diversityCandidate, 0, len(items))
+	for _, item := range items {
+		relevance := 1.0
+		if maxScore > 0 {
+			relevance = rankingScore(item) / maxScore
+		}
+		candidates = append(candidates, diversityCandidate{
+			item:      item,
+			relevance: relevance,
+			shingles:  utils.TextShingles(item.Title+item.Content, shingleSize),
+		})
+	}
+
+	s := &diversitySelector{
+		cfg:        cfg,
+		candidates: candidates,
+		used:       make([]bool, len(candidates)),
+		perDoc:     make(map[string]int),
+		perKB:      make(map[string]int),
+	}
+
+	// 第一阶段：为权重最高的若干兴趣各选一条代表内容
+	minInterests := cfg.Diversity.MinInterests
+	covered := 0
+	for _, interest := range interests {
+		if covered >= minInterests || len(s.selected) >= topN {
+			break
+		}
+		if idx := s.best(func(c diversityCandidate) bool { return c.item.SearchKeyword == interest }); idx >= 0 {
+			s.take(idx)
+			covered++
+		}
+	}
+
+	// 第二阶段：按MMR补足剩余位置
+	for len(s.selected) < topN {
+		idx := s.best(nil)
+		if idx < 0 {
+			break
+		}
+		s.take(idx)
+	}
+
+	// 最终顺序：在选中的结果内部再做一次MMR排序，避免相似内容相邻
+	result := make([]models.RecommendationItem, 0, len(s.selected))
+	for _, idx := range orderByMMR(candidates, s.selected, cfg.Diversity.Lambda) {
+		result = append(result, candidates[idx].item)
+	}
+
+	logger.Info("Diversity re-ranking finished",
+		"candidates", len(items),
+		"selected", len(result),
+		"interests_covered", covered)
+	return result
+}
+
+// best 返回满足配额且非重复的候选中MMR得分最高者的下标，没有可选项时返回-1
+func (s *diversitySelector) best(filter func(diversityCandidate) bool) int {
+	bestIdx := -1
+	bestScore := 0.0
+	for i, c := range s.candidates {
+		if s.used[i] || (filter != nil && !filter(c)) || !s.withinQuota(c.item) {
+			continue
+		}
+		maxSim := s.maxSimilarity(c)
+		if s.cfg.Diversity.DuplicateThreshold > 0 && maxSim >= s.cfg.Diversity.DuplicateThreshold {
+			continue
+		}
+		score := mmrScore(c.relevance, maxSim, s.cfg.Diversity.Lambda)
+		if bestIdx < 0 || score > bestScore {
+			bestIdx = i
+			bestScore = score
+		}
+	}
+	return bestIdx
+}
+
+// take 选中候选项并占用对应配额
+func (s *diversitySelector) take(idx int) {
+	s.used[idx] = true
+	s.selected = append(s.selected, idx)
+	item := s.candidates[idx].item
+	if item.RefID != "" {
+		s.perDoc[item.RefID]++
+	}
+	if item.KnowledgeID != "" {
+		s.perKB[item.KnowledgeID]++
+	}
+}
+
+// withinQuota 检查同一文档和同一知识库的条目数是否超过上限
+func (s *diversitySelector) withinQuota(item models.RecommendationItem) bool {
+	if limit := s.cfg.Diversity.MaxPerDocument; limit > 0 && item.RefID != "" && s.perDoc[item.RefID] >= limit {
+		return false
+	}
+	if limit := s.cfg.Diversity.MaxPerKB; limit > 0 && item.KnowledgeID != "" && s.perKB[item.KnowledgeID] >= limit {
+		return false
+	}
+	return true
+}
+
+// maxSimilarity 计算候选项与已选结果的最大相似度
+func (s *diversitySelector) maxSimilarity(c diversityCandidate) float64 {
+	maxSim := 0.0
+	for _, idx := range s.selected {
+		if sim := utils.JaccardSimilarity(c.shingles, s.candidates[idx].shingles); sim > maxSim {
+			maxSim = sim
+		}
+	}
+	return maxSim
+}
+
+// orderByMMR 对给定下标集合按MMR贪心排序
+func orderByMMR(candidates []diversityCandidate, indexes []int, lambda float64) []int {
+	remaining := make([]int, len(indexes))
+	copy(remaining, indexes)
+	ordered := make([]int, 0, len(indexes))
+
+	for len(remaining) > 0 {
+		bestPos := 0
+		bestScore := 0.0
+		for pos, idx := range remaining {
+			maxSim := 0.0
+			for _, chosen := range ordered {
+				if sim := utils.JaccardSimilarity(candidates[idx].shingles, candidates[chosen].shingles); sim > maxSim {
+					maxSim = sim
+				}
+			}
+			score := mmrScore(candidates[idx].relevance, maxSim, lambda)
+			if pos == 0 || score > bestScore {
+				bestPos = pos
+				bestScore = score
+			}
+		}
+		ordered = append(ordered, remaining[bestPos])
+		remaining = append(remaining[:bestPos], remaining[bestPos+1:]...)
+	}
+	return ordered
+}
+
+// mmrScore 最大边际相关性得分：λ·相关性 − (1−λ)·与已选结果的最大相似度
+func mmrScore(relevance, maxSim, lambda float64) float64 {
+	if lambda <= 0 || lambda > 1 {
+		lambda = 0.7 // 默认值
+	}
+	return lambda*relevance - (1-lambda)*maxSim
+}
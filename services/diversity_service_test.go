@@ -0,0 +1,104 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+)
+
+func diversityItem(title, refID, kb, keyword string, score float64) models.RecommendationItem {
+	return models.RecommendationItem{Title: title, RefID: refID, KnowledgeID: kb, SearchKeyword: keyword, Score: score}
+}
+
+func titles(items []models.RecommendationItem) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Title)
+	}
+	return out
+}
+
+func TestDiversifyRecommendations(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+		items     []models.RecommendationItem
+		interests []string
+		topN      int
+		want      []string
+	}{
+		{
+			name:      "剔除近似重复的内容",
+			configure: func(cfg *config.Config) { cfg.Diversity.DuplicateThreshold = 0.8 },
+			items: []models.RecommendationItem{
+				diversityItem("比特币价格今日大涨", "d1", "kb1", "比特币", 0.9),
+				diversityItem("比特币价格今日大涨！", "d2", "kb1", "比特币", 0.85),
+				diversityItem("以太坊升级进展", "d3", "kb1", "以太坊", 0.5),
+			},
+			topN: 3,
+			want: []string{"比特币价格今日大涨", "以太坊升级进展"},
+		},
+		{
+			name:      "同一文档最多保留的条目数",
+			configure: func(cfg *config.Config) { cfg.Diversity.MaxPerDocument = 1 },
+			items: []models.RecommendationItem{
+				diversityItem("钱包安全指南", "d1", "kb1", "钱包", 0.9),
+				diversityItem("助记词备份方法", "d1", "kb1", "钱包", 0.8),
+				diversityItem("交易所手续费对比", "d2", "kb1", "交易所", 0.7),
+			},
+			topN: 3,
+			want: []string{"钱包安全指南", "交易所手续费对比"},
+		},
+		{
+			name:      "同一知识库最多保留的条目数",
+			configure: func(cfg *config.Config) { cfg.Diversity.MaxPerKB = 1 },
+			items: []models.RecommendationItem{
+				diversityItem("钱包安全指南", "d1", "kb1", "钱包", 0.9),
+				diversityItem("助记词备份方法", "d2", "kb1", "钱包", 0.8),
+				diversityItem("交易所手续费对比", "d3", "kb2", "交易所", 0.7),
+			},
+			topN: 3,
+			want: []string{"钱包安全指南", "交易所手续费对比"},
+		},
+		{
+			name:      "未要求覆盖兴趣时按相关性选取",
+			configure: func(cfg *config.Config) {},
+			items: []models.RecommendationItem{
+				diversityItem("比特币减半时间", "d1", "kb1", "比特币", 0.9),
+				diversityItem("比特币矿机收益", "d2", "kb1", "比特币", 0.85),
+				diversityItem("以太坊质押教程", "d3", "kb1", "以太坊", 0.3),
+			},
+			interests: []string{"比特币", "以太坊"},
+			topN:      2,
+			want:      []string{"比特币减半时间", "比特币矿机收益"},
+		},
+		{
+			name:      "优先覆盖权重最高的兴趣",
+			configure: func(cfg *config.Config) { cfg.Diversity.MinInterests = 2 },
+			items: []models.RecommendationItem{
+				diversityItem("比特币减半时间", "d1", "kb1", "比特币", 0.9),
+				diversityItem("比特币矿机收益", "d2", "kb1", "比特币", 0.85),
+				diversityItem("以太坊质押教程", "d3", "kb1", "以太坊", 0.3),
+			},
+			interests: []string{"比特币", "以太坊"},
+			topN:      2,
+			want:      []string{"比特币减半时间", "以太坊质押教程"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Diversity.Enabled = true
+			cfg.Diversity.Lambda = 1 // 只按相关性排序，结果顺序确定
+			tt.configure(cfg)
+
+			got := titles(diversifyRecommendations(cfg, tt.items, tt.interests, tt.topN))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("结果为 %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/utils"
+)
+
+// fallbackDocument 本地索引中的知识库文档片段
+type fallbackDocument struct {
+	KnowledgeID string `json:"knowledge_id"`
+	DocumentID  string `json:"document_id"`
+	ChunkID     string `json:"chunk_id,omitempty"`
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+}
+
+func (d fallbackDocument) key() string {
+	return d.KnowledgeID + "|" + d.DocumentID + "|" + d.ChunkID
+}
+
+// snapshotResp 知识库文档快照接口的响应
+type snapshotResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Documents []fallbackDocument `json:"documents"`
+	} `json:"data"`
+}
+
+// bm25Posting 倒排表中的一项：文档片段下标和词频
+type bm25Posting struct {
+	doc int
+	tf  int
+}
+
+// bm25Index 基于CJK二元组切分的BM25倒排索引，构建后只读
+type bm25Index struct {
+	docs      []fallbackDocument
+	docLens   []int
+	avgDocLen float64
+	postings  map[string][]bm25Posting
+}
+
+// buildBM25Index 构建倒排索引，标题词元计两次以提高标题命中的权重
+func buildBM25Index(docs []fallbackDocument) *bm25Index {
+	idx := &bm25Index{
+		docs:     docs,
+		docLens:  make([]int, len(docs)),
+		postings: make(map[string][]bm25Posting),
+	}
+
+	totalLen := 0
+	for i, d := range docs {
+		titleTokens := utils.TokenizeForSearch(d.Title)
+		tokens := append(utils.TokenizeForSearch(d.Content), titleTokens...)
+		tokens = append(tokens, titleTokens...)
+
+		tf := make(map[string]int)
+		for _, t := range tokens {
+			tf[t]++
+		}
+		for t, n := range tf {
+			idx.postings[t] = append(idx.postings[t], bm25Posting{doc: i, tf: n})
+		}
+		idx.docLens[i] = len(tokens)
+		totalLen += len(tokens)
+	}
+	if len(docs) > 0 {
+		idx.avgDocLen = float64(totalLen) / float64(len(docs))
+	}
+	return idx
+}
+
+// search 在指定知识库中检索，同一文档只保留得分最高的片段，按分数降序返回前topK条
+func (idx *bm25Index) search(query string, kbIDs []string, topK int, k1, b float64) []ragResult {
+	if len(idx.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(idx.docs))
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, t := range utils.TokenizeForSearch(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		postings := idx.postings[t]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			if len(kbIDs) > 0 && !containsString(kbIDs, idx.docs[p.doc].KnowledgeID) {
+				continue
+			}
+			tf := float64(p.tf)
+			norm := 1 - b + b*float64(idx.docLens[p.doc])/idx.avgDocLen
+			scores[p.doc] += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+
+	// 同一文档的多个片段只保留最高分
+	best := make(map[string]int)
+	for doc, score := range scores {
+		d := idx.docs[doc]
+		docKey := d.KnowledgeID + "|" + d.DocumentID
+		if prev, ok := best[docKey]; !ok || score > scores[prev] ||
+			(score == scores[prev] && d.key() < idx.docs[prev].key()) {
+			best[docKey] = doc
+		}
+	}
+
+	hits := make([]int, 0, len(best))
+	for _, doc := range best {
+		hits = append(hits, doc)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if scores[hits[i]] != scores[hits[j]] {
+			return scores[hits[i]] > scores[hits[j]]
+		}
+		return idx.docs[hits[i]].key() < idx.docs[hits[j]].key()
+	})
+	if topK > 0 && len(hits) > topK {
+		hits = hits[:topK]
+	}
+
+	results := make([]ragResult, 0, len(hits))
+	for _, doc := range hits {
+		d := idx.docs[doc]
+		results = append(results, ragResult{
+			ChunkID:     d.ChunkID,
+			DocumentID:  d.DocumentID,
+			KnowledgeID: d.KnowledgeID,
+			Title:       d.Title,
+			Content:     d.Content,
+			Score:       scores[doc],
+		})
+	}
+	return results
+}
+
+// fallbackRebuildInterval 文档集合持续变化时，两次后台重建索引的最小间隔
+const fallbackRebuildInterval = 30 * time.Second
+
+// fallbackStore 本地索引的文档集合，来源为知识库快照和RAG检索过程中收集的文档
+// 索引在锁外构建后原子替换，检索时不等待重建
+type fallbackStore struct {
+	mu         sync.Mutex
+	docs       map[string]fallbackDocument
+	dirty      bool   // 文档集合变化后需要重建索引
+	rebuilding bool   // 后台重建任务是否在运行
+	seq        uint64 // 文档集合快照的序号，避免较早的快照构建的索引覆盖较新的索引
+	builtSeq   uint64 // 当前索引对应的快照序号
+	index      atomic.Pointer[bm25Index]
+}
+
+var fallbackDocs = &fallbackStore{docs: make(map[string]fallbackDocument)}
+
+// ragCircuitBreaker RAG服务连续失败达到阈值后，在冷却期内直接使用本地索引
+type ragCircuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+var ragBreaker = &ragCircuitBreaker{}
+
+// isOpen 是否处于直接使用本地索引的冷却期
+func (cb *ragCircuitBreaker) isOpen() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return time.Now().Before(cb.openUntil)
+}
+
+// record 记录一次上游调用结果；不支持多查询不属于服务故障
+func (cb *ragCircuitBreaker) record(cfg *config.Config, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err == nil || errors.Is(err, errRAGMultiQueryUnsupported) {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	threshold := cfg.Fallback.FailureThreshold
+	if threshold <= 0 {
+		threshold = 3 // 默认值
+	}
+	if cb.failures < threshold {
+		return
+	}
+
+	cooldown := time.Duration(cfg.Fallback.CooldownSec) * time.Second
+	if cooldown <= 0 {
+		cooldown = time.Minute // 默认值
+	}
+	cb.openUntil = time.Now().Add(cooldown)
+	cb.failures = 0
+	logger.Warn("RAG服务连续失败，暂时改用本地索引", "cooldown", cooldown.String())
+}
+
+// StartFallbackIndex 加载本地快照并启动定时刷新，未启用时直接返回
+func StartFallbackIndex(cfg *config.Config) {
+	if !cfg.Fallback.Enabled {
+		return
+	}
+
+	if err := loadFallbackSnapshot(cfg); err != nil {
+		logger.Warn("加载本地知识库快照失败", "path", cfg.Fallback.SnapshotPath, "error", err)
+	}
+
+	interval := time.Duration(cfg.Fallback.RefreshIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = time.Hour // 默认值
+	}
+
+	go func() {
+		for {
+			if err := refreshFallbackSnapshot(cfg); err != nil {
+				logger.Error("刷新本地知识库快照失败", "error", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+	logger.Info("本地全文索引已启动", "refresh_interval", interval.String())
+}
+
+// loadFallbackSnapshot 从本地文件加载快照
+func loadFallbackSnapshot(cfg *config.Config) error {
+	if cfg.Fallback.SnapshotPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.Fallback.SnapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var docs []fallbackDocument
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return fmt.Errorf("解析快照文件失败: %v", err)
+	}
+
+	fallbackDocs.mu.Lock()
+	for _, d := range docs {
+		fallbackDocs.docs[d.key()] = d
+	}
+	count := len(fallbackDocs.docs)
+	fallbackDocs.mu.Unlock()
+
+	fallbackDocs.rebuild()
+	logger.Info("已加载本地知识库快照", "documents", count)
+	return nil
+}
+
+// refreshFallbackSnapshot 从快照接口拉取知识库文档（未配置时保留已收集的文档），
+// 重建索引并保存到本地文件
+func refreshFallbackSnapshot(cfg *config.Config) error {
+	var fetched []fallbackDocument
+	if cfg.Fallback.SnapshotURL != "" {
+		docs, err := fetchKnowledgeBaseSnapshot(cfg)
+		if err != nil {
+			return err
+		}
+		fetched = docs
+	}
+
+	fallbackDocs.mu.Lock()
+	if fetched != nil {
+		// 快照接口返回的是知识库全量文档，直接替换
+		fallbackDocs.docs = make(map[string]fallbackDocument, len(fetched))
+		for _, d := range fetched {
+			if len(fallbackDocs.docs) >= fallbackMaxDocuments(cfg) {
+				break
+			}
+			fallbackDocs.docs[d.key()] = d
+		}
+		fallbackDocs.dirty = true
+	}
+	dirty := fallbackDocs.dirty
+	docs := make([]fallbackDocument, 0, len(fallbackDocs.docs))
+	for _, d := range fallbackDocs.docs {
+		docs = append(docs, d)
+	}
+	fallbackDocs.mu.Unlock()
+
+	if dirty {
+		fallbackDocs.rebuild()
+	}
+
+	logger.Info("本地知识库快照已刷新", "documents", len(docs))
+	return saveFallbackSnapshot(cfg, docs)
+}
+
+// fetchKnowledgeBaseSnapshot 请求快照接口获取配置的知识库中的全部文档
+func fetchKnowledgeBaseSnapshot(cfg *config.Config) ([]fallbackDocument, error) {
+	payload := map[string]any{"knowledge_ids": cfg.RAG.KnowledgeIDs}
+	statusCode, body, err := postRAG(context.Background(), cfg, cfg.Fallback.SnapshotURL, payload)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("快照接口错误 (HTTP %d): %s", statusCode, string(body))
+	}
+
+	var resp snapshotResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析快照响应失败: %v", err)
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("快照接口业务错误: %s (错误码: %d)", resp.Message, resp.Code)
+	}
+	return resp.Data.Documents, nil
+}
+
+// saveFallbackSnapshot 将快照写入本地文件，先写临时文件再重命名，避免写入中断损坏快照
+func saveFallbackSnapshot(cfg *config.Config, docs []fallbackDocument) error {
+	if cfg.Fallback.SnapshotPath == "" {
+		return nil
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].key() < docs[j].key() })
+
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Fallback.SnapshotPath), 0755); err != nil {
+		return err
+	}
+	tmp := cfg.Fallback.SnapshotPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cfg.Fallback.SnapshotPath)
+}
+
+// fallbackMaxDocuments 索引最多收录的文档片段数
+func fallbackMaxDocuments(cfg *config.Config) int {
+	if cfg.Fallback.MaxDocuments <= 0 {
+		return 50000 // 默认值
+	}
+	return cfg.Fallback.MaxDocuments
+}
+
+// rebuild 复制当前文档集合后在锁外构建索引，再原子替换当前索引
+func (s *fallbackStore) rebuild() {
+	s.mu.Lock()
+	docs := make([]fallbackDocument, 0, len(s.docs))
+	for _, d := range s.docs {
+		docs = append(docs, d)
+	}
+	s.dirty = false
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].key() < docs[j].key() })
+	idx := buildBM25Index(docs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq > s.builtSeq {
+		s.builtSeq = seq
+		s.index.Store(idx)
+	}
+}
+
+// markDirtyLocked 标记文档集合已变化，并在后台重建索引，调用方需持有锁
+// 同一时间只有一个后台重建任务，持续变化时每隔 fallbackRebuildInterval 重建一次
+func (s *fallbackStore) markDirtyLocked() {
+	s.dirty = true
+	if s.rebuilding {
+		return
+	}
+	s.rebuilding = true
+	go func() {
+		for {
+			s.rebuild()
+			time.Sleep(fallbackRebuildInterval)
+
+			s.mu.Lock()
+			if !s.dirty {
+				s.rebuilding = false
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// currentIndex 返回当前索引，不等待正在进行的重建；还没有构建过索引时返回空索引
+func (s *fallbackStore) currentIndex() *bm25Index {
+	if idx := s.index.Load(); idx != nil {
+		return idx
+	}
+	return &bm25Index{}
+}
+
+// collectFallbackDocuments 收集RAG返回的文档片段，使未配置快照接口时本地索引也有内容
+func collectFallbackDocuments(cfg *config.Config, results []ragResult) {
+	if !cfg.Fallback.Enabled || len(results) == 0 {
+		return
+	}
+
+	fallbackDocs.mu.Lock()
+	defer fallbackDocs.mu.Unlock()
+	limit := fallbackMaxDocuments(cfg)
+	for _, r := range results {
+		d := fallbackDocument{
+			KnowledgeID: r.KnowledgeID,
+			DocumentID:  r.DocumentID,
+			ChunkID:     r.ChunkID,
+			Title:       r.Title,
+			Content:     r.Content,
+		}
+		old, ok := fallbackDocs.docs[d.key()]
+		if ok && old == d {
+			continue
+		}
+		if !ok && len(fallbackDocs.docs) >= limit {
+			continue
+		}
+		fallbackDocs.docs[d.key()] = d
+		fallbackDocs.markDirtyLocked()
+	}
+}
+
+// removeFallbackDocuments 从本地索引中移除已删除或更新的文档
+func removeFallbackDocuments(knowledgeID string, documentIDs []string) {
+	fallbackDocs.mu.Lock()
+	defer fallbackDocs.mu.Unlock()
+	for key, d := range fallbackDocs.docs {
+		if d.KnowledgeID == knowledgeID && containsString(documentIDs, d.DocumentID) {
+			delete(fallbackDocs.docs, key)
+			fallbackDocs.markDirtyLocked()
+		}
+	}
+}
+
+// useFallbackDirectly RAG服务处于故障冷却期且本地索引可用时，跳过远程调用
+func useFallbackDirectly(cfg *config.Config) bool {
+	return cfg.Fallback.Enabled && ragBreaker.isOpen() && len(fallbackDocs.currentIndex().docs) > 0
+}
+
+// searchFallback 使用本地BM25索引检索，分数按最高分归一化到0-1；
+// 本地索引未启用或为空时返回false
+func searchFallback(cfg *config.Config, query string, params ragSearchParams) ([]models.RecommendationItem, bool) {
+	if !cfg.Fallback.Enabled {
+		return nil, false
+	}
+	idx := fallbackDocs.currentIndex()
+	if len(idx.docs) == 0 {
+		return nil, false
+	}
+
+	k1, b := cfg.Fallback.K1, cfg.Fallback.B
+	if k1 <= 0 {
+		k1 = 1.2 // 默认值
+	}
+	if b <= 0 || b > 1 {
+		b = 0.75 // 默认值
+	}
+	minRelative := cfg.Fallback.MinRelativeScore
+	if minRelative <= 0 {
+		minRelative = 0.3 // 默认值
+	}
+
+	results := idx.search(query, params.KnowledgeIDs, params.TopK, k1, b)
+	kept := make([]ragResult, 0, len(results))
+	for _, r := range results {
+		r.Score /= results[0].Score
+		if r.Score < minRelative {
+			break
+		}
+		kept = append(kept, r)
+	}
+
+	logger.Info("使用本地索引检索", "query", query, "result_count", len(kept))
+	// 降级检索时不调用LLM口语化，避免在RAG服务故障期间增加延迟和外部依赖
+	return formatRAGResults(cfg, kept, false), true
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+)
+
+func TestBM25Search(t *testing.T) {
+	t.Run("分数", func(t *testing.T) {
+		idx := buildBM25Index([]fallbackDocument{
+			{KnowledgeID: "kb1", DocumentID: "a", Content: "比特"},
+			{KnowledgeID: "kb1", DocumentID: "b", Content: "以太"},
+		})
+		results := idx.search("比特", nil, 10, 1.2, 0.75)
+		if len(results) != 1 || results[0].DocumentID != "a" {
+			t.Fatalf("结果为 %+v，期望只命中 a", results)
+		}
+		// 两篇文档长度相同，tf=1：idf = ln(1 + (2-1+0.5)/(1+0.5)) = ln2，分数 = idf
+		if got, want := results[0].Score, math.Ln2; math.Abs(got-want) > 1e-9 {
+			t.Errorf("分数为 %v，期望 %v", got, want)
+		}
+	})
+
+	idx := buildBM25Index([]fallbackDocument{
+		{KnowledgeID: "kb1", DocumentID: "short", Title: "比特币", Content: "减半"},
+		{KnowledgeID: "kb1", DocumentID: "long", Title: "行情", Content: "比特币价格今天在多家交易所出现明显波动，市场情绪偏谨慎"},
+		{KnowledgeID: "kb1", DocumentID: "multi", ChunkID: "1", Content: "以太坊升级"},
+		{KnowledgeID: "kb1", DocumentID: "multi", ChunkID: "2", Content: "以太坊质押以太坊收益"},
+		{KnowledgeID: "kb2", DocumentID: "other", Content: "比特币钱包"},
+	})
+
+	t.Run("标题命中和较短的文档排名靠前", func(t *testing.T) {
+		results := idx.search("比特币", []string{"kb1"}, 10, 1.2, 0.75)
+		if len(results) != 2 || results[0].DocumentID != "short" || results[1].DocumentID != "long" {
+			t.Fatalf("结果为 %+v，期望 short、long", results)
+		}
+	})
+
+	t.Run("按知识库过滤", func(t *testing.T) {
+		results := idx.search("比特币", []string{"kb2"}, 10, 1.2, 0.75)
+		if len(results) != 1 || results[0].DocumentID != "other" {
+			t.Fatalf("结果为 %+v，期望只返回 kb2 的文档", results)
+		}
+	})
+
+	t.Run("同一文档只保留得分最高的片段", func(t *testing.T) {
+		results := idx.search("以太坊", nil, 10, 1.2, 0.75)
+		if len(results) != 1 || results[0].ChunkID != "2" {
+			t.Fatalf("结果为 %+v，期望只返回片段 2", results)
+		}
+	})
+
+	t.Run("截取前topK条", func(t *testing.T) {
+		if results := idx.search("比特币", nil, 1, 1.2, 0.75); len(results) != 1 {
+			t.Fatalf("返回 %d 条，期望 1 条", len(results))
+		}
+	})
+}
+
+func TestRAGCircuitBreaker(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Fallback.FailureThreshold = 2
+	cfg.Fallback.CooldownSec = 60
+	errDown := errors.New("连接失败")
+
+	cb := &ragCircuitBreaker{}
+	cb.record(cfg, errDown)
+	if cb.isOpen() {
+		t.Fatal("失败次数未达到阈值时不应切换到本地索引")
+	}
+	cb.record(cfg, nil)
+	cb.record(cfg, errDown)
+	if cb.isOpen() {
+		t.Fatal("成功调用后应重新计数")
+	}
+	cb.record(cfg, errRAGMultiQueryUnsupported)
+	cb.record(cfg, errDown)
+	if cb.isOpen() {
+		t.Fatal("不支持多查询不应计为失败")
+	}
+	cb.record(cfg, errDown)
+	if !cb.isOpen() {
+		t.Fatal("连续失败达到阈值后应切换到本地索引")
+	}
+
+	cb.openUntil = time.Now().Add(-time.Second)
+	if cb.isOpen() {
+		t.Error("冷却期结束后应重新尝试RAG服务")
+	}
+}
+
+func TestFallbackStoreRebuildsInBackground(t *testing.T) {
+	s := &fallbackStore{docs: make(map[string]fallbackDocument)}
+	if idx := s.currentIndex(); len(idx.docs) != 0 {
+		t.Fatal("还没有构建索引时应返回空索引")
+	}
+
+	s.mu.Lock()
+	d := fallbackDocument{KnowledgeID: "kb1", DocumentID: "a", Content: "比特币"}
+	s.docs[d.key()] = d
+	s.markDirtyLocked()
+
+	// 持有文档集合的锁时检索不被阻塞
+	done := make(chan int, 1)
+	go func() { done <- len(s.currentIndex().docs) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("检索等待了文档集合的锁")
+	}
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.currentIndex().docs) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("后台重建后索引应包含新文档")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSearchFallbackSkipsColloquialization(t *testing.T) {
+	var llmCalls atomic.Int32
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmCalls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer llm.Close()
+
+	cfg := &config.Config{}
+	cfg.Fallback.Enabled = true
+	cfg.SiliconFlow.APIKey = "test"
+	cfg.SiliconFlow.Model = "test"
+	cfg.SiliconFlow.BaseURL = llm.URL
+
+	prev := fallbackDocs.index.Load()
+	defer fallbackDocs.index.Store(prev)
+	fallbackDocs.index.Store(buildBM25Index([]fallbackDocument{
+		{KnowledgeID: "kb1", DocumentID: "a", Title: "比特币减半", Content: "比特币减半时间临近"},
+	}))
+
+	items, ok := searchFallback(cfg, "比特币", ragSearchParams{TopK: 5})
+	if !ok || len(items) != 1 {
+		t.Fatalf("本地索引检索返回 %d 条，ok=%v", len(items), ok)
+	}
+	if items[0].Content != "比特币减半时间临近" {
+		t.Errorf("内容为 %q，期望保留原文", items[0].Content)
+	}
+	if n := llmCalls.Load(); n != 0 {
+		t.Errorf("本地索引检索调用了 %d 次LLM口语化", n)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+)
+
+// 混合召回的来源标识
+const (
+	sourceKnowledgeBase = "knowledge_base"
+	sourceGroupSummary  = "group_summary"
+)
+
+// hybridRecall 混合召回：同时从知识库和近期群聊总结中检索候选内容，
+// 各来源分数分别归一化后按顺序归并，并按来源配额截取最终结果
+func hybridRecall(cfg *config.Config, keywords []models.WeightedKeyword, userType string) ([]models.RecommendationItem, error) {
+	topN := cfg.RAG.TopK
+
+	kbItems, err := SearchKnowledgeBaseByProfile(cfg, keywords, userType)
+	if err != nil {
+		return nil, err
+	}
+
+	lookbackDays := cfg.Hybrid.LookbackDays
+	if lookbackDays <= 0 {
+		lookbackDays = 3 // 默认值
+	}
+	gsQuota := sourceQuota(cfg.Hybrid.GroupSummaryQuota, topN)
+	gsItems, err := SearchGroupSummaries(keywords, lookbackDays, gsQuota*3)
+	if err != nil {
+		// 群聊总结只是补充来源，失败时仍返回知识库结果
+		logger.Error("Failed to search group summaries for hybrid recall", "error", err)
+		gsItems = nil
+	}
+
+	gsWeight := cfg.Hybrid.GroupSummaryWeight
+	if gsWeight <= 0 {
+		gsWeight = 1
+	}
+	normalizeScores(kbItems, 1)
+	normalizeScores(gsItems, gsWeight)
+
+	quotas := map[string]int{
+		sourceKnowledgeBase: sourceQuota(cfg.Hybrid.KnowledgeBaseQuota, topN),
+		sourceGroupSummary:  gsQuota,
+	}
+	merged := applySourceQuotas(aggregate(kbItems, gsItems), quotas, topN)
+
+	logger.Info("Hybrid recall finished",
+		"knowledge_base_candidates", len(kbItems),
+		"group_summary_candidates", len(gsItems),
+		"merged", len(merged))
+	return merged, nil
+}
+
+// sourceQuota 返回来源配额，未配置时不限制（取总数）
+func sourceQuota(quota, topN int) int {
+	if quota <= 0 || quota > topN {
+		return topN
+	}
+	return quota
+}
+
+// normalizeScores 将同一来源的排序分数按最高分归一化到 0-1，再乘以来源权重，写入 FusedScore 用于跨来源排序
+func normalizeScores(items []models.RecommendationItem, weight float64) {
+	maxScore := 0.0
+	for _, item := range items {
+		if score := rankingScore(item); score > maxScore {
+			maxScore = score
+		}
+	}
+	for i := range items {
+		normalized := 1.0
+		if maxScore > 0 {
+			normalized = rankingScore(items[i]) / maxScore
+		}
+		items[i].FusedScore = normalized * weight
+	}
+}
+
+// applySourceQuotas 按给定顺序选取结果，每个来源不超过其配额；
+// 某个来源候选不足时，剩余位置由其他来源超出配额的结果按原顺序补在末尾，不重新排序，保留多样性重排的结果顺序
+func applySourceQuotas(items []models.RecommendationItem, quotas map[string]int, topN int) []models.RecommendationItem {
+	selected := make([]models.RecommendationItem, 0, topN)
+	overflow := make([]models.RecommendationItem, 0)
+	counts := make(map[string]int)
+
+	for _, item := range items {
+		if len(selected) >= topN {
+			break
+		}
+		if quota, ok := quotas[item.Source]; ok && counts[item.Source] >= quota {
+			overflow = append(overflow, item)
+			continue
+		}
+		counts[item.Source]++
+		selected = append(selected, item)
+	}
+
+	for _, item := range overflow {
+		if len(selected) >= topN {
+			break
+		}
+		selected = append(selected, item)
+	}
+	return selected
+}
+
+// aggregate 合并两个来源的推荐内容，各来源内部保持原顺序（知识库结果已做多样性重排），
+// 来源之间按当前首条的排序分数归并；同一内容只保留首次出现的一条
+func aggregate(itemsA, itemsB []models.RecommendationItem) []models.RecommendationItem {
+	out := make([]models.RecommendationItem, 0, len(itemsA)+len(itemsB))
+	seen := make(map[string]bool)
+	add := func(it models.RecommendationItem) {
+		key := it.Source + "|" + recommendationKey(it)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		out = append(out, it)
+	}
+
+	i, j := 0, 0
+	for i < len(itemsA) || j < len(itemsB) {
+		if j >= len(itemsB) || (i < len(itemsA) && rankingScore(itemsA[i]) >= rankingScore(itemsB[j])) {
+			add(itemsA[i])
+			i++
+		} else {
+			add(itemsB[j])
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"ai_push_message/models"
+)
+
+func TestHybridMergeKeepsDiversifiedOrder(t *testing.T) {
+	kb := func(title string, score float64) models.RecommendationItem {
+		return models.RecommendationItem{Source: sourceKnowledgeBase, Title: title, FusedScore: score}
+	}
+	gs := func(title string, score float64) models.RecommendationItem {
+		return models.RecommendationItem{Source: sourceGroupSummary, Title: title, FusedScore: score}
+	}
+
+	// 多样性重排后的知识库结果不按分数降序
+	kbItems := []models.RecommendationItem{kb("k1", 1.0), kb("k2", 0.4), kb("k3", 0.9), kb("k4", 0.8)}
+	gsItems := []models.RecommendationItem{gs("g1", 0.6), gs("g2", 0.5), gs("g3", 0.1)}
+	quotas := map[string]int{sourceKnowledgeBase: 5, sourceGroupSummary: 1}
+
+	got := titles(applySourceQuotas(aggregate(kbItems, gsItems), quotas, 5))
+	// 知识库内部顺序保持 k1,k2,k3,k4；群聊总结超出配额的 g2 不入选
+	want := []string{"k1", "g1", "k2", "k3", "k4"}
+	if !slices.Equal(got, want) {
+		t.Errorf("结果为 %v，期望 %v", got, want)
+	}
+}
+
+func TestApplySourceQuotasBackfillsFromOtherSources(t *testing.T) {
+	items := []models.RecommendationItem{
+		{Source: sourceKnowledgeBase, Title: "k1"},
+		{Source: sourceKnowledgeBase, Title: "k2"},
+		{Source: sourceKnowledgeBase, Title: "k3"},
+		{Source: sourceGroupSummary, Title: "g1"},
+	}
+	quotas := map[string]int{sourceKnowledgeBase: 1, sourceGroupSummary: 3}
+
+	got := titles(applySourceQuotas(items, quotas, 3))
+	want := []string{"k1", "g1", "k2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("结果为 %v，期望 %v", got, want)
+	}
+}
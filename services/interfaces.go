@@ -12,7 +12,7 @@ type ProfileService interface {
 
 	// 为所有用户生成画像
 	GenerateProfileForAllUsers(cfg *config.Config) error
-	GenerateProfilesWithConcurrency(cfg *config.Config, cids []string, concurrency int)
+	GenerateProfilesWithConcurrency(cfg *config.Config, cids []string, concurrency int) models.StageCounts
 
 	// 验证用户是否有有效画像
 	ValidateUserProfile(cid string) (bool, error)
@@ -26,7 +26,7 @@ type RecommendationService interface {
 	// 为所有用户生成推荐内容
 	GenerateRecommendationsForAllUsers(cfg *config.Config) error
 
-	GenerateRecommendationsWithConcurrency(cfg *config.Config, cids []string, concurrency int)
+	GenerateRecommendationsWithConcurrency(cfg *config.Config, cids []string, concurrency int) models.StageCounts
 
 	// 获取用户的推荐内容
 	GetUserRecommendations(cid string) ([]models.RecommendationItem, error)
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"ai_push_message/config"
+	"ai_push_message/logger"
+)
+
+// kbSearchPlan 一次检索使用的参数，以及结果分数需要乘以的系数
+type kbSearchPlan struct {
+	params     ragSearchParams
+	multiplier float64
+}
+
+// buildKBSearchPlans 根据知识库策略和用户类型生成检索计划
+// 未配置 rag.kb_policies 时所有知识库合并为一次检索；
+// 配置后每个知识库单独检索，跳过用户类型不符合或分数系数为0的知识库
+func buildKBSearchPlans(cfg *config.Config, userType string) []kbSearchPlan {
+	if len(cfg.RAG.KBPolicies) == 0 {
+		return []kbSearchPlan{{params: defaultRAGSearchParams(cfg), multiplier: 1}}
+	}
+
+	plans := make([]kbSearchPlan, 0, len(cfg.RAG.KnowledgeIDs))
+	for _, kbID := range cfg.RAG.KnowledgeIDs {
+		policy := cfg.RAG.KBPolicies[kbID]
+
+		if len(policy.EligibleUserTypes) > 0 && !containsString(policy.EligibleUserTypes, userType) {
+			logger.Debug("用户类型不符合知识库策略，跳过检索", "knowledge_id", kbID, "user_type", userType)
+			continue
+		}
+
+		multiplier := policy.ScoreMultiplier
+		if multiplier == 0 {
+			multiplier = 1
+		}
+		if m, ok := policy.UserTypeMultipliers[userType]; ok {
+			multiplier *= m
+		}
+		if multiplier <= 0 {
+			logger.Debug("知识库分数系数为0，跳过检索", "knowledge_id", kbID, "user_type", userType)
+			continue
+		}
+
+		params := ragSearchParams{
+			KnowledgeIDs: []string{kbID},
+			TopK:         policy.TopK,
+			Threshold:    policy.Threshold,
+		}
+		if params.TopK <= 0 {
+			params.TopK = cfg.RAG.TopK
+		}
+		if params.Threshold <= 0 {
+			params.Threshold = cfg.RAG.Threshold
+		}
+		plans = append(plans, kbSearchPlan{params: params, multiplier: multiplier})
+	}
+	return plans
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// 知识库更新类型
+const (
+	KBUpdateAdd    = "add"
+	KBUpdateUpdate = "update"
+	KBUpdateDelete = "delete"
+)
+
+// KnowledgeBaseUpdateResult 知识库更新处理结果
+type KnowledgeBaseUpdateResult struct {
+	KnowledgeID     string `json:"knowledge_id"`
+	UpdateType      string `json:"update_type"`
+	AffectedUsers   int    `json:"affected_users"`        // 推荐内容中包含受影响文档的用户数
+	RemovedItems    int    `json:"removed_items"`         // 从推荐缓存中移除的条目数
+	QueuedUsers     int    `json:"queued_users"`          // 加入重新生成队列的用户数
+	InvalidatedRAGs int    `json:"invalidated_rag_cache"` // 清除的RAG检索缓存条目数
+}
+
+// ValidateWebhookRequest 校验知识库更新请求
+func ValidateWebhookRequest(req *models.WebhookRequest) error {
+	if req.KnowledgeID == "" {
+		return fmt.Errorf("knowledge_id不能为空")
+	}
+	switch req.UpdateType {
+	case KBUpdateAdd:
+	case KBUpdateUpdate, KBUpdateDelete:
+		if len(req.DocumentIDs) == 0 {
+			return fmt.Errorf("update_type为%s时document_ids不能为空", req.UpdateType)
+		}
+	default:
+		return fmt.Errorf("不支持的update_type: %s", req.UpdateType)
+	}
+	return nil
+}
+
+// HandleKnowledgeBaseUpdate 处理知识库更新通知
+// delete：从所有用户的推荐缓存中移除受影响文档；
+// update：移除受影响文档并将这些用户加入重新生成队列；
+// add：在后台用用户画像关键词探测新文档，为可能匹配的用户排队重新生成推荐
+func HandleKnowledgeBaseUpdate(cfg *config.Config, req *models.WebhookRequest) (*KnowledgeBaseUpdateResult, error) {
+	if err := ValidateWebhookRequest(req); err != nil {
+		return nil, err
+	}
+
+	logger.Info("收到知识库更新通知",
+		"knowledge_id", req.KnowledgeID,
+		"update_type", req.UpdateType,
+		"document_count", len(req.DocumentIDs))
+
+	result := &KnowledgeBaseUpdateResult{
+		KnowledgeID: req.KnowledgeID,
+		UpdateType:  req.UpdateType,
+	}
+
+	// 知识库内容已变化，先清除相关的检索缓存
+	result.InvalidatedRAGs = InvalidateRAGCache(req.KnowledgeID)
+	if req.UpdateType != KBUpdateAdd {
+		removeFallbackDocuments(req.KnowledgeID, req.DocumentIDs)
+	}
+
+	switch req.UpdateType {
+	case KBUpdateDelete, KBUpdateUpdate:
+		affected, removed, err := removeDocumentsFromRecommendations(req.KnowledgeID, req.DocumentIDs)
+		if err != nil {
+			return nil, err
+		}
+		result.AffectedUsers = len(affected)
+		result.RemovedItems = removed
+
+		if req.UpdateType == KBUpdateUpdate {
+			for _, cid := range affected {
+				if QueueRecommendationRegeneration(cfg, cid) {
+					result.QueuedUsers++
+				}
+			}
+		}
+	case KBUpdateAdd:
+		// 探测需要多次检索，放到后台执行
+		docIDs := append([]string(nil), req.DocumentIDs...)
+		go queueUsersMatchingNewDocuments(cfg, req.KnowledgeID, docIDs)
+	}
+
+	logger.Info("知识库更新通知处理完成",
+		"knowledge_id", result.KnowledgeID,
+		"update_type", result.UpdateType,
+		"affected_users", result.AffectedUsers,
+		"removed_items", result.RemovedItems,
+		"queued_users", result.QueuedUsers)
+	return result, nil
+}
+
+// removeDocumentsFromRecommendations 从所有用户的推荐缓存中移除指定文档，返回受影响用户和移除条目数
+// 先找出包含这些文档的用户，再逐个在行锁内重新读取并移除，避免覆盖并发重新生成的推荐内容
+func removeDocumentsFromRecommendations(knowledgeID string, documentIDs []string) ([]string, int, error) {
+	docSet := make(map[string]bool, len(documentIDs))
+	for _, id := range documentIDs {
+		docSet[id] = true
+	}
+	// 早期缓存的推荐项没有知识库ID，只按文档ID匹配
+	stale := func(item models.RecommendationItem) bool {
+		return item.Source == sourceKnowledgeBase && docSet[item.RefID] &&
+			(item.KnowledgeID == "" || item.KnowledgeID == knowledgeID)
+	}
+
+	all, err := repository.GetAllRecommendations()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	affected := make([]string, 0)
+	removed := 0
+	for cid, items := range all {
+		if !containsItem(items, stale) {
+			continue
+		}
+		n, err := repository.RemoveRecommendationItems(cid, stale)
+		if err != nil {
+			logger.Error("更新用户推荐缓存失败", "cid", cid, "error", err)
+			continue
+		}
+		if n > 0 {
+			removed += n
+			affected = append(affected, cid)
+		}
+	}
+
+	sort.Strings(affected)
+	return affected, removed, nil
+}
+
+// containsItem 推荐内容中是否有满足条件的推荐项
+func containsItem(items []models.RecommendationItem, match func(models.RecommendationItem) bool) bool {
+	for _, item := range items {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueUsersMatchingNewDocuments 用画像关键词在新增文档所在知识库中检索，
+// 命中新增文档（未指定文档时命中该知识库任意内容）的关键词对应的用户加入重新生成队列
+func queueUsersMatchingNewDocuments(cfg *config.Config, knowledgeID string, documentIDs []string) {
+	profileKeywords, err := repository.ListProfileKeywords()
+	if err != nil {
+		logger.Error("获取用户画像关键词失败", "error", err)
+		return
+	}
+
+	// 建立 关键词 -> 用户 的倒排索引
+	keywordUsers := make(map[string][]string)
+	for cid, keywords := range profileKeywords {
+		for _, kw := range keywords {
+			keywordUsers[kw] = append(keywordUsers[kw], cid)
+		}
+	}
+
+	// 优先探测覆盖用户最多的关键词
+	keywords := make([]string, 0, len(keywordUsers))
+	for kw := range keywordUsers {
+		keywords = append(keywords, kw)
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if len(keywordUsers[keywords[i]]) != len(keywordUsers[keywords[j]]) {
+			return len(keywordUsers[keywords[i]]) > len(keywordUsers[keywords[j]])
+		}
+		return keywords[i] < keywords[j]
+	})
+	maxProbe := cfg.Webhook.MaxProbeKeywords
+	if maxProbe <= 0 {
+		maxProbe = 200 // 默认值
+	}
+	if len(keywords) > maxProbe {
+		keywords = keywords[:maxProbe]
+	}
+
+	docSet := make(map[string]bool, len(documentIDs))
+	for _, id := range documentIDs {
+		docSet[id] = true
+	}
+
+	params := defaultRAGSearchParams(cfg)
+	params.KnowledgeIDs = []string{knowledgeID}
+
+	queued, matchedKeywords := 0, 0
+	for _, kw := range keywords {
+		items, err := searchRAG(context.Background(), cfg, kw, params)
+		if err != nil {
+			logger.Error("探测新增文档失败", "keyword", kw, "error", err)
+			continue
+		}
+
+		matched := false
+		for _, item := range items {
+			if len(docSet) == 0 || docSet[item.RefID] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		matchedKeywords++
+		for _, cid := range keywordUsers[kw] {
+			if QueueRecommendationRegeneration(cfg, cid) {
+				queued++
+			}
+		}
+	}
+
+	logger.Info("新增文档定向重新生成已排队",
+		"knowledge_id", knowledgeID,
+		"probed_keywords", len(keywords),
+		"matched_keywords", matchedKeywords,
+		"queued_users", queued)
+}
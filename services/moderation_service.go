@@ -0,0 +1,254 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// defaultRiskPassValues law/politics/ad 字段表示未命中风险的内置取值
+var defaultRiskPassValues = []string{"", "0", "0.0", "false", "null", "none", "pass", "normal", "ok", "正常", "通过", "合规", "无"}
+
+// communityRiskFilter 返回生成画像时排除风险帖子的判断函数，未启用时返回 nil
+func communityRiskFilter(cfg *config.Config) func(models.CommunityRisk) bool {
+	if !cfg.Moderation.Enabled || !cfg.Moderation.ExcludeRiskPosts {
+		return nil
+	}
+
+	passValues := cfg.Moderation.RiskPassValues
+	if len(passValues) == 0 {
+		passValues = defaultRiskPassValues
+	}
+	pass := make(map[string]bool, len(passValues))
+	for _, v := range passValues {
+		pass[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	maxScore := cfg.Moderation.MaxRiskScore
+
+	return func(risk models.CommunityRisk) bool {
+		for _, value := range []string{risk.Law, risk.Politics, risk.Ad} {
+			if isRiskFlagged(value, pass) {
+				return true
+			}
+		}
+		if maxScore > 0 {
+			if score, err := strconv.ParseFloat(strings.TrimSpace(risk.Score), 64); err == nil && score > maxScore {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isRiskFlagged 风险字段是否命中：数值大于0，或是不在放行取值中的其他内容
+func isRiskFlagged(value string, pass map[string]bool) bool {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if pass[v] {
+		return false
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return n > 0
+	}
+	return true
+}
+
+// moderateItems 审核即将推送的内容，返回可以推送的内容
+// 命中屏蔽词或被LLM判定为不合规的内容进入人工审核队列，审核通过过的内容直接放行，拒绝过的内容不再推送
+func moderateItems(cfg *config.Config, cid string, items []models.RecommendationItem) []models.RecommendationItem {
+	if !cfg.Moderation.Enabled || len(items) == 0 {
+		return items
+	}
+
+	reasons := make(map[int]string)
+	for i, item := range items {
+		if word := matchBlocklist(cfg, item); word != "" {
+			reasons[i] = "命中屏蔽词: " + word
+		}
+	}
+
+	if cfg.Moderation.LLMClassifier {
+		pending := make([]int, 0, len(items))
+		for i := range items {
+			if _, flagged := reasons[i]; !flagged {
+				pending = append(pending, i)
+			}
+		}
+		if len(pending) > 0 {
+			flagged, err := classifyItemsWithLLM(cfg, items, pending)
+			if err != nil {
+				logger.Warn("LLM内容审核失败", "cid", cid, "error", err)
+				if cfg.Moderation.LLMFailClosed {
+					for _, i := range pending {
+						reasons[i] = "LLM审核失败，转人工审核"
+					}
+				}
+			}
+			for i, reason := range flagged {
+				reasons[i] = "LLM判定不合规: " + reason
+			}
+		}
+	}
+
+	if len(reasons) == 0 {
+		return items
+	}
+
+	keys := make([]string, 0, len(reasons))
+	for i := range reasons {
+		keys = append(keys, pushItemKey(items[i]))
+	}
+	statuses, err := repository.GetModerationStatuses(cid, keys)
+	if err != nil {
+		logger.Error("查询审核状态失败", "cid", cid, "error", err)
+		statuses = map[string]string{}
+	}
+
+	allowed := make([]models.RecommendationItem, 0, len(items))
+	for i, item := range items {
+		reason, flagged := reasons[i]
+		if !flagged {
+			allowed = append(allowed, item)
+			continue
+		}
+
+		key := pushItemKey(item)
+		switch statuses[key] {
+		case models.ReviewApproved:
+			allowed = append(allowed, item)
+		case models.ReviewRejected:
+			logger.Info("内容已被审核拒绝，跳过推送", "cid", cid, "title", item.Title)
+		default:
+			if err := repository.InsertModerationReview(cid, key, item, reason); err != nil {
+				logger.Error("加入审核队列失败", "cid", cid, "title", item.Title, "error", err)
+			}
+			logger.Info("内容未通过审核，等待人工审核", "cid", cid, "title", item.Title, "reason", reason)
+		}
+	}
+	return allowed
+}
+
+// matchBlocklist 返回推送内容命中的屏蔽词，未命中时返回空串
+func matchBlocklist(cfg *config.Config, item models.RecommendationItem) string {
+	text := strings.ToLower(item.Title + "\n" + item.Content)
+	for _, word := range cfg.Moderation.Blocklist {
+		w := strings.ToLower(strings.TrimSpace(word))
+		if w != "" && strings.Contains(text, w) {
+			return word
+		}
+	}
+	return ""
+}
+
+// classifyItemsWithLLM 调用LLM判断内容是否合规，返回不合规内容的下标及原因
+func classifyItemsWithLLM(cfg *config.Config, items []models.RecommendationItem, indexes []int) (map[int]string, error) {
+	var sb strings.Builder
+	for n, i := range indexes {
+		fmt.Fprintf(&sb, "%d. 标题：%s\n内容：%s\n\n", n, items[i].Title, items[i].Content)
+	}
+
+	prompt := fmt.Sprintf(`你是内容审核员，请判断以下即将推送给用户的内容是否合规。
+出现以下情况视为不合规：违法违规、政治敏感、广告营销或诱导投资承诺收益、色情暴力、人身攻击。
+
+%s请只返回JSON，列出不合规内容的序号和原因，全部合规时 flagged 为空数组：
+{"flagged": [{"index": 0, "reason": "原因"}]}`, sb.String())
+
+	content, err := callLLMCompletion(cfg, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Flagged []struct {
+			Index  int    `json:"index"`
+			Reason string `json:"reason"`
+		} `json:"flagged"`
+	}
+	if err := json.Unmarshal([]byte(extractJSONFromText(content)), &result); err != nil {
+		return nil, fmt.Errorf("解析审核结果失败: %v", err)
+	}
+
+	flagged := make(map[int]string, len(result.Flagged))
+	for _, f := range result.Flagged {
+		if f.Index >= 0 && f.Index < len(indexes) {
+			flagged[indexes[f.Index]] = f.Reason
+		}
+	}
+	return flagged, nil
+}
+
+// ListModerationReviews 获取审核队列
+func ListModerationReviews(status string) ([]models.ModerationReview, error) {
+	return repository.ListModerationReviews(status, 200)
+}
+
+// ReviewModerationItem 人工审核：通过时立即推送该内容，拒绝后该内容不再推送给该用户
+// 先将状态从待审核改为审核结果再推送，并发审核同一条内容时只推送一次；推送失败时恢复为待审核
+func ReviewModerationItem(cfg *config.Config, id int64, approve bool) (*models.ModerationReview, error) {
+	review, err := repository.GetModerationReview(id)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status != models.ReviewPending {
+		return nil, fmt.Errorf("该内容已审核，状态为%s", review.Status)
+	}
+
+	status := models.ReviewRejected
+	if approve {
+		status = models.ReviewApproved
+	}
+	claimed, err := repository.TransitionModerationReviewStatus(id, models.ReviewPending, status)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, fmt.Errorf("该内容已由其他请求审核")
+	}
+
+	if approve {
+		if err := pushApprovedItem(cfg, review); err != nil {
+			if _, rollbackErr := repository.TransitionModerationReviewStatus(id, status, models.ReviewPending); rollbackErr != nil {
+				logger.Error("恢复审核状态失败", "id", id, "error", rollbackErr)
+			}
+			return nil, err
+		}
+	}
+	review.Status = status
+	return review, nil
+}
+
+// pushApprovedItem 推送审核通过的内容，cid 为空时群发
+func pushApprovedItem(cfg *config.Config, review *models.ModerationReview) error {
+	items := []models.RecommendationItem{review.Item}
+	if review.CID == "" {
+		excluded, err := broadcastExcludedCIDs(items)
+		if err != nil {
+			return err
+		}
+		if !sendBroadcast(cfg, items, excluded) {
+			return fmt.Errorf("群发审核通过的内容失败")
+		}
+		return nil
+	}
+
+	if err := ensureNotSuppressed(review.CID); err != nil {
+		return err
+	}
+	allowed, pushURL, err := applyPushPreferences(cfg, review.CID, items)
+	if err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("用户已退订该内容，无法推送")
+	}
+	if !sendPushRequest(pushURL, &RecommendationPushPayload{CID: review.CID}, allowed) {
+		return fmt.Errorf("推送审核通过的内容失败")
+	}
+	recordPushLogs(review.CID, allowed)
+	return nil
+}
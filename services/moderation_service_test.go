@@ -0,0 +1,161 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+)
+
+// newModerationLLM 模拟LLM接口，content 为空时返回500
+func newModerationLLM(t *testing.T, content string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content == "" {
+			http.Error(w, "服务不可用", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func moderationConfig(blocklist ...string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Moderation.Enabled = true
+	cfg.Moderation.Blocklist = blocklist
+	return cfg
+}
+
+// reviewReasons 返回加入审核队列的内容标题及原因
+func reviewReasons(t *testing.T, fake *dbtest.Fake) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	for _, s := range fake.ExecutedMatching("INSERT IGNORE INTO moderation_reviews") {
+		var item models.RecommendationItem
+		if err := json.Unmarshal([]byte(s.Args[2].(string)), &item); err != nil {
+			t.Fatalf("解析审核内容失败: %v", err)
+		}
+		out[item.Title] = s.Args[3].(string)
+	}
+	return out
+}
+
+func itemTitles(items []models.RecommendationItem) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Title)
+	}
+	return out
+}
+
+func TestModerateItemsBlocklist(t *testing.T) {
+	items := []models.RecommendationItem{
+		{Title: "稳赚不赔的项目", Content: "保证收益"},
+		{Title: "以太坊升级", Content: "技术解读"},
+		{Title: "空投活动", Content: "加群领取"},
+	}
+	cfg := moderationConfig("稳赚不赔", "加群")
+
+	t.Run("命中屏蔽词进入人工审核", func(t *testing.T) {
+		fake := dbtest.Open(t)
+		allowed := moderateItems(cfg, "u1", items)
+		if got := itemTitles(allowed); !slices.Equal(got, []string{"以太坊升级"}) {
+			t.Errorf("放行的内容为 %q，期望只有 以太坊升级", got)
+		}
+		reasons := reviewReasons(t, fake)
+		if reasons["稳赚不赔的项目"] != "命中屏蔽词: 稳赚不赔" || reasons["空投活动"] != "命中屏蔽词: 加群" || len(reasons) != 2 {
+			t.Errorf("审核队列为 %v", reasons)
+		}
+	})
+
+	t.Run("已审核的内容按审核结果处理", func(t *testing.T) {
+		fake := dbtest.Open(t)
+		fake.OnQuery("FROM moderation_reviews", dbtest.Rows([]string{"item_key", "status"},
+			[]driver.Value{pushItemKey(items[0]), models.ReviewApproved},
+			[]driver.Value{pushItemKey(items[2]), models.ReviewRejected},
+		))
+		allowed := moderateItems(cfg, "u1", items)
+		if got := itemTitles(allowed); !slices.Equal(got, []string{"稳赚不赔的项目", "以太坊升级"}) {
+			t.Errorf("放行的内容为 %q，期望审核通过的内容放行、拒绝的内容跳过", got)
+		}
+		if reasons := reviewReasons(t, fake); len(reasons) != 0 {
+			t.Errorf("已审核的内容不应重复加入审核队列: %v", reasons)
+		}
+	})
+
+	t.Run("未启用时不审核", func(t *testing.T) {
+		dbtest.Open(t)
+		disabled := moderationConfig("稳赚不赔")
+		disabled.Moderation.Enabled = false
+		if got := moderateItems(disabled, "u1", items); len(got) != len(items) {
+			t.Errorf("未启用审核时应全部放行，实际 %q", itemTitles(got))
+		}
+	})
+}
+
+func TestModerateItemsLLM(t *testing.T) {
+	items := []models.RecommendationItem{
+		{Title: "加群领空投", Content: "限时"},
+		{Title: "比特币行情", Content: "今日走势"},
+		{Title: "内幕消息", Content: "跟单必涨"},
+	}
+
+	tests := []struct {
+		name        string
+		llmContent  string // 为空表示LLM调用失败
+		failClosed  bool
+		wantAllowed []string
+		wantReasons map[string]string
+	}{
+		{
+			name:        "LLM判定不合规",
+			llmContent:  `{"flagged": [{"index": 1, "reason": "诱导投资"}]}`,
+			wantAllowed: []string{"比特币行情"},
+			wantReasons: map[string]string{"加群领空投": "命中屏蔽词: 加群", "内幕消息": "LLM判定不合规: 诱导投资"},
+		},
+		{
+			name:        "LLM失败时放行",
+			wantAllowed: []string{"比特币行情", "内幕消息"},
+			wantReasons: map[string]string{"加群领空投": "命中屏蔽词: 加群"},
+		},
+		{
+			name:        "LLM失败时转人工审核",
+			failClosed:  true,
+			wantAllowed: []string{},
+			wantReasons: map[string]string{"加群领空投": "命中屏蔽词: 加群", "比特币行情": "LLM审核失败，转人工审核", "内幕消息": "LLM审核失败，转人工审核"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := dbtest.Open(t)
+			cfg := moderationConfig("加群")
+			cfg.Moderation.LLMClassifier = true
+			cfg.Moderation.LLMFailClosed = tt.failClosed
+			cfg.SiliconFlow.BaseURL = newModerationLLM(t, tt.llmContent).URL
+
+			allowed := moderateItems(cfg, "u1", items)
+			if got := itemTitles(allowed); !slices.Equal(got, tt.wantAllowed) {
+				t.Errorf("放行的内容为 %q，期望 %q", got, tt.wantAllowed)
+			}
+			reasons := reviewReasons(t, fake)
+			if len(reasons) != len(tt.wantReasons) {
+				t.Fatalf("审核队列为 %v，期望 %v", reasons, tt.wantReasons)
+			}
+			for title, want := range tt.wantReasons {
+				if reasons[title] != want {
+					t.Errorf("%s 的审核原因为 %q，期望 %q", title, reasons[title], want)
+				}
+			}
+		})
+	}
+}
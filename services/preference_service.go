@@ -0,0 +1,187 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// GetUserPreferences 获取用户的推送偏好，没有设置时返回默认偏好
+func GetUserPreferences(cid string) (*models.UserPreferences, error) {
+	prefs, err := repository.GetUserPreferences(cid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.UserPreferences{
+			CID:                cid,
+			UnsubscribedTopics: []string{},
+			UnsubscribedKBs:    []string{},
+			PreferredChannel:   models.PushChannelDefault,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prefs.PreferredChannel == "" {
+		prefs.PreferredChannel = models.PushChannelDefault
+	}
+	return prefs, nil
+}
+
+// ValidateUserPreferences 校验并整理推送偏好，退订的话题按同义词词典规范化
+func ValidateUserPreferences(cfg *config.Config, p *models.UserPreferences) error {
+	p.UnsubscribedTopics = canonicalizeTerms(cfg, dedupePreferenceValues(p.UnsubscribedTopics))
+	p.UnsubscribedKBs = dedupePreferenceValues(p.UnsubscribedKBs)
+
+	p.PreferredChannel = strings.ToLower(strings.TrimSpace(p.PreferredChannel))
+	if p.PreferredChannel == "" {
+		p.PreferredChannel = models.PushChannelDefault
+	}
+	if p.PreferredChannel != models.PushChannelDefault {
+		if _, ok := cfg.ExternalAPI.ChannelPushURLs[p.PreferredChannel]; !ok {
+			return fmt.Errorf("不支持的推送渠道: %s，可选: %s", p.PreferredChannel, strings.Join(pushChannels(cfg), "、"))
+		}
+	}
+	return nil
+}
+
+// SaveUserPreferences 保存用户的推送偏好
+func SaveUserPreferences(p *models.UserPreferences) error {
+	if err := repository.UpsertUserPreferences(p); err != nil {
+		return err
+	}
+	logger.Info("已更新推送偏好", "cid", p.CID, "opt_out", p.OptOut, "topics", len(p.UnsubscribedTopics), "kbs", len(p.UnsubscribedKBs), "channel", p.PreferredChannel)
+	return nil
+}
+
+// pushChannels 可选的推送渠道
+func pushChannels(cfg *config.Config) []string {
+	channels := []string{models.PushChannelDefault}
+	for channel := range cfg.ExternalAPI.ChannelPushURLs {
+		if channel != models.PushChannelDefault {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels[1:])
+	return channels
+}
+
+// pushURLForChannel 推送渠道对应的接口地址，渠道未配置时使用默认地址
+func pushURLForChannel(cfg *config.Config, channel string) string {
+	if url := cfg.ExternalAPI.ChannelPushURLs[channel]; url != "" {
+		return url
+	}
+	return cfg.ExternalAPI.TagPushURL
+}
+
+// dedupePreferenceValues 去掉空白和重复的取值（不区分大小写）
+func dedupePreferenceValues(values []string) []string {
+	out := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, v := range values {
+		v = strings.Join(strings.Fields(v), " ")
+		key := strings.ToLower(v)
+		if v == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// unsubscribedReason 内容命中用户退订的话题或知识库时返回原因，否则返回空字符串
+func unsubscribedReason(prefs *models.UserPreferences, item models.RecommendationItem) string {
+	for _, kb := range prefs.UnsubscribedKBs {
+		if item.KnowledgeID != "" && strings.EqualFold(item.KnowledgeID, kb) {
+			return "退订的知识库: " + kb
+		}
+	}
+
+	text := strings.ToLower(item.Title + "\n" + item.Content)
+	keyword := synonymKey(item.SearchKeyword)
+	for _, topic := range prefs.UnsubscribedTopics {
+		if keyword != "" && keyword == synonymKey(topic) {
+			return "退订的话题: " + topic
+		}
+		if strings.Contains(text, strings.ToLower(topic)) {
+			return "退订的话题: " + topic
+		}
+	}
+	return ""
+}
+
+// applyPushPreferences 按用户的推送偏好过滤即将推送的内容，返回可以推送的内容和推送接口地址
+// 无法读取偏好时返回错误，调用方不推送并按推送失败处理，避免打扰已退订的用户，也不会漏推
+func applyPushPreferences(cfg *config.Config, cid string, items []models.RecommendationItem) ([]models.RecommendationItem, string, error) {
+	prefs, err := GetUserPreferences(cid)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取推送偏好失败: %w", err)
+	}
+	if prefs.OptOut {
+		logger.Info("用户已退订推送，跳过推送", "user_id", cid)
+		return nil, "", nil
+	}
+
+	allowed := items
+	if prefs.HasUnsubscriptions() {
+		allowed = make([]models.RecommendationItem, 0, len(items))
+		for _, item := range items {
+			if reason := unsubscribedReason(prefs, item); reason != "" {
+				logger.Debug("跳过用户退订的内容", "user_id", cid, "title", item.Title, "reason", reason)
+				continue
+			}
+			allowed = append(allowed, item)
+		}
+	}
+	return allowed, pushURLForChannel(cfg, prefs.PreferredChannel), nil
+}
+
+// broadcastExcludedCIDs 群发时需要排除的用户：全局退订，或退订了群发内容中任一话题或知识库的用户
+func broadcastExcludedCIDs(items []models.RecommendationItem) ([]string, error) {
+	prefsList, err := repository.ListUserPreferences()
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make([]string, 0)
+	for i := range prefsList {
+		prefs := &prefsList[i]
+		if prefs.OptOut {
+			excluded = append(excluded, prefs.CID)
+			continue
+		}
+		for _, item := range items {
+			if unsubscribedReason(prefs, item) != "" {
+				excluded = append(excluded, prefs.CID)
+				break
+			}
+		}
+	}
+	sort.Strings(excluded)
+	return excluded, nil
+}
+
+// FilterOptedOutCIDs 从候选用户中去掉全局退订的用户
+func FilterOptedOutCIDs(cids []string) ([]string, error) {
+	optedOut, err := repository.ListOptedOutCIDs()
+	if err != nil {
+		return nil, err
+	}
+	if len(optedOut) == 0 {
+		return cids, nil
+	}
+
+	out := make([]string, 0, len(cids))
+	for _, cid := range cids {
+		if !optedOut[cid] {
+			out = append(out, cid)
+		}
+	}
+	return out, nil
+}
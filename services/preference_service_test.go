@@ -0,0 +1,167 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+)
+
+// preferenceRow 一行 user_preferences 记录
+func preferenceRow(cid string, optOut bool, topics, kbs, channel string) []driver.Value {
+	return []driver.Value{cid, optOut, topics, kbs, channel, time.Now()}
+}
+
+var preferenceColumns = []string{"cid", "opt_out", "unsubscribed_topics", "unsubscribed_kbs", "preferred_channel", "updated_at"}
+
+func TestUnsubscribedReason(t *testing.T) {
+	prefs := &models.UserPreferences{
+		UnsubscribedTopics: []string{"比特币", "Meme"},
+		UnsubscribedKBs:    []string{"kb-news"},
+	}
+
+	tests := []struct {
+		name string
+		item models.RecommendationItem
+		want bool
+	}{
+		{"退订的知识库", models.RecommendationItem{Title: "行情", KnowledgeID: "KB-NEWS"}, true},
+		{"检索关键词为退订话题（不区分大小写）", models.RecommendationItem{Title: "行情", SearchKeyword: "MEME"}, true},
+		{"标题包含退订话题", models.RecommendationItem{Title: "MEME币暴涨"}, true},
+		{"内容包含退订话题", models.RecommendationItem{Title: "周报", Content: "本周比特币走势"}, true},
+		{"未退订的内容", models.RecommendationItem{Title: "以太坊升级", SearchKeyword: "以太坊", KnowledgeID: "kb-tech"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unsubscribedReason(prefs, tt.item); (got != "") != tt.want {
+				t.Errorf("unsubscribedReason() = %q，期望命中: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPushPreferences(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ExternalAPI.TagPushURL = "http://push/app"
+	cfg.ExternalAPI.ChannelPushURLs = map[string]string{"sms": "http://push/sms"}
+
+	items := []models.RecommendationItem{
+		{Title: "比特币行情", KnowledgeID: "kb-news"},
+		{Title: "以太坊升级", KnowledgeID: "kb-tech"},
+		{Title: "DeFi周报", KnowledgeID: "kb-defi"},
+	}
+
+	tests := []struct {
+		name      string
+		row       []driver.Value // nil 表示没有设置偏好
+		wantTitle []string
+		wantURL   string
+	}{
+		{"没有设置偏好", nil, []string{"比特币行情", "以太坊升级", "DeFi周报"}, "http://push/app"},
+		{"全局退订", preferenceRow("u1", true, "[]", "[]", "app"), nil, ""},
+		{"按话题和知识库过滤", preferenceRow("u1", false, `["比特币"]`, `["kb-defi"]`, "app"), []string{"以太坊升级"}, "http://push/app"},
+		{"使用偏好的推送渠道", preferenceRow("u1", false, "[]", "[]", "sms"), []string{"比特币行情", "以太坊升级", "DeFi周报"}, "http://push/sms"},
+		{"渠道已不在配置中时使用默认地址", preferenceRow("u1", false, "[]", "[]", "email"), []string{"比特币行情", "以太坊升级", "DeFi周报"}, "http://push/app"},
+		{"全部内容被退订", preferenceRow("u1", false, "[]", `["kb-news","kb-tech","kb-defi"]`, "sms"), []string{}, "http://push/sms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := dbtest.Open(t)
+			if tt.row != nil {
+				fake.OnQuery("FROM user_preferences", dbtest.Rows(preferenceColumns, tt.row))
+			}
+
+			allowed, url, err := applyPushPreferences(cfg, "u1", items)
+			if err != nil {
+				t.Fatalf("应用推送偏好失败: %v", err)
+			}
+			got := make([]string, 0, len(allowed))
+			for _, item := range allowed {
+				got = append(got, item.Title)
+			}
+			if tt.wantTitle == nil {
+				if allowed != nil {
+					t.Errorf("全局退订时不应推送，实际 %q", got)
+				}
+			} else if !slices.Equal(got, tt.wantTitle) {
+				t.Errorf("可推送的内容为 %q，期望 %q", got, tt.wantTitle)
+			}
+			if url != tt.wantURL {
+				t.Errorf("推送地址为 %q，期望 %q", url, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestApplyPushPreferencesFailsClosed(t *testing.T) {
+	fake := dbtest.Open(t)
+	fake.OnQuery("FROM user_preferences", func([]driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, errors.New("连接中断")
+	})
+
+	allowed, _, err := applyPushPreferences(&config.Config{}, "u1", []models.RecommendationItem{{Title: "比特币行情"}})
+	if err == nil || allowed != nil {
+		t.Errorf("读取偏好失败时返回 %v, %v，期望不推送并返回错误", allowed, err)
+	}
+}
+
+func TestValidateUserPreferencesChannel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ExternalAPI.ChannelPushURLs = map[string]string{"sms": "http://push/sms"}
+
+	tests := []struct {
+		channel string
+		want    string
+		wantErr bool
+	}{
+		{"", models.PushChannelDefault, false},
+		{" SMS ", "sms", false},
+		{models.PushChannelDefault, models.PushChannelDefault, false},
+		{"email", "", true},
+	}
+	for _, tt := range tests {
+		p := &models.UserPreferences{PreferredChannel: tt.channel}
+		err := ValidateUserPreferences(cfg, p)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("渠道 %q 校验结果为 %v，期望出错: %v", tt.channel, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && p.PreferredChannel != tt.want {
+			t.Errorf("渠道 %q 整理后为 %q，期望 %q", tt.channel, p.PreferredChannel, tt.want)
+		}
+	}
+
+	p := &models.UserPreferences{UnsubscribedTopics: []string{" Meme ", "meme", "", "NFT"}, UnsubscribedKBs: []string{"kb-1", "KB-1"}}
+	if err := ValidateUserPreferences(cfg, p); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if !slices.Equal(p.UnsubscribedTopics, []string{"Meme", "NFT"}) || !slices.Equal(p.UnsubscribedKBs, []string{"kb-1"}) {
+		t.Errorf("去重后退订话题为 %q，知识库为 %q", p.UnsubscribedTopics, p.UnsubscribedKBs)
+	}
+}
+
+func TestBroadcastExcludedCIDs(t *testing.T) {
+	fake := dbtest.Open(t)
+	fake.OnQuery("FROM user_preferences", dbtest.Rows(preferenceColumns,
+		preferenceRow("opted-out", true, "[]", "[]", "app"),
+		preferenceRow("no-meme", false, `["Meme"]`, "[]", "app"),
+		preferenceRow("no-news", false, "[]", `["kb-news"]`, "app"),
+		preferenceRow("no-nft", false, `["NFT"]`, "[]", "app"),
+	))
+
+	got, err := broadcastExcludedCIDs([]models.RecommendationItem{
+		{Title: "今日热点", Content: "Meme币行情", KnowledgeID: "kb-hot"},
+		{Title: "新闻", KnowledgeID: "kb-news"},
+	})
+	if err != nil {
+		t.Fatalf("获取群发排除用户失败: %v", err)
+	}
+	if want := []string{"no-meme", "no-news", "opted-out"}; !slices.Equal(got, want) {
+		t.Errorf("群发排除的用户为 %q，期望 %q", got, want)
+	}
+}
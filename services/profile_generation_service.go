@@ -5,12 +5,17 @@ import (
 	"ai_push_message/logger"
 	"ai_push_message/models"
 	"ai_push_message/repository"
+	"context"
 	"database/sql"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// decayPersistDelta 没有新内容的用户，关键词权重累计下降达到该值（或有关键词被移除）才保存衰减后的画像，
+// 避免每天为不活跃用户写入新的画像版本
+const decayPersistDelta = 0.05
+
 // GenerateProfileForAllUsers 为所有候选用户生成画像（并发版）
 func GenerateProfileForAllUsers(cfg *config.Config) error {
 	logger.Info("开始为所有候选用户生成画像")
@@ -36,6 +41,11 @@ func GenerateProfileForUser(cfg *config.Config, cid string) (*models.UserProfile
 		return nil, false, fmt.Errorf("invalid CID")
 	}
 
+	// 已删除数据的用户不再生成画像
+	if err := ensureNotSuppressed(cid); err != nil {
+		return nil, false, err
+	}
+
 	lookbackDays := cfg.Cron.LookbackDays
 
 	// 查询现有画像
@@ -50,80 +60,157 @@ func GenerateProfileForUser(cfg *config.Config, cid string) (*models.UserProfile
 	}
 
 	// 聚合用户数据
-	userData, err := repository.GetCombinedUserData(cid, lookbackDays, lastTime)
+	userData, err := repository.GetCombinedUserData(cid, lookbackDays, lastTime, communityRiskFilter(cfg))
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to get user data: %w", err)
 	}
+	if userData.ExcludedPosts > 0 {
+		logger.Info("排除有风险标记的社区帖子", "user_id", cid, "count", userData.ExcludedPosts)
+	}
 
-	// 用户完全没有数据，不生成画像
-	if !userData.HasCommunityData && !userData.HasGroupData {
-		return existingProfile, false, nil // 返回 false 表示没有重新生成
+	// 用户没有内容数据时不生成画像；还没有画像但有入群记录的用户按群组冷启动
+	hasContent := userData.HasCommunityData || userData.HasGroupData || userData.HasSessionData
+	if !hasContent && (existingProfile != nil || !userData.HasMembershipData) {
+		if existingProfile == nil {
+			return nil, false, nil // 返回 false 表示没有重新生成
+		}
+		// 长期没有新内容的用户也要衰减旧关键词，否则不活跃用户的兴趣永远不会过期
+		return decayInactiveProfile(cfg, existingProfile)
 	}
 
-	// 调用 RAG 生成画像 (返回 JSON 字符串和关键词 JSON)
-	newProfileJSON, newKeywordsJSON, err := fetchUserProfileFromRAGWithData(cfg, cid, userData)
+	// 调用 RAG 生成画像
+	newProfile, source, err := fetchUserProfileFromRAGWithData(cfg, cid, userData)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to generate profile: %w", err)
 	}
 
+	// 记录画像版本的来源，降级生成的画像不使用模型和提示词
+	history := &models.ProfileHistory{Source: source}
+	if source == models.ProfileSourceLLM {
+		history.Model = cfg.SiliconFlow.Model
+		history.PromptVersion = profilePromptVersion
+	}
+
 	// 如果已有旧画像，进行合并
 	if existingProfile != nil {
 		logger.Info("合并新旧用户画像", "user_id", cid)
-		mergedProfileJSON, mergedKeywordsJSON, err := mergeProfiles(
-			existingProfile.ProfileRaw,
-			newProfileJSON,
-			existingProfile.Keywords,
-			newKeywordsJSON)
+		oldProfile, err := models.ParseUserProfile(existingProfile)
 		if err != nil {
-			logger.Error("合并用户画像失败", "user_id", cid, "error", err)
+			logger.Error("解析旧画像失败", "user_id", cid, "error", err)
 			return nil, false, err
 		}
-		newProfileJSON = mergedProfileJSON
-		newKeywordsJSON = mergedKeywordsJSON
+		newProfile = models.MergeProfilesWithDecay(oldProfile, newProfile, profileKeywordDecay(cfg))
+		history.Source = models.ProfileSourceMerge
+	}
+
+	// 存储前按同义词词典规范化关键词
+	normalizeProfileKeywords(cfg, newProfile)
+
+	// 最后应用人工覆盖设置，保证人工修改不被生成结果覆盖
+	if err := applyProfileOverrides(cid, newProfile); err != nil {
+		return nil, false, fmt.Errorf("failed to apply profile overrides: %w", err)
+	}
+
+	profileJSON, keywordsJSON, err := newProfile.Encode()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode profile: %w", err)
 	}
 
 	// 构造 UserProfile
 	profile := &models.UserProfile{
 		CID:        cid,
-		ProfileRaw: newProfileJSON,
-		Keywords:   newKeywordsJSON,
+		ProfileRaw: profileJSON,
+		Keywords:   keywordsJSON,
 	}
 
-	// Upsert 到数据库
-	if err := repository.UpsertProfile(profile); err != nil {
+	// Upsert 到数据库，同时追加历史版本
+	if err := repository.UpsertProfileWithHistory(profile, history); err != nil {
 		return nil, false, fmt.Errorf("failed to save profile: %w", err)
 	}
 
 	return profile, true, nil // 返回 true 表示重新生成了画像
 }
 
-// 并发生成用户画像
-func GenerateProfilesWithConcurrency(cfg *config.Config, cids []string, concurrency int) {
+// decayInactiveProfile 没有新内容时对已有画像做关键词衰减，变化明显时保存为新版本，返回是否保存了新画像
+func decayInactiveProfile(cfg *config.Config, existing *models.UserProfile) (*models.UserProfile, bool, error) {
+	oldProfile, err := models.ParseUserProfile(existing)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse existing profile: %w", err)
+	}
+	decayed, changed := models.DecayKeywords(oldProfile, profileKeywordDecay(cfg), decayPersistDelta)
+	if !changed {
+		return existing, false, nil
+	}
+
+	// 人工置顶和屏蔽的关键词不受衰减影响
+	if err := applyProfileOverrides(existing.CID, decayed); err != nil {
+		return nil, false, fmt.Errorf("failed to apply profile overrides: %w", err)
+	}
+	profileJSON, keywordsJSON, err := decayed.Encode()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode profile: %w", err)
+	}
+	profile := &models.UserProfile{
+		CID:        existing.CID,
+		ProfileRaw: profileJSON,
+		Keywords:   keywordsJSON,
+	}
+	if err := repository.UpsertProfileWithHistory(profile, &models.ProfileHistory{Source: models.ProfileSourceDecay}); err != nil {
+		return nil, false, fmt.Errorf("failed to save profile: %w", err)
+	}
+	logger.Info("用户没有新内容，保存衰减后的画像", "user_id", existing.CID, "keywords", len(decayed.WeightedKeywords))
+	return profile, true, nil
+}
+
+// profileKeywordDecay 合并画像时使用的关键词衰减参数
+func profileKeywordDecay(cfg *config.Config) models.KeywordDecay {
+	return models.KeywordDecay{
+		HalfLife:       time.Duration(cfg.Profile.DecayHalfLifeDays * float64(24*time.Hour)),
+		PruneThreshold: cfg.Profile.PruneThreshold,
+	}
+}
+
+// 并发生成用户画像，返回处理、重新生成和失败的用户数
+func GenerateProfilesWithConcurrency(cfg *config.Config, cids []string, concurrency int) models.StageCounts {
+	return GenerateProfilesWithCheckpoint(context.Background(), cfg, cids, concurrency, nil)
+}
+
+// GenerateProfilesWithCheckpoint 并发生成用户画像，跳过检查点中已完成的用户并记录每个用户的结果
+// ctx 取消后不再开始处理新的用户，已开始的用户处理完成后返回
+func GenerateProfilesWithCheckpoint(ctx context.Context, cfg *config.Config, cids []string, concurrency int, cp *RunCheckpoint) models.StageCounts {
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, concurrency)
 
 	var mu sync.Mutex
-	processed, failed, regenerated := 0, 0, 0
+	var counts models.StageCounts
+	cids, counts.Skipped = cp.pending(cids)
+	if counts.Skipped > 0 {
+		logger.Info("跳过已生成画像的用户", "count", counts.Skipped)
+	}
 
 	for _, cid := range cids {
+		if !acquireSlot(ctx, semaphore) {
+			logger.Warn("任务已取消，停止生成用户画像", "error", context.Cause(ctx))
+			break
+		}
 		wg.Add(1)
-		semaphore <- struct{}{} // acquire semaphore
 
 		go func(userCID string) {
 			defer wg.Done()
 			defer func() { <-semaphore }() // release semaphore
 
 			_, profileRegenerated, err := GenerateProfileForUser(cfg, userCID)
+			cp.Finish(userCID, err)
 			mu.Lock()
 			defer mu.Unlock()
-			processed++
+			counts.Processed++
 			if err != nil {
-				failed++
+				counts.AddError(userCID, err)
 				logger.Error("生成用户画像失败", "cid", userCID, "error", err)
 				return
 			}
 			if profileRegenerated {
-				regenerated++
+				counts.Regenerated++
 				logger.Info("成功生成用户画像", "cid", userCID)
 			} else {
 				logger.Debug("用户画像无需更新", "cid", userCID)
@@ -133,9 +220,16 @@ func GenerateProfilesWithConcurrency(cfg *config.Config, cids []string, concurre
 
 	wg.Wait()
 	logger.Info("所有用户画像生成完成",
-		"processed", processed,
-		"regenerated", regenerated,
-		"skipped", processed-regenerated-failed,
-		"failed", failed,
+		"processed", counts.Processed,
+		"regenerated", counts.Regenerated,
+		"skipped", counts.Processed-counts.Regenerated-counts.Failed,
+		"failed", counts.Failed,
 	)
+
+	// 画像更新后重新计算用户分群，并重建相似用户索引
+	if err := RefreshSegments(); err != nil {
+		logger.Error("重新计算用户分群失败", "error", err)
+	}
+	invalidateSimilarityIndex()
+	return counts
 }
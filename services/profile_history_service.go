@@ -0,0 +1,134 @@
+package services
+
+import (
+	"sort"
+
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// 画像历史每次最多返回的版本数
+const maxProfileHistoryLimit = 100
+
+// ListProfileHistory 获取用户的画像历史版本，按时间倒序，每个版本附带解析后的画像
+func ListProfileHistory(cid string, limit int) ([]models.ProfileHistory, error) {
+	if limit <= 0 || limit > maxProfileHistoryLimit {
+		limit = 20 // 默认值
+	}
+
+	history, err := repository.ListProfileHistory(cid, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		attachHistoryProfile(&history[i])
+	}
+	return history, nil
+}
+
+// DiffProfileVersions 比较用户的两个画像版本
+// toID 为0时使用最新版本，fromID 为0时使用 to 之前的一个版本；版本不存在时返回 sql.ErrNoRows
+func DiffProfileVersions(cid string, fromID, toID int64) (*models.ProfileDiff, error) {
+	var (
+		to  *models.ProfileHistory
+		err error
+	)
+	if toID > 0 {
+		to, err = repository.GetProfileHistory(cid, toID)
+	} else {
+		to, err = repository.GetLatestProfileHistory(cid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var from *models.ProfileHistory
+	if fromID > 0 {
+		from, err = repository.GetProfileHistory(cid, fromID)
+	} else {
+		from, err = repository.GetPreviousProfileHistory(cid, to.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attachHistoryProfile(from)
+	attachHistoryProfile(to)
+	diff := diffProfiles(from.Profile, to.Profile)
+	diff.CID = cid
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
+
+// attachHistoryProfile 解析历史版本中的画像，解析失败时画像为空
+func attachHistoryProfile(h *models.ProfileHistory) {
+	profile, err := models.ParseUserProfile(&models.UserProfile{CID: h.CID, ProfileRaw: h.ProfileRaw, Keywords: h.Keywords})
+	if err != nil {
+		profile = &models.Profile{}
+	}
+	h.Profile = profile
+}
+
+// diffProfiles 计算兴趣的增减和关键词权重的变化
+func diffProfiles(from, to *models.Profile) *models.ProfileDiff {
+	diff := &models.ProfileDiff{
+		AddedInterests:   make([]string, 0),
+		RemovedInterests: make([]string, 0),
+		AddedKeywords:    make([]models.KeywordWeightChange, 0),
+		RemovedKeywords:  make([]models.KeywordWeightChange, 0),
+		ChangedKeywords:  make([]models.KeywordWeightChange, 0),
+	}
+
+	fromInterests := make(map[string]bool, len(from.Interests))
+	for _, interest := range from.Interests {
+		fromInterests[interest] = true
+	}
+	toInterests := make(map[string]bool, len(to.Interests))
+	for _, interest := range to.Interests {
+		toInterests[interest] = true
+		if !fromInterests[interest] {
+			diff.AddedInterests = append(diff.AddedInterests, interest)
+		}
+	}
+	for _, interest := range from.Interests {
+		if !toInterests[interest] {
+			diff.RemovedInterests = append(diff.RemovedInterests, interest)
+		}
+	}
+
+	fromWeights := make(map[string]float64, len(from.WeightedKeywords))
+	for _, wk := range from.WeightedKeywords {
+		fromWeights[wk.Keyword] = wk.Weight
+	}
+	toWeights := make(map[string]float64, len(to.WeightedKeywords))
+	for _, wk := range to.WeightedKeywords {
+		toWeights[wk.Keyword] = wk.Weight
+		oldWeight, ok := fromWeights[wk.Keyword]
+		switch {
+		case !ok:
+			diff.AddedKeywords = append(diff.AddedKeywords, models.KeywordWeightChange{Keyword: wk.Keyword, NewWeight: wk.Weight})
+		case oldWeight != wk.Weight:
+			diff.ChangedKeywords = append(diff.ChangedKeywords, models.KeywordWeightChange{Keyword: wk.Keyword, OldWeight: oldWeight, NewWeight: wk.Weight})
+		}
+	}
+	for _, wk := range from.WeightedKeywords {
+		if _, ok := toWeights[wk.Keyword]; !ok {
+			diff.RemovedKeywords = append(diff.RemovedKeywords, models.KeywordWeightChange{Keyword: wk.Keyword, OldWeight: wk.Weight})
+		}
+	}
+
+	// 权重变化大的排在前面
+	sort.SliceStable(diff.ChangedKeywords, func(i, j int) bool {
+		return weightDelta(diff.ChangedKeywords[i]) > weightDelta(diff.ChangedKeywords[j])
+	})
+	return diff
+}
+
+// weightDelta 权重变化的绝对值
+func weightDelta(c models.KeywordWeightChange) float64 {
+	if c.NewWeight > c.OldWeight {
+		return c.NewWeight - c.OldWeight
+	}
+	return c.OldWeight - c.NewWeight
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// GetProfileOverrides 获取用户的画像覆盖设置，没有设置时返回空设置
+func GetProfileOverrides(cid string) (*models.ProfileOverrides, error) {
+	overrides, err := repository.GetProfileOverrides(cid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.ProfileOverrides{
+			CID:             cid,
+			PinnedKeywords:  []models.WeightedKeyword{},
+			BlockedKeywords: []string{},
+		}, nil
+	}
+	return overrides, err
+}
+
+// ValidateProfileOverrides 校验并整理画像覆盖设置
+// 固定和屏蔽的关键词按同义词词典规范化，与规范化后的画像关键词一致
+func ValidateProfileOverrides(cfg *config.Config, o *models.ProfileOverrides) error {
+	pinned := make([]models.WeightedKeyword, 0, len(o.PinnedKeywords))
+	seen := make(map[string]bool)
+	for _, wk := range o.PinnedKeywords {
+		wk.Keyword = strings.Join(strings.Fields(wk.Keyword), " ")
+		if wk.Keyword == "" {
+			continue
+		}
+		if wk.Weight <= 0 || wk.Weight > 1 {
+			return fmt.Errorf("固定关键词 %s 的权重必须在0-1之间", wk.Keyword)
+		}
+		if terms := canonicalizeTerms(cfg, []string{wk.Keyword}); len(terms) == 1 {
+			wk.Keyword = terms[0]
+		}
+		key := strings.ToLower(wk.Keyword)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		pinned = append(pinned, models.WeightedKeyword{Keyword: wk.Keyword, Weight: wk.Weight})
+	}
+
+	blocked := make([]string, 0, len(o.BlockedKeywords))
+	blockedSeen := make(map[string]bool)
+	for _, kw := range o.BlockedKeywords {
+		kw = strings.Join(strings.Fields(kw), " ")
+		if terms := canonicalizeTerms(cfg, []string{kw}); len(terms) == 1 {
+			kw = terms[0]
+		}
+		key := strings.ToLower(kw)
+		if kw == "" || blockedSeen[key] {
+			continue
+		}
+		if seen[key] {
+			return fmt.Errorf("关键词 %s 不能同时固定和屏蔽", kw)
+		}
+		blockedSeen[key] = true
+		blocked = append(blocked, kw)
+	}
+
+	o.UserType = strings.TrimSpace(o.UserType)
+	o.ActivityLevel = strings.ToLower(strings.TrimSpace(o.ActivityLevel))
+	if o.ActivityLevel != "" && !models.IsValidActivityLevel(o.ActivityLevel) {
+		return fmt.Errorf("activity_level只能是minimal、low、medium或high")
+	}
+
+	o.PinnedKeywords = pinned
+	o.BlockedKeywords = blocked
+	return nil
+}
+
+// SaveProfileOverrides 保存画像覆盖设置，并立即应用到用户当前的画像上
+// 画像在同一事务中锁定后读取和写回，不会覆盖并发生成的画像。返回应用后的画像，用户还没有画像时返回 nil
+func SaveProfileOverrides(cfg *config.Config, o *models.ProfileOverrides) (*models.Profile, error) {
+	if err := ensureNotSuppressed(o.CID); err != nil {
+		return nil, err
+	}
+	if err := repository.UpsertProfileOverrides(o); err != nil {
+		return nil, err
+	}
+
+	var profile *models.Profile
+	err := repository.UpdateProfileWithHistory(o.CID, &models.ProfileHistory{Source: models.ProfileSourceManual}, func(existing *models.UserProfile) (*models.UserProfile, error) {
+		parsed, err := models.ParseUserProfile(existing)
+		if err != nil {
+			return nil, err
+		}
+		normalizeProfileKeywords(cfg, parsed)
+		parsed.ApplyOverrides(o)
+
+		profileJSON, keywordsJSON, err := parsed.Encode()
+		if err != nil {
+			return nil, err
+		}
+		profile = parsed
+		return &models.UserProfile{CID: o.CID, ProfileRaw: profileJSON, Keywords: keywordsJSON}, nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("已应用画像覆盖设置", "cid", o.CID)
+	return profile, nil
+}
+
+// applyProfileOverrides 在新生成或合并后的画像上应用用户的覆盖设置
+func applyProfileOverrides(cid string, profile *models.Profile) error {
+	overrides, err := repository.GetProfileOverrides(cid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	profile.ApplyOverrides(overrides)
+	return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+)
+
+func TestSaveProfileOverridesLocksProfile(t *testing.T) {
+	fake := dbtest.Open(t)
+	fake.OnQuery("FROM user_suppressions", dbtest.Rows([]string{"count"}, []driver.Value{int64(0)}))
+	locked := false
+	fake.OnQuery("FROM user_profiles WHERE cid = ? FOR UPDATE", func([]driver.Value) ([]string, [][]driver.Value, error) {
+		locked = true
+		return []string{"cid", "profile_json", "keywords", "updated_at"}, [][]driver.Value{{
+			"u1", `{"weighted_keywords":[{"keyword":"比特币","weight":0.9},{"keyword":"合约","weight":0.7}]}`, "[]", time.Now(),
+		}}, nil
+	})
+
+	profile, err := SaveProfileOverrides(&config.Config{}, &models.ProfileOverrides{
+		CID:             "u1",
+		PinnedKeywords:  []models.WeightedKeyword{{Keyword: "质押", Weight: 0.6}},
+		BlockedKeywords: []string{"合约"},
+	})
+	if err != nil {
+		t.Fatalf("保存覆盖设置失败: %v", err)
+	}
+	if !locked {
+		t.Error("应在事务中加锁读取画像")
+	}
+	if profile == nil || len(profile.WeightedKeywords) != 2 {
+		t.Fatalf("应用后的画像为 %+v，期望 比特币 和 质押", profile)
+	}
+
+	// 画像和历史版本在加锁的同一事务中写入
+	var order []string
+	for _, s := range fake.Executed() {
+		switch {
+		case strings.Contains(s.Query, "INSERT INTO user_profiles"):
+			order = append(order, "profile")
+		case strings.Contains(s.Query, "INSERT INTO user_profile_history"):
+			order = append(order, "history")
+			if s.Args[3] != models.ProfileSourceManual {
+				t.Errorf("历史来源为 %v，期望 %s", s.Args[3], models.ProfileSourceManual)
+			}
+		case s.Query == "COMMIT":
+			order = append(order, "commit")
+		}
+	}
+	if strings.Join(order, ",") != "profile,history,commit" {
+		t.Errorf("执行顺序为 %v，期望 画像、历史版本后提交", order)
+	}
+}
+
+func TestSaveProfileOverridesWithoutProfile(t *testing.T) {
+	fake := dbtest.Open(t)
+	fake.OnQuery("FROM user_suppressions", dbtest.Rows([]string{"count"}, []driver.Value{int64(0)}))
+
+	profile, err := SaveProfileOverrides(&config.Config{}, &models.ProfileOverrides{CID: "u1", BlockedKeywords: []string{"合约"}})
+	if err != nil || profile != nil {
+		t.Fatalf("没有画像时返回 %+v, %v，期望 nil, nil", profile, err)
+	}
+	if len(fake.ExecutedMatching("INSERT INTO user_profile_overrides")) != 1 {
+		t.Error("没有画像时也应保存覆盖设置")
+	}
+	if len(fake.ExecutedMatching("INSERT INTO user_profile_history")) != 0 {
+		t.Error("没有画像时不应写入历史版本")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"ai_push_message/models"
 	"ai_push_message/repository"
 	"database/sql"
-	"encoding/json"
 )
 
 func LoadUserProfile(cid string) (*models.UserProfile, error) {
@@ -18,13 +17,16 @@ func LoadUserProfile(cid string) (*models.UserProfile, error) {
 	return p, nil
 }
 
+// ExtractKeywords 按权重顺序返回用户画像中的关键词
 func ExtractKeywords(p *models.UserProfile) []string {
-	if p == nil || p.Keywords == "" {
+	if p == nil {
 		return nil
 	}
-	var arr []string
-	_ = json.Unmarshal([]byte(p.Keywords), &arr)
-	return arr
+	profile, err := models.ParseUserProfile(p)
+	if err != nil {
+		return nil
+	}
+	return profile.Keywords()
 }
 
 // ValidateUserProfile 检查用户是否有画像
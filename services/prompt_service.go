@@ -8,6 +8,9 @@ import (
 	"strings"
 )
 
+// profilePromptVersion 用户画像提示词版本，修改 buildUserAnalysisPrompt 的内容时同步更新，记录在画像历史中
+const profilePromptVersion = "v4"
+
 // 不再需要simplifyPrompt函数，直接使用splitPrompt进行分段处理
 
 // splitPrompt 将提示词分成多个部分，参考ai_center中的群总结分段逻辑
@@ -51,14 +54,18 @@ func splitPrompt(cfg *config.Config, prompt string) []string {
 }
 
 // buildUserAnalysisPrompt 构建用户分析提示词
-func buildUserAnalysisPrompt(cid string, userData *repository.CombinedUserData) string {
+func buildUserAnalysisPrompt(cfg *config.Config, cid string, userData *repository.CombinedUserData) string {
+	weights := profileSourceWeights(cfg)
 	prompt := fmt.Sprintf(`请分析用户 %s 的行为数据，生成用户画像标签。
 
-用户数据来源：
-- 社区发帖数据：%d 条
-- 群聊消息数据：%d 条  
+用户数据来源（括号内为该来源的权重，权重越高越能代表用户的真实兴趣）：
+- 社区发帖数据：%d 条（权重 %.1f），其中%s
+- 群聊消息数据：%d 条（权重 %.1f）
+- AI助手提问数据：%d 条（权重 %.1f）
 - 活跃群组：%v
+- 已加入的群组：%v
 - 群组兴趣：%v
+- AI助手会话主题：%v
 
 社区发帖内容：
 %s
@@ -66,6 +73,9 @@ func buildUserAnalysisPrompt(cid string, userData *repository.CombinedUserData)
 群聊消息内容：
 %s
 
+AI助手提问内容：
+%s
+
 请基于以上数据分析用户的兴趣偏好，生成能够搜索"DW20与比特币的比较"和"无链常见问题问答"等知识库内容的标签。
 
 要求：
@@ -74,6 +84,8 @@ func buildUserAnalysisPrompt(cid string, userData *repository.CombinedUserData)
 3. 生成便于知识库搜索的关键词标签，并为每个关键词分配权重（0-1之间的浮点数）
 4. 标签应涵盖：技术兴趣、投资偏好、产品使用、问题类型等维度
 5. 关键词按权重从高到低排序，权重高的关键词表示用户更关注的内容
+6. 计算关键词权重时参考其来源的权重，用户主动向AI助手提出的问题通常最能反映其需求
+7. 社区内容按行为类型标注（发帖/评论/转发/点赞），同样参考各行为的权重，只点赞或转发而很少发帖的用户也应从其互动内容中提取兴趣
 
 请以JSON格式返回分析结果：
 {
@@ -87,12 +99,43 @@ func buildUserAnalysisPrompt(cid string, userData *repository.CombinedUserData)
   "user_type": "投资者/技术爱好者/新手"
 }`,
 		cid,
-		len(userData.CommunityPosts),
-		len(userData.GroupMessages),
+		len(userData.CommunityPosts), weights.communityPosts,
+		describeCommunityBehaviors(cfg, userData.CommunityPosts, userData.CommunityBehaviors),
+		len(userData.GroupMessages), weights.groupMessages,
+		len(userData.AssistantQuestions), weights.assistantSessions,
 		userData.ActiveGroups,
+		userData.JoinedGroups,
 		userData.GroupInterests,
-		strings.Join(userData.CommunityPosts, "\n---\n"),
-		strings.Join(userData.GroupMessages, "\n---\n"))
+		userData.SessionTitles,
+		strings.Join(labelCommunityPosts(cfg, userData.CommunityPosts, userData.CommunityBehaviors), "\n---\n"),
+		strings.Join(userData.GroupMessages, "\n---\n"),
+		strings.Join(userData.AssistantQuestions, "\n---\n"))
 
 	return prompt
 }
+
+// sourceWeights 各数据来源的权重
+type sourceWeights struct {
+	communityPosts    float64
+	groupMessages     float64
+	assistantSessions float64
+}
+
+// profileSourceWeights 从配置读取各数据来源的权重
+func profileSourceWeights(cfg *config.Config) sourceWeights {
+	w := sourceWeights{
+		communityPosts:    cfg.Profile.SourceWeights.CommunityPosts,
+		groupMessages:     cfg.Profile.SourceWeights.GroupMessages,
+		assistantSessions: cfg.Profile.SourceWeights.AssistantSessions,
+	}
+	if w.communityPosts <= 0 {
+		w.communityPosts = 1.0 // 默认值
+	}
+	if w.groupMessages <= 0 {
+		w.groupMessages = 0.8 // 默认值
+	}
+	if w.assistantSessions <= 0 {
+		w.assistantSessions = 1.5 // 默认值
+	}
+	return w
+}
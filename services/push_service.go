@@ -2,11 +2,14 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -18,43 +21,126 @@ import (
 	"ai_push_message/utils"
 )
 
-func aggregate(itemsA, itemsB []models.RecommendationItem, topN int) []models.RecommendationItem {
-	m := map[string]models.RecommendationItem{}
-	for _, it := range append(itemsA, itemsB...) {
-		key := it.Source + "|" + it.RefID + "|" + it.Title
-		if old, ok := m[key]; ok {
-			if it.Score > old.Score {
-				m[key] = it
-			}
-		} else {
-			m[key] = it
-		}
-	}
-	arr := make([]models.RecommendationItem, 0, len(m))
-	for _, v := range m {
-		arr = append(arr, v)
-	}
-	sort.Slice(arr, func(i, j int) bool { return arr[i].Score > arr[j].Score })
-	if topN > 0 && len(arr) > topN {
-		arr = arr[:topN]
-	}
-	return arr
-}
-
 // RecommendationPushPayload 表示推送到外部API的推荐内容数据
 type RecommendationPushPayload struct {
-	CID  string          `json:"cid,omitempty"`
-	Tags []TagPushFormat `json:"tags"`
+	CID         string          `json:"cid,omitempty"`
+	Tags        []TagPushFormat `json:"tags"`
+	ExcludeCIDs []string        `json:"exclude_cids,omitempty"` // 群发时不推送的用户（已退订）
 }
 
+// errPushFailed 推送接口调用失败，具体原因见日志
+var errPushFailed = errors.New("推送失败")
+
 // TagPushFormat 表示推送给外部API的标签格式
 type TagPushFormat struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
 }
 
-// 通过HTTP推送内容给第三方服务器
-func pushViaHTTP(cfg *config.Config, cid string, items []models.RecommendationItem) bool {
+// pushOutcome 单个用户的推送结果
+type pushOutcome int
+
+const (
+	pushSent    pushOutcome = iota // 已推送
+	pushSkipped                    // 用户已删除数据、已退订或内容均未通过审核，没有推送
+	pushFailed                     // 推送失败
+)
+
+func (o pushOutcome) String() string {
+	switch o {
+	case pushSent:
+		return "pushed"
+	case pushSkipped:
+		return "skipped"
+	default:
+		return "failed"
+	}
+}
+
+// pushItemKey 推送内容的唯一标识（标题和内容的SHA1），第三方只收到标题和内容，点击反馈也按此标识上报
+func pushItemKey(item models.RecommendationItem) string {
+	sum := sha1.Sum([]byte(item.Title + "\n" + item.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// 通过HTTP推送内容给第三方服务器，推送前按用户的推送偏好过滤并经过内容审核，已删除数据的用户不推送
+func pushViaHTTP(cfg *config.Config, cid string, items []models.RecommendationItem) pushOutcome {
+	if err := ensureNotSuppressed(cid); err != nil {
+		if errors.Is(err, ErrUserSuppressed) {
+			logger.Info("用户已删除数据，跳过推送", "user_id", cid)
+			return pushSkipped
+		}
+		logger.Error("跳过推送", "user_id", cid, "error", err)
+		return pushFailed
+	}
+	items, pushURL, err := applyPushPreferences(cfg, cid, items)
+	if err != nil {
+		logger.Error("跳过推送", "user_id", cid, "error", err)
+		return pushFailed
+	}
+	if len(items) == 0 {
+		logger.Info("没有用户订阅的推送内容，跳过推送", "user_id", cid)
+		return pushSkipped
+	}
+	items = moderateItems(cfg, cid, items)
+	if len(items) == 0 {
+		logger.Info("推送内容均未通过审核，跳过推送", "user_id", cid)
+		return pushSkipped
+	}
+	if !sendPushRequest(pushURL, &RecommendationPushPayload{CID: cid}, items) {
+		return pushFailed
+	}
+	recordPushLogs(cid, items)
+	return pushSent
+}
+
+// broadcastViaHTTP 群发内容，排除已退订的用户，推送前经过内容审核
+func broadcastViaHTTP(cfg *config.Config, items []models.RecommendationItem) bool {
+	excluded, err := broadcastExcludedCIDs(items)
+	if err != nil {
+		// 无法确认哪些用户已退订时不群发
+		logger.Error("获取退订用户失败，跳过群发", "error", err)
+		return false
+	}
+	items = moderateItems(cfg, "", items)
+	if len(items) == 0 {
+		logger.Info("群发内容均未通过审核，跳过群发")
+		return true
+	}
+	return sendBroadcast(cfg, items, excluded)
+}
+
+// sendBroadcast 群发内容并排除 excluded 中的用户
+// 有需要排除的用户而推送接口不支持 exclude_cids 时不群发，确保退订用户收不到群发
+func sendBroadcast(cfg *config.Config, items []models.RecommendationItem, excluded []string) bool {
+	if len(excluded) == 0 {
+		return sendPushRequest(cfg.ExternalAPI.TagPushURL, &RecommendationPushPayload{}, items)
+	}
+	if !cfg.ExternalAPI.BroadcastExcludeSupported {
+		logger.Error("推送接口不支持排除已退订的用户，跳过群发", "excluded", len(excluded))
+		return false
+	}
+	logger.Info("群发排除已退订的用户", "count", len(excluded))
+	return sendPushRequest(cfg.ExternalAPI.TagPushURL, &RecommendationPushPayload{ExcludeCIDs: excluded}, items)
+}
+
+// recordPushLogs 记录推送给用户的内容，用于相似用户推荐；群发不记录
+func recordPushLogs(cid string, items []models.RecommendationItem) {
+	if cid == "" {
+		return
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, pushItemKey(item))
+	}
+	if err := repository.InsertPushLogs(cid, keys, items); err != nil {
+		logger.Error("记录推送内容失败", "user_id", cid, "error", err)
+	}
+}
+
+// sendPushRequest 调用第三方推送接口，payload 中的推送对象（cid 或排除的用户）由调用方设置
+func sendPushRequest(pushURL string, payload *RecommendationPushPayload, items []models.RecommendationItem) bool {
+	cid := payload.CID
 	// 将RecommendationItem转换为TagPushFormat（数据已在保存时过滤过特殊符号）
 	tags := make([]TagPushFormat, 0, len(items))
 	for _, item := range items {
@@ -64,15 +150,8 @@ func pushViaHTTP(cfg *config.Config, cid string, items []models.RecommendationIt
 		})
 	}
 
-	// 构建推送数据
-	payload := RecommendationPushPayload{
-		Tags: tags,
-	}
-
-	// 只有当cid非空时才设置CID字段
-	if cid != "" {
-		payload.CID = cid
-	}
+	// 构建推送数据，cid 为空时表示群发
+	payload.Tags = tags
 
 	// 序列化为JSON
 	jsonData, err := json.Marshal(payload)
@@ -86,7 +165,6 @@ func pushViaHTTP(cfg *config.Config, cid string, items []models.RecommendationIt
 	logger.Info("准备推送的数据（请求体）", "user_id", cid, "payload", string(prettyJSON))
 
 	// 准备HTTP请求
-	pushURL := cfg.ExternalAPI.TagPushURL
 	req, err := http.NewRequest("POST", pushURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		logger.Error("创建HTTP请求失败", "error", err, "user_id", cid)
@@ -179,7 +257,7 @@ func PushForCID(cfg *config.Config, cid string) error {
 	}
 
 	// 通过HTTP推送内容
-	pushOk := pushViaHTTP(cfg, cid, recommendations)
+	outcome := pushViaHTTP(cfg, cid, recommendations)
 
 	// 不再标记为已推送，API接口推送不受pushed标志限制
 
@@ -187,44 +265,81 @@ func PushForCID(cfg *config.Config, cid string) error {
 		"user_id", cid,
 		"items", len(recommendations),
 		"method", "http",
-		"success", pushOk,
+		"result", outcome.String(),
 		"cost", time.Since(start).String())
 	return nil
 }
 
-// PushAll 推送所有用户的推荐内容，不考虑pushed标志
+// PushAll 推送所有用户的推荐内容并发送热门话题群发消息，不考虑pushed标志
 func PushAll(cfg *config.Config) error {
+	_, err := PushAllWithCheckpoint(context.Background(), cfg, nil)
+	return err
+}
+
+// PushAllWithCheckpoint 推送所有用户的推荐内容并发送热门话题群发消息，返回推送的用户数，群发失败计为一次失败
+// 检查点中已推送或推送结果未知的用户（以及已发送的群发）不再推送；ctx 取消后不再开始新的推送
+func PushAllWithCheckpoint(ctx context.Context, cfg *config.Config, cp *RunCheckpoint) (models.StageCounts, error) {
+	counts, err := pushRecommendations(ctx, cfg, cp)
+	if err != nil {
+		return counts, err
+	}
+
+	//发送热门话题群发消息
+
+	if ctx.Err() != nil {
+		logger.Warn("任务已取消，跳过热门话题群发", "error", context.Cause(ctx))
+	} else if cp.Completed(broadcastCheckpointCID) {
+		logger.Info("热门话题群发消息已发送，跳过")
+	} else if claimed, err := cp.Begin(broadcastCheckpointCID); err != nil {
+		logger.Error("记录流程检查点失败，跳过热门话题群发", "error", err)
+		counts.AddError("broadcast", err)
+	} else if !claimed {
+		logger.Warn("热门话题群发已由其他执行者发送，跳过")
+	} else {
+		logger.Info("开始发送热门话题群发消息")
+		err := PushHotTopicsBroadcast(cfg)
+		cp.Finish(broadcastCheckpointCID, err)
+		if err != nil {
+			logger.Error("发送热门话题群发消息失败", "error", err)
+			counts.AddError("broadcast", err)
+		} else {
+			logger.Info("热门话题群发消息发送成功")
+		}
+	}
+
+	logger.Info("推送完成", "success", counts.Pushed, "failed", counts.Failed)
+	return counts, nil
+}
+
+// PushRecommendations 并发推送所有用户的推荐内容，返回推送成功和失败的用户数
+func PushRecommendations(cfg *config.Config) (models.StageCounts, error) {
+	return pushRecommendations(context.Background(), cfg, nil)
+}
+
+// PushRecommendationsContext 并发推送所有用户的推荐内容，ctx 取消后不再开始新的推送
+func PushRecommendationsContext(ctx context.Context, cfg *config.Config) (models.StageCounts, error) {
+	return pushRecommendations(ctx, cfg, nil)
+}
+
+// pushRecommendations 并发推送所有用户的推荐内容，跳过检查点中已推送的用户
+func pushRecommendations(ctx context.Context, cfg *config.Config, cp *RunCheckpoint) (models.StageCounts, error) {
 	logger.Info("开始推送所有用户的推荐内容")
 
 	// 直接从数据库获取所有推荐内容
 	recommendations, err := repository.GetAllRecommendations()
 	if err != nil {
 		logger.Error("获取所有推荐内容失败", "error", err)
-		return err
+		return models.StageCounts{}, err
 	}
 
 	logger.Info("找到有推荐内容的用户", "count", len(recommendations))
 
 	// 使用并发推送
-	successCount, failCount := PushRecommendationsWithConcurrency(cfg, recommendations)
-
-	//发送热门话题群发消息
-
-	logger.Info("开始发送热门话题群发消息")
-	if err := pushHotTopicsBroadcast(cfg); err != nil {
-		logger.Error("发送热门话题群发消息失败", "error", err)
-		failCount++
-	} else {
-		logger.Info("热门话题群发消息发送成功")
-		successCount++
-	}
-
-	logger.Info("推送完成", "success", successCount, "failed", failCount)
-	return nil
+	return PushRecommendationsWithConcurrency(ctx, cfg, recommendations, cp), nil
 }
 
-// pushHotTopicsBroadcast 发送热门话题群发消息（cid=""）
-func pushHotTopicsBroadcast(cfg *config.Config) error {
+// PushHotTopicsBroadcast 发送热门话题群发消息（cid=""）
+func PushHotTopicsBroadcast(cfg *config.Config) error {
 	logger.Info("开始获取前一天的热门话题用于群发")
 
 	// 获取热门话题作为推荐内容
@@ -242,7 +357,7 @@ func pushHotTopicsBroadcast(cfg *config.Config) error {
 	logger.Info("获取到热门话题", "count", len(hotTopicsRecommendations))
 
 	// 使用空的cid进行群发
-	pushOk := pushViaHTTP(cfg, "", hotTopicsRecommendations)
+	pushOk := broadcastViaHTTP(cfg, hotTopicsRecommendations)
 	if !pushOk {
 		return fmt.Errorf("热门话题群发消息发送失败")
 	}
@@ -251,8 +366,9 @@ func pushHotTopicsBroadcast(cfg *config.Config) error {
 	return nil
 }
 
-// PushRecommendationsWithConcurrency 并发推送用户推荐内容
-func PushRecommendationsWithConcurrency(cfg *config.Config, recommendations map[string][]models.RecommendationItem) (int, int) {
+// PushRecommendationsWithConcurrency 并发推送用户推荐内容，返回推送成功和失败的用户数
+// cp 不为 nil 时跳过已推送或推送结果未知的用户，并在推送前后记录检查点；ctx 取消后不再开始新的推送
+func PushRecommendationsWithConcurrency(ctx context.Context, cfg *config.Config, recommendations map[string][]models.RecommendationItem, cp *RunCheckpoint) models.StageCounts {
 	// 获取推送并发数配置
 	pushConcurrency := cfg.Cron.PushConcurrency
 
@@ -262,11 +378,20 @@ func PushRecommendationsWithConcurrency(cfg *config.Config, recommendations map[
 		items []models.RecommendationItem
 	}
 
+	var counts models.StageCounts
 	var pushList []pushItem
 	for cid, items := range recommendations {
-		if len(items) > 0 {
-			pushList = append(pushList, pushItem{cid: cid, items: items})
+		if len(items) == 0 {
+			continue
+		}
+		if cp.Completed(cid) {
+			counts.Skipped++
+			continue
 		}
+		pushList = append(pushList, pushItem{cid: cid, items: items})
+	}
+	if counts.Skipped > 0 {
+		logger.Info("跳过已推送的用户", "count", counts.Skipped)
 	}
 
 	logger.Info("开始并发推送", "total_users", len(pushList), "concurrency", pushConcurrency)
@@ -275,25 +400,55 @@ func PushRecommendationsWithConcurrency(cfg *config.Config, recommendations map[
 	semaphore := make(chan struct{}, pushConcurrency)
 
 	var mu sync.Mutex
-	var successCount, failCount int
 
 	for _, item := range pushList {
+		if !acquireSlot(ctx, semaphore) {
+			logger.Warn("任务已取消，停止推送", "error", context.Cause(ctx))
+			break
+		}
 		wg.Add(1)
-		semaphore <- struct{}{} // acquire semaphore
 
 		go func(pushData pushItem) {
 			defer wg.Done()
 			defer func() { <-semaphore }() // release semaphore
 
+			// 先领取检查点再推送，进程在推送过程中退出时恢复执行不会重复推送，同时执行的其他实例也不会重复推送
+			claimed, err := cp.Begin(pushData.cid)
+			if err != nil {
+				mu.Lock()
+				counts.Processed++
+				counts.AddError(pushData.cid, err)
+				mu.Unlock()
+				logger.Error("记录流程检查点失败，跳过推送", "cid", pushData.cid, "error", err)
+				return
+			}
+			if !claimed {
+				mu.Lock()
+				counts.Skipped++
+				mu.Unlock()
+				logger.Warn("用户已由其他执行者推送，跳过", "cid", pushData.cid)
+				return
+			}
+
 			// 通过HTTP推送内容
-			pushOk := pushViaHTTP(cfg, pushData.cid, pushData.items)
+			outcome := pushViaHTTP(cfg, pushData.cid, pushData.items)
+			if outcome == pushFailed {
+				cp.Finish(pushData.cid, errPushFailed)
+			} else {
+				cp.Finish(pushData.cid, nil)
+			}
 
 			mu.Lock()
-			if pushOk {
-				successCount++
+			counts.Processed++
+			switch outcome {
+			case pushSent:
+				counts.Pushed++
 				logger.Info("用户推送成功", "cid", pushData.cid, "items_count", len(pushData.items))
-			} else {
-				failCount++
+			case pushSkipped:
+				// 退订或未通过审核的用户没有推送，不计入已推送
+				counts.Skipped++
+			default:
+				counts.AddError(pushData.cid, errPushFailed)
 				logger.Error("用户推送失败", "cid", pushData.cid, "items_count", len(pushData.items))
 			}
 			mu.Unlock()
@@ -301,7 +456,7 @@ func PushRecommendationsWithConcurrency(cfg *config.Config, recommendations map[
 	}
 
 	wg.Wait()
-	logger.Info("并发推送完成", "success", successCount, "failed", failCount, "concurrency", pushConcurrency)
+	logger.Info("并发推送完成", "success", counts.Pushed, "skipped", counts.Skipped, "failed", counts.Failed, "concurrency", pushConcurrency)
 
-	return successCount, failCount
+	return counts
 }
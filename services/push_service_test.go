@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+)
+
+// newPushServer 模拟第三方推送接口，记录收到的请求体；推送给 failCIDs 中的用户时返回失败
+func newPushServer(t *testing.T, failCIDs ...string) (*httptest.Server, *[]RecommendationPushPayload) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []RecommendationPushPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p RecommendationPushPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("解析推送请求失败: %v", err)
+		}
+		mu.Lock()
+		received = append(received, p)
+		mu.Unlock()
+		if slices.Contains(failCIDs, p.CID) {
+			w.Write([]byte(`{"success":false,"errCode":500,"msg":"推送失败"}`))
+			return
+		}
+		w.Write([]byte(`{"success":true,"errCode":200}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+func TestSendBroadcastExclusions(t *testing.T) {
+	items := []models.RecommendationItem{{Title: "热门话题", Content: "今日热点"}}
+
+	tests := []struct {
+		name      string
+		supported bool
+		excluded  []string
+		wantOK    bool
+		wantSent  int
+	}{
+		{"没有退订用户", false, nil, true, 1},
+		{"支持排除", true, []string{"u1"}, true, 1},
+		{"不支持排除时不群发", false, []string{"u1"}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, received := newPushServer(t)
+			cfg := &config.Config{}
+			cfg.ExternalAPI.TagPushURL = srv.URL
+			cfg.ExternalAPI.BroadcastExcludeSupported = tt.supported
+
+			if got := sendBroadcast(cfg, items, tt.excluded); got != tt.wantOK {
+				t.Errorf("sendBroadcast = %v, 期望 %v", got, tt.wantOK)
+			}
+			if len(*received) != tt.wantSent {
+				t.Fatalf("推送 %d 次，期望 %d 次", len(*received), tt.wantSent)
+			}
+			for _, p := range *received {
+				if p.CID != "" {
+					t.Errorf("群发不应指定用户，实际 cid=%s", p.CID)
+				}
+				if len(p.ExcludeCIDs) != len(tt.excluded) {
+					t.Errorf("排除用户 %v，期望 %v", p.ExcludeCIDs, tt.excluded)
+				}
+			}
+		})
+	}
+}
+
+func TestPushRecommendationsCountsOutcomes(t *testing.T) {
+	fake := dbtest.Open(t)
+	fake.OnQuery("FROM user_suppressions", dbtest.Rows([]string{"count"}, []driver.Value{int64(0)}))
+	fake.OnQuery("FROM user_preferences", func(args []driver.Value) ([]string, [][]driver.Value, error) {
+		if args[0] != "optout" {
+			return nil, nil, nil
+		}
+		columns := []string{"cid", "opt_out", "unsubscribed_topics", "unsubscribed_kbs", "preferred_channel", "updated_at"}
+		return columns, [][]driver.Value{{"optout", true, "[]", "[]", "", time.Now()}}, nil
+	})
+
+	srv, received := newPushServer(t, "failed")
+	cfg := &config.Config{}
+	cfg.ExternalAPI.TagPushURL = srv.URL
+	cfg.Cron.PushConcurrency = 2
+
+	item := []models.RecommendationItem{{Title: "比特币行情", Content: "今日走势"}}
+	recs := map[string][]models.RecommendationItem{
+		"sent":   item,
+		"optout": item,
+		"failed": item,
+	}
+
+	counts := PushRecommendationsWithConcurrency(context.Background(), cfg, recs, nil)
+	if counts.Processed != 3 || counts.Pushed != 1 || counts.Skipped != 1 || counts.Failed != 1 {
+		t.Errorf("processed=%d pushed=%d skipped=%d failed=%d，期望 3/1/1/1",
+			counts.Processed, counts.Pushed, counts.Skipped, counts.Failed)
+	}
+	for _, p := range *received {
+		if p.CID == "optout" {
+			t.Error("已退订的用户不应收到推送")
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+)
+
+// ragSearchParams 一次RAG检索的参数，与归一化后的查询共同组成缓存键
+type ragSearchParams struct {
+	KnowledgeIDs []string
+	TopK         int
+	Threshold    float32
+}
+
+// defaultRAGSearchParams 使用全局rag配置的检索参数
+func defaultRAGSearchParams(cfg *config.Config) ragSearchParams {
+	return ragSearchParams{
+		KnowledgeIDs: cfg.RAG.KnowledgeIDs,
+		TopK:         cfg.RAG.TopK,
+		Threshold:    cfg.RAG.Threshold,
+	}
+}
+
+// ragCacheEntry 缓存的检索结果
+type ragCacheEntry struct {
+	key          string
+	items        []models.RecommendationItem
+	knowledgeIDs []string
+	expiresAt    time.Time
+	index        int // 在过期时间堆中的位置
+}
+
+// ragExpiryHeap 按过期时间排序的最小堆，缓存满时无需遍历即可找到最早过期的条目
+type ragExpiryHeap []*ragCacheEntry
+
+func (h ragExpiryHeap) Len() int           { return len(h) }
+func (h ragExpiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h ragExpiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ragExpiryHeap) Push(x any) {
+	entry := x.(*ragCacheEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *ragExpiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+// ragCall 正在进行中的上游检索，相同查询的并发请求共享同一次调用
+type ragCall struct {
+	done        chan struct{}
+	items       []models.RecommendationItem
+	err         error
+	generations map[string]uint64 // 发起调用时各知识库的版本
+}
+
+// ragResultCache 跨用户共享的RAG检索结果缓存
+type ragResultCache struct {
+	mu          sync.Mutex
+	entries     map[string]*ragCacheEntry
+	expiry      ragExpiryHeap // 与 entries 中的条目一一对应
+	inflight    map[string]*ragCall
+	generations map[string]uint64 // 知识库版本，知识库变更时递增
+}
+
+var ragCache = &ragResultCache{
+	entries:     make(map[string]*ragCacheEntry),
+	inflight:    make(map[string]*ragCall),
+	generations: make(map[string]uint64),
+}
+
+// allKnowledgeBases 表示全部知识库的版本键
+const allKnowledgeBases = "*"
+
+// normalizeRAGQuery 归一化查询文本：全角转半角、英文小写、合并空白
+func normalizeRAGQuery(query string) string {
+	var b strings.Builder
+	for _, r := range query {
+		switch {
+		case r == '　':
+			r = ' '
+		case r >= '！' && r <= '～':
+			r = r - '！' + '!'
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(strings.ToLower(b.String())), " ")
+}
+
+// ragCacheKey 由归一化查询、知识库ID、topk和阈值组成缓存键
+func ragCacheKey(query string, params ragSearchParams) string {
+	kbIDs := make([]string, len(params.KnowledgeIDs))
+	copy(kbIDs, params.KnowledgeIDs)
+	sort.Strings(kbIDs)
+	return fmt.Sprintf("%s|%s|%d|%g", normalizeRAGQuery(query), strings.Join(kbIDs, ","), params.TopK, params.Threshold)
+}
+
+// ragCacheTTL 缓存有效期，未配置时使用默认值，负数表示禁用缓存
+func ragCacheTTL(cfg *config.Config) time.Duration {
+	if cfg.RAG.CacheTTLSec < 0 {
+		return 0
+	}
+	if cfg.RAG.CacheTTLSec == 0 {
+		return 10 * time.Minute // 默认值
+	}
+	return time.Duration(cfg.RAG.CacheTTLSec) * time.Second
+}
+
+// acquire 查询缓存；未命中时返回进行中的调用，leader 为 true 表示调用方负责发起上游请求并调用 complete
+func (c *ragResultCache) acquire(key string, params ragSearchParams) (items []models.RecommendationItem, call *ragCall, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		if time.Now().Before(entry.expiresAt) {
+			return copyRecommendationItems(entry.items), nil, false
+		}
+		c.removeLocked(entry)
+	}
+
+	if call, ok := c.inflight[key]; ok {
+		return nil, call, false
+	}
+
+	call = &ragCall{
+		done:        make(chan struct{}),
+		generations: c.generationsLocked(params.KnowledgeIDs),
+	}
+	c.inflight[key] = call
+	return nil, call, true
+}
+
+// complete 结束上游调用，唤醒等待者；调用期间知识库未变更时写入缓存
+func (c *ragResultCache) complete(cfg *config.Config, key string, params ragSearchParams, call *ragCall, items []models.RecommendationItem, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	call.items = items
+	call.err = err
+	delete(c.inflight, key)
+	close(call.done)
+
+	ttl := ragCacheTTL(cfg)
+	if err != nil || ttl <= 0 {
+		return
+	}
+	for kbID, gen := range c.generationsLocked(params.KnowledgeIDs) {
+		if call.generations[kbID] != gen {
+			logger.Debug("知识库在检索期间发生变更，结果不写入缓存", "knowledge_id", kbID)
+			return
+		}
+	}
+
+	if old, ok := c.entries[key]; ok {
+		c.removeLocked(old)
+	}
+	c.evictLocked(cfg.RAG.CacheMaxEntries)
+	entry := &ragCacheEntry{
+		key:          key,
+		items:        copyRecommendationItems(items),
+		knowledgeIDs: params.KnowledgeIDs,
+		expiresAt:    time.Now().Add(ttl),
+	}
+	c.entries[key] = entry
+	heap.Push(&c.expiry, entry)
+}
+
+// removeLocked 删除缓存条目，调用方需持有锁
+func (c *ragResultCache) removeLocked(entry *ragCacheEntry) {
+	delete(c.entries, entry.key)
+	heap.Remove(&c.expiry, entry.index)
+}
+
+// purgeExpiredLocked 从堆顶开始删除已过期的条目，返回删除数量，调用方需持有锁
+func (c *ragResultCache) purgeExpiredLocked(now time.Time) int {
+	removed := 0
+	for len(c.expiry) > 0 && !now.Before(c.expiry[0].expiresAt) {
+		c.removeLocked(c.expiry[0])
+		removed++
+	}
+	return removed
+}
+
+// wait 等待进行中的调用完成，ctx 取消时提前返回
+func (call *ragCall) wait(ctx context.Context) ([]models.RecommendationItem, error) {
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyRecommendationItems(call.items), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// generationsLocked 返回给定知识库当前的版本快照，调用方需持有锁
+func (c *ragResultCache) generationsLocked(kbIDs []string) map[string]uint64 {
+	gens := map[string]uint64{allKnowledgeBases: c.generations[allKnowledgeBases]}
+	for _, kbID := range kbIDs {
+		gens[kbID] = c.generations[kbID]
+	}
+	return gens
+}
+
+// evictLocked 清理过期条目，超出容量时淘汰最早过期的条目，调用方需持有锁
+func (c *ragResultCache) evictLocked(maxEntries int) {
+	if maxEntries <= 0 {
+		maxEntries = 10000 // 默认值
+	}
+	if len(c.entries) < maxEntries {
+		return
+	}
+
+	c.purgeExpiredLocked(time.Now())
+	for len(c.expiry) > 0 && len(c.entries) >= maxEntries {
+		c.removeLocked(c.expiry[0])
+	}
+}
+
+// cachedRAGSearch 带缓存和请求合并的单查询检索
+// 上游请求不随单个调用方取消而中止，保证其他等待者和缓存能拿到结果
+func cachedRAGSearch(ctx context.Context, cfg *config.Config, query string, params ragSearchParams,
+	fetch func(ctx context.Context) ([]models.RecommendationItem, error)) ([]models.RecommendationItem, error) {
+	key := ragCacheKey(query, params)
+	for attempt := 0; ; attempt++ {
+		items, call, leader := ragCache.acquire(key, params)
+		if call == nil {
+			logger.Debug("RAG缓存命中", "query", query)
+			return items, nil
+		}
+
+		if leader {
+			go func() {
+				items, err := fetch(context.WithoutCancel(ctx))
+				ragCache.complete(cfg, key, params, call, items, err)
+			}()
+		} else {
+			logger.Debug("合并相同的RAG请求", "query", query)
+		}
+
+		items, err := call.wait(ctx)
+		// 合并到的是不被支持的多查询请求时，重新发起单查询
+		if errors.Is(err, errRAGMultiQueryUnsupported) && attempt == 0 {
+			continue
+		}
+		return items, err
+	}
+}
+
+// cachedRAGSearchMulti 带缓存和请求合并的多查询检索，只有未命中且无进行中调用的查询才发往上游
+func cachedRAGSearchMulti(ctx context.Context, cfg *config.Config, queries []string, params ragSearchParams,
+	fetch func(ctx context.Context, queries []string) (map[string][]models.RecommendationItem, error)) (map[string][]models.RecommendationItem, error) {
+	results := make(map[string][]models.RecommendationItem, len(queries))
+	pending := make(map[string]*ragCall)
+	leaderCalls := make(map[string]*ragCall)
+	leaders := make([]string, 0, len(queries))
+
+	for _, query := range queries {
+		items, call, leader := ragCache.acquire(ragCacheKey(query, params), params)
+		if call == nil {
+			results[query] = items
+			continue
+		}
+		pending[query] = call
+		if leader {
+			leaders = append(leaders, query)
+			leaderCalls[query] = call
+		}
+	}
+
+	logger.Debug("RAG批量检索缓存情况", "queries", len(queries), "hits", len(results), "upstream", len(leaders))
+
+	if len(leaders) > 0 {
+		go func() {
+			res, err := fetch(context.WithoutCancel(ctx), leaders)
+			for _, query := range leaders {
+				items, ok := res[query]
+				queryErr := err
+				if queryErr == nil && !ok {
+					queryErr = fmt.Errorf("RAG批量响应缺少查询结果: %s", query)
+				}
+				ragCache.complete(cfg, ragCacheKey(query, params), params, leaderCalls[query], items, queryErr)
+			}
+		}()
+	}
+
+	var firstErr error
+	for query, call := range pending {
+		items, err := call.wait(ctx)
+		if err != nil {
+			if errors.Is(err, errRAGMultiQueryUnsupported) {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			logger.Error("RAG search failed for keyword", "keyword", query, "error", err)
+			continue
+		}
+		results[query] = items
+	}
+
+	if len(results) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// InvalidateRAGCache 知识库变更时清除相关缓存，knowledgeID 为空时清除全部
+// 返回被清除的条目数
+func InvalidateRAGCache(knowledgeID string) int {
+	ragCache.mu.Lock()
+	defer ragCache.mu.Unlock()
+
+	if knowledgeID == "" {
+		knowledgeID = allKnowledgeBases
+	}
+	ragCache.generations[knowledgeID]++
+
+	removed := 0
+	for _, entry := range ragCache.entries {
+		if knowledgeID == allKnowledgeBases || containsString(entry.knowledgeIDs, knowledgeID) {
+			ragCache.removeLocked(entry)
+			removed++
+		}
+	}
+
+	logger.Info("RAG缓存已失效", "knowledge_id", knowledgeID, "removed", removed)
+	return removed
+}
+
+// PurgeExpiredRAGCache 清理已过期的缓存条目，返回清理数量
+func PurgeExpiredRAGCache() int {
+	ragCache.mu.Lock()
+	defer ragCache.mu.Unlock()
+
+	return ragCache.purgeExpiredLocked(time.Now())
+}
+
+// copyRecommendationItems 复制推荐项切片，避免调用方修改共享的缓存数据
+func copyRecommendationItems(items []models.RecommendationItem) []models.RecommendationItem {
+	if items == nil {
+		return nil
+	}
+	out := make([]models.RecommendationItem, len(items))
+	copy(out, items)
+	return out
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, target string) bool {
+	for _, s := range list {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+)
+
+// useFreshRAGCache 测试期间使用空的全局检索缓存
+func useFreshRAGCache(t *testing.T) {
+	t.Helper()
+	prev := ragCache
+	ragCache = &ragResultCache{
+		entries:     make(map[string]*ragCacheEntry),
+		inflight:    make(map[string]*ragCall),
+		generations: make(map[string]uint64),
+	}
+	t.Cleanup(func() { ragCache = prev })
+}
+
+// fillRAGCache 模拟一次完成的上游检索并写入缓存
+func fillRAGCache(t *testing.T, cfg *config.Config, query string, params ragSearchParams) {
+	t.Helper()
+	key := ragCacheKey(query, params)
+	_, call, leader := ragCache.acquire(key, params)
+	if !leader {
+		t.Fatalf("查询 %q 应未命中缓存", query)
+	}
+	ragCache.complete(cfg, key, params, call, []models.RecommendationItem{{Title: query}}, nil)
+}
+
+func TestRAGCacheTTLExpiry(t *testing.T) {
+	useFreshRAGCache(t)
+	cfg := &config.Config{}
+	params := ragSearchParams{KnowledgeIDs: []string{"kb1"}, TopK: 5}
+	key := ragCacheKey("比特币", params)
+
+	fillRAGCache(t, cfg, "比特币", params)
+	if items, call, _ := ragCache.acquire(key, params); call != nil || len(items) != 1 {
+		t.Fatal("有效期内应命中缓存")
+	}
+	// 归一化后相同的查询共用缓存
+	if _, call, _ := ragCache.acquire(ragCacheKey("  比特币 ", params), params); call != nil {
+		t.Fatal("归一化后相同的查询应命中缓存")
+	}
+
+	ragCache.entries[key].expiresAt = time.Now().Add(-time.Second)
+	heap.Fix(&ragCache.expiry, ragCache.entries[key].index)
+	if removed := PurgeExpiredRAGCache(); removed != 1 {
+		t.Errorf("清理了 %d 条过期缓存，期望 1 条", removed)
+	}
+	if _, call, leader := ragCache.acquire(key, params); call == nil || !leader {
+		t.Error("过期后应重新请求上游")
+	}
+}
+
+func TestRAGCacheEvictsEarliestExpiry(t *testing.T) {
+	useFreshRAGCache(t)
+	cfg := &config.Config{}
+	cfg.RAG.CacheMaxEntries = 2
+	params := ragSearchParams{TopK: 5}
+
+	fillRAGCache(t, cfg, "a", params)
+	fillRAGCache(t, cfg, "b", params)
+	// a 比 b 晚过期，缓存满时先淘汰 b
+	a := ragCache.entries[ragCacheKey("a", params)]
+	a.expiresAt = time.Now().Add(time.Hour)
+	heap.Fix(&ragCache.expiry, a.index)
+
+	fillRAGCache(t, cfg, "c", params)
+	if len(ragCache.entries) != 2 || len(ragCache.expiry) != 2 {
+		t.Fatalf("缓存条目数为 %d（堆 %d），期望 2", len(ragCache.entries), len(ragCache.expiry))
+	}
+	for query, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := ragCache.entries[ragCacheKey(query, params)]; ok != want {
+			t.Errorf("查询 %s 是否在缓存中: %v，期望 %v", query, ok, want)
+		}
+	}
+}
+
+func TestInvalidateRAGCacheDiscardsInflightFill(t *testing.T) {
+	useFreshRAGCache(t)
+	cfg := &config.Config{}
+	kb1 := ragSearchParams{KnowledgeIDs: []string{"kb1"}, TopK: 5}
+	kb2 := ragSearchParams{KnowledgeIDs: []string{"kb2"}, TopK: 5}
+
+	fillRAGCache(t, cfg, "以太坊", kb1)
+	fillRAGCache(t, cfg, "以太坊", kb2)
+
+	// 检索进行中知识库发生变更
+	key := ragCacheKey("比特币", kb1)
+	_, call, leader := ragCache.acquire(key, kb1)
+	if !leader {
+		t.Fatal("应由本次调用发起上游请求")
+	}
+	if removed := InvalidateRAGCache("kb1"); removed != 1 {
+		t.Errorf("清除了 %d 条缓存，期望只清除 kb1 的 1 条", removed)
+	}
+	ragCache.complete(cfg, key, kb1, call, []models.RecommendationItem{{Title: "旧内容"}}, nil)
+
+	// 等待者仍拿到本次结果，但结果不写入缓存
+	if items, err := call.wait(context.Background()); err != nil || len(items) != 1 {
+		t.Errorf("等待者应拿到检索结果，items=%v err=%v", items, err)
+	}
+	if _, ok := ragCache.entries[key]; ok {
+		t.Error("知识库变更前发起的检索结果不应写入缓存")
+	}
+	if _, ok := ragCache.entries[ragCacheKey("以太坊", kb2)]; !ok {
+		t.Error("其他知识库的缓存不应被清除")
+	}
+
+	// 变更后发起的检索正常写入缓存
+	fillRAGCache(t, cfg, "比特币", kb1)
+	if _, ok := ragCache.entries[key]; !ok {
+		t.Error("变更后发起的检索结果应写入缓存")
+	}
+}
+
+func TestCachedRAGSearchCoalescesRequests(t *testing.T) {
+	useFreshRAGCache(t)
+	cfg := &config.Config{}
+	params := ragSearchParams{TopK: 5}
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) ([]models.RecommendationItem, error) {
+		fetches.Add(1)
+		<-release
+		return []models.RecommendationItem{{Title: "比特币"}}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if items, err := cachedRAGSearch(context.Background(), cfg, "比特币", params, fetch); err != nil || len(items) != 1 {
+				t.Errorf("检索结果 items=%v err=%v", items, err)
+			}
+		}()
+	}
+	// 等所有调用方都加入进行中的请求后再返回结果
+	for {
+		ragCache.mu.Lock()
+		_, inflight := ragCache.inflight[ragCacheKey("比特币", params)]
+		ragCache.mu.Unlock()
+		if inflight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("上游请求 %d 次，期望 1 次", n)
+	}
+	if _, err := cachedRAGSearch(context.Background(), cfg, "比特币", params, fetch); err != nil || fetches.Load() != 1 {
+		t.Error("再次检索应命中缓存")
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+)
+
+var (
+	// 全局RAG并发限制，所有用户的检索请求共享
+	ragGlobalSemOnce sync.Once
+	ragGlobalSem     chan struct{}
+
+	// RAG服务不支持多查询时记录的截止时间（UnixNano），在此之前不再尝试批量请求
+	ragMultiQueryDisabledUntil atomic.Int64
+)
+
+// ragMultiQueryReprobeInterval RAG服务不支持多查询时，间隔该时长后重新尝试批量请求（服务端可能已升级）
+const ragMultiQueryReprobeInterval = 30 * time.Minute
+
+// ragMultiQueryDisabled 当前是否暂停批量请求
+func ragMultiQueryDisabled() bool {
+	return time.Now().UnixNano() < ragMultiQueryDisabledUntil.Load()
+}
+
+// disableRAGMultiQuery 暂停批量请求，ragMultiQueryReprobeInterval 后重新尝试
+func disableRAGMultiQuery() {
+	ragMultiQueryDisabledUntil.Store(time.Now().Add(ragMultiQueryReprobeInterval).UnixNano())
+}
+
+// getRAGGlobalSemaphore 获取全局RAG并发信号量
+func getRAGGlobalSemaphore(cfg *config.Config) chan struct{} {
+	ragGlobalSemOnce.Do(func() {
+		maxConcurrency := cfg.RAG.MaxConcurrency
+		if maxConcurrency <= 0 {
+			maxConcurrency = 20 // 默认值
+		}
+		ragGlobalSem = make(chan struct{}, maxConcurrency)
+	})
+	return ragGlobalSem
+}
+
+// searchKeywordsConcurrently 在单用户和全局并发限制下并行检索所有关键词
+// 关键词按传入顺序（权重从高到低）派发，每批关键词按各检索计划分别检索；
+// 同一关键词在各知识库的结果按策略调整分数后合并排序；高分结果足够时取消剩余检索
+func searchKeywordsConcurrently(cfg *config.Config, keywords []models.WeightedKeyword, plans []kbSearchPlan) []rankedList {
+	if len(keywords) == 0 || len(plans) == 0 {
+		return []rankedList{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batchSize := 1
+	if cfg.RAG.MultiQuery && !ragMultiQueryDisabled() {
+		batchSize = cfg.RAG.BatchSize
+		if batchSize <= 1 {
+			batchSize = 5 // 默认值
+		}
+	}
+
+	perUserConcurrency := cfg.RAG.PerUserConcurrency
+	if perUserConcurrency <= 0 {
+		perUserConcurrency = 3 // 默认值
+	}
+	userSem := make(chan struct{}, perUserConcurrency)
+	globalSem := getRAGGlobalSemaphore(cfg)
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		keywordHit = make(map[string][]models.RecommendationItem, len(keywords))
+		highScored = make(map[string]bool)
+	)
+
+	// 收集检索结果，并判断高分结果是否已经足够
+	collect := func(batch []models.WeightedKeyword, plan kbSearchPlan, results map[string][]models.RecommendationItem) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, wk := range batch {
+			items := results[wk.Keyword]
+			logger.Info("Found items for keyword", "keyword", wk.Keyword, "knowledge_ids", plan.params.KnowledgeIDs, "count", len(items))
+			for i := range items {
+				items[i].Source = sourceKnowledgeBase
+				items[i].Score *= plan.multiplier
+				if cfg.RAG.EarlyStopScore > 0 && items[i].Score >= cfg.RAG.EarlyStopScore {
+					highScored[recommendationKey(items[i])] = true
+				}
+			}
+			keywordHit[wk.Keyword] = append(keywordHit[wk.Keyword], items...)
+		}
+
+		if cfg.RAG.EarlyStopScore > 0 && len(highScored) >= cfg.RAG.TopK && ctx.Err() == nil {
+			logger.Info("Found enough high-score recommendations, cancelling remaining searches",
+				"high_score_count", len(highScored), "threshold", cfg.RAG.EarlyStopScore)
+			cancel()
+		}
+	}
+
+dispatch:
+	for start := 0; start < len(keywords); start += batchSize {
+		end := start + batchSize
+		if end > len(keywords) {
+			end = len(keywords)
+		}
+		batch := keywords[start:end]
+
+		for _, plan := range plans {
+			// 按权重顺序获取单用户并发槽位，已取消时停止派发
+			select {
+			case userSem <- struct{}{}:
+			case <-ctx.Done():
+				break dispatch
+			}
+
+			wg.Add(1)
+			go func(batch []models.WeightedKeyword, plan kbSearchPlan) {
+				defer wg.Done()
+				defer func() { <-userSem }()
+
+				select {
+				case globalSem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-globalSem }()
+
+				results, err := searchKeywordBatch(ctx, cfg, batch, plan.params)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("RAG search failed for keywords", "keywords", batchKeywords(batch), "error", err)
+					}
+					return
+				}
+				collect(batch, plan, results)
+			}(batch, plan)
+		}
+	}
+
+	wg.Wait()
+
+	// 按关键词顺序生成排序列表，同一关键词各知识库的结果按调整后的分数合并
+	lists := make([]rankedList, 0, len(keywords))
+	for _, wk := range keywords {
+		items := keywordHit[wk.Keyword]
+		if len(items) == 0 {
+			continue
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Score != items[j].Score {
+				return items[i].Score > items[j].Score
+			}
+			// 分数相同时按知识库和去重键排序，保证结果不受检索完成顺序影响
+			return items[i].KnowledgeID+"|"+recommendationKey(items[i]) < items[j].KnowledgeID+"|"+recommendationKey(items[j])
+		})
+		lists = append(lists, rankedList{Keyword: wk.Keyword, Weight: wk.Weight, Items: items})
+	}
+	return lists
+}
+
+// searchKeywordBatch 检索一批关键词，批量大于1时优先使用多查询请求
+func searchKeywordBatch(ctx context.Context, cfg *config.Config, batch []models.WeightedKeyword, params ragSearchParams) (map[string][]models.RecommendationItem, error) {
+	queries := batchKeywords(batch)
+
+	if len(queries) > 1 && !ragMultiQueryDisabled() {
+		results, err := searchRAGMulti(ctx, cfg, queries, params)
+		switch {
+		case err == nil:
+			return results, nil
+		case errors.Is(err, errRAGMultiQueryUnsupported):
+			disableRAGMultiQuery()
+			logger.Warn("RAG服务不支持多查询，降级为逐个关键词检索", "reprobe_after", ragMultiQueryReprobeInterval.String())
+		case errors.Is(err, errRAGMultiQueryRejected):
+			logger.Warn("RAG服务拒绝了本批次的多查询请求，该批次改为逐个关键词检索", "queries", len(queries))
+		default:
+			return nil, err
+		}
+	}
+
+	results := make(map[string][]models.RecommendationItem, len(queries))
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			return results, nil
+		}
+		items, err := searchRAG(ctx, cfg, query, params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, nil
+			}
+			logger.Error("RAG search failed for keyword", "keyword", query, "error", err)
+			continue
+		}
+		results[query] = items
+	}
+	return results, nil
+}
+
+// batchKeywords 提取一批关键词的文本
+func batchKeywords(batch []models.WeightedKeyword) []string {
+	queries := make([]string, 0, len(batch))
+	for _, wk := range batch {
+		queries = append(queries, wk.Keyword)
+	}
+	return queries
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,42 +16,234 @@ import (
 	"ai_push_message/utils"
 )
 
+// ragResult RAG服务返回的单条检索结果
+type ragResult struct {
+	ChunkID     string  `json:"chunk_id"`
+	DocumentID  string  `json:"document_id"`
+	KnowledgeID string  `json:"knowledge_id"`
+	Title       string  `json:"title"`
+	Content     string  `json:"content"`
+	Summary     string  `json:"summary"`
+	Score       float64 `json:"score"`
+}
+
 type ragResp struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    struct {
-		Query   string `json:"query"`
-		Results []struct {
-			ChunkID     string  `json:"chunk_id"`
-			DocumentID  string  `json:"document_id"`
-			KnowledgeID string  `json:"knowledge_id"`
-			Title       string  `json:"title"`
-			Content     string  `json:"content"`
-			Summary     string  `json:"summary"`
-			Score       float64 `json:"score"`
-		} `json:"results"`
-		Total int `json:"total"`
+		Query   string      `json:"query"`
+		Results []ragResult `json:"results"`
+		Total   int         `json:"total"`
+	} `json:"data"`
+}
+
+// ragMultiResp 多查询批量检索的响应，data 中每个元素对应一个查询
+type ragMultiResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []struct {
+		Query   string      `json:"query"`
+		Results []ragResult `json:"results"`
+		Total   int         `json:"total"`
 	} `json:"data"`
 }
 
+var (
+	// errRAGMultiQueryUnsupported RAG服务不支持多查询批量请求
+	errRAGMultiQueryUnsupported = errors.New("RAG服务不支持多查询批量请求")
+	// errRAGMultiQueryRejected RAG服务拒绝了本次多查询请求（如查询过长），只对该批次降级为逐个查询
+	errRAGMultiQueryRejected = errors.New("RAG服务拒绝了多查询请求")
+)
+
 func CallRAG(cfg *config.Config, query string) ([]models.RecommendationItem, error) {
+	return CallRAGWithContext(context.Background(), cfg, query)
+}
+
+// CallRAGWithContext 调用RAG服务搜索单个关键词，ctx 取消时调用方不再等待结果
+// 相同查询的结果在多个用户间共享缓存，并发的相同查询只发起一次上游请求
+func CallRAGWithContext(ctx context.Context, cfg *config.Config, query string) ([]models.RecommendationItem, error) {
+	return searchRAG(ctx, cfg, query, defaultRAGSearchParams(cfg))
+}
+
+// searchRAG 使用指定检索参数进行带缓存的单查询检索
+// RAG服务失败、超时或处于故障冷却期时，透明地改用本地全文索引
+func searchRAG(ctx context.Context, cfg *config.Config, query string, params ragSearchParams) ([]models.RecommendationItem, error) {
+	if useFallbackDirectly(cfg) {
+		if items, ok := searchFallback(cfg, query, params); ok {
+			return items, nil
+		}
+	}
+
+	items, err := cachedRAGSearch(ctx, cfg, query, params, func(ctx context.Context) ([]models.RecommendationItem, error) {
+		items, err := fetchRAG(ctx, cfg, query, params)
+		ragBreaker.record(cfg, err)
+		return items, err
+	})
+	if err != nil && ctx.Err() == nil {
+		if fallbackItems, ok := searchFallback(cfg, query, params); ok {
+			logger.Warn("RAG检索失败，改用本地索引", "query", query, "error", err)
+			return fallbackItems, nil
+		}
+	}
+	return items, err
+}
+
+// fetchRAG 向RAG服务发起单查询请求
+func fetchRAG(ctx context.Context, cfg *config.Config, query string, params ragSearchParams) ([]models.RecommendationItem, error) {
 	logger.Info("调用RAG服务搜索关键词", "query", query)
 
 	payload := map[string]any{
-		"knowledge_ids": cfg.RAG.KnowledgeIDs,
+		"knowledge_ids": params.KnowledgeIDs,
 		"query":         query,
-		"threshold":     cfg.RAG.Threshold, // 使用rag.threshold配置
-		"top_k":         cfg.RAG.TopK,      // 使用rag.topk配置
+		"threshold":     params.Threshold, // 默认使用rag.threshold配置
+		"top_k":         params.TopK,      // 默认使用rag.topk配置
+	}
+
+	statusCode, bodyBytes, err := postRAG(ctx, cfg, cfg.RAG.URL, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查HTTP状态码
+	if statusCode != http.StatusOK {
+		logger.Error("RAG服务返回错误状态码", "status_code", statusCode, "response", string(bodyBytes))
+		return nil, fmt.Errorf("RAG服务错误 (HTTP %d): %s", statusCode, string(bodyBytes))
+	}
+
+	var rr ragResp
+	if err := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&rr); err != nil {
+		logger.Error("解析RAG响应失败", "error", err)
+		return nil, fmt.Errorf("解析RAG响应失败: %v", err)
+	}
+
+	// 检查业务状态码
+	if rr.Code != 0 {
+		logger.Error("RAG服务业务错误", "code", rr.Code, "message", rr.Message)
+		return nil, fmt.Errorf("RAG服务业务错误: %s (错误码: %d)", rr.Message, rr.Code)
+	}
+
+	logger.Info("RAG响应解析结果", "code", rr.Code, "message", rr.Message, "result_count", len(rr.Data.Results))
+	collectFallbackDocuments(cfg, rr.Data.Results)
+
+	items := convertRAGResults(cfg, rr.Data.Results)
+	logger.Info("生成的推荐项数量", "count", len(items))
+	return items, nil
+}
+
+// CallRAGMulti 在一次请求中搜索多个关键词，返回 查询 -> 推荐项 的映射
+// 服务端不支持多查询时返回 errRAGMultiQueryUnsupported，拒绝本次请求时返回 errRAGMultiQueryRejected，调用方应降级为逐个查询
+func CallRAGMulti(ctx context.Context, cfg *config.Config, queries []string) (map[string][]models.RecommendationItem, error) {
+	return searchRAGMulti(ctx, cfg, queries, defaultRAGSearchParams(cfg))
+}
+
+// searchRAGMulti 使用指定检索参数进行带缓存的多查询检索
+// RAG服务失败时，未取得结果的查询改用本地全文索引
+func searchRAGMulti(ctx context.Context, cfg *config.Config, queries []string, params ragSearchParams) (map[string][]models.RecommendationItem, error) {
+	if useFallbackDirectly(cfg) {
+		return searchFallbackMulti(cfg, queries, params, nil), nil
+	}
+
+	results, err := cachedRAGSearchMulti(ctx, cfg, queries, params, func(ctx context.Context, queries []string) (map[string][]models.RecommendationItem, error) {
+		results, err := fetchRAGMulti(ctx, cfg, queries, params)
+		ragBreaker.record(cfg, err)
+		return results, err
+	})
+	if errors.Is(err, errRAGMultiQueryUnsupported) || errors.Is(err, errRAGMultiQueryRejected) || ctx.Err() != nil || !cfg.Fallback.Enabled {
+		return results, err
+	}
+	if err != nil || len(results) < len(queries) {
+		if len(fallbackDocs.currentIndex().docs) == 0 {
+			return results, err
+		}
+		logger.Warn("RAG批量检索部分失败，缺失的查询改用本地索引", "queries", len(queries), "succeeded", len(results), "error", err)
+		return searchFallbackMulti(cfg, queries, params, results), nil
+	}
+	return results, nil
+}
+
+// searchFallbackMulti 对 results 中缺失的查询使用本地索引检索
+func searchFallbackMulti(cfg *config.Config, queries []string, params ragSearchParams, results map[string][]models.RecommendationItem) map[string][]models.RecommendationItem {
+	if results == nil {
+		results = make(map[string][]models.RecommendationItem, len(queries))
+	}
+	for _, query := range queries {
+		if _, ok := results[query]; ok {
+			continue
+		}
+		if items, ok := searchFallback(cfg, query, params); ok {
+			results[query] = items
+		}
+	}
+	return results
+}
+
+// fetchRAGMulti 向RAG服务发起多查询请求
+func fetchRAGMulti(ctx context.Context, cfg *config.Config, queries []string, params ragSearchParams) (map[string][]models.RecommendationItem, error) {
+	logger.Info("调用RAG服务批量搜索关键词", "queries", queries)
+
+	url := cfg.RAG.MultiQueryURL
+	if url == "" {
+		url = cfg.RAG.URL
+	}
+	payload := map[string]any{
+		"knowledge_ids": params.KnowledgeIDs,
+		"queries":       queries,
+		"threshold":     params.Threshold,
+		"top_k":         params.TopK,
+	}
+
+	statusCode, bodyBytes, err := postRAG(ctx, cfg, url, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		logger.Warn("RAG服务不支持多查询请求", "status_code", statusCode, "response", string(bodyBytes))
+		return nil, errRAGMultiQueryUnsupported
+	case http.StatusBadRequest:
+		// 单个批次的请求有误（如查询过长）不代表服务端不支持多查询
+		logger.Warn("RAG服务拒绝了多查询请求", "status_code", statusCode, "response", string(bodyBytes))
+		return nil, errRAGMultiQueryRejected
+	default:
+		logger.Error("RAG服务返回错误状态码", "status_code", statusCode, "response", string(bodyBytes))
+		return nil, fmt.Errorf("RAG服务错误 (HTTP %d): %s", statusCode, string(bodyBytes))
+	}
+
+	// 单查询格式的响应（data 为对象）无法解析为数组，说明服务端忽略了 queries 字段
+	var rr ragMultiResp
+	if err := json.Unmarshal(bodyBytes, &rr); err != nil {
+		logger.Warn("无法解析多查询RAG响应，视为不支持多查询", "error", err)
+		return nil, errRAGMultiQueryUnsupported
+	}
+
+	if rr.Code != 0 {
+		logger.Error("RAG服务业务错误", "code", rr.Code, "message", rr.Message)
+		return nil, fmt.Errorf("RAG服务业务错误: %s (错误码: %d)", rr.Message, rr.Code)
+	}
+
+	result := make(map[string][]models.RecommendationItem, len(queries))
+	for _, d := range rr.Data {
+		collectFallbackDocuments(cfg, d.Results)
+		result[d.Query] = convertRAGResults(cfg, d.Results)
 	}
+
+	logger.Info("RAG批量搜索完成", "queries", len(queries), "responses", len(rr.Data))
+	return result, nil
+}
+
+// postRAG 发送RAG请求并返回HTTP状态码和响应体
+func postRAG(ctx context.Context, cfg *config.Config, url string, payload map[string]any) (int, []byte, error) {
 	b, _ := json.Marshal(payload)
 
 	logger.Info("RAG请求参数", "payload", string(b))
-	logger.Info("RAG服务URL", "url", cfg.RAG.URL)
+	logger.Info("RAG服务URL", "url", url)
 
-	req, err := http.NewRequest("POST", cfg.RAG.URL, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
 	if err != nil {
 		logger.Error("创建RAG请求失败", "error", err)
-		return nil, err
+		return 0, nil, err
 	}
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.RAG.APIKey))
@@ -65,43 +259,38 @@ func CallRAG(cfg *config.Config, query string) ([]models.RecommendationItem, err
 	logger.Info("发送RAG请求...")
 	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			logger.Debug("RAG请求已取消", "error", err)
+			return 0, nil, ctx.Err()
+		}
 		logger.Error("RAG请求失败", "error", err)
-		return nil, fmt.Errorf("RAG服务连接失败: %v", err)
+		return 0, nil, fmt.Errorf("RAG服务连接失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	logger.Info("RAG响应状态码", "status_code", resp.StatusCode)
 
 	// 读取响应体
-	var bodyBytes []byte
-	bodyBytes, _ = io.ReadAll(resp.Body)
-	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	logger.Info("RAG响应内容", "response", string(bodyBytes))
-
-	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusOK {
-		logger.Error("RAG服务返回错误状态码", "status_code", resp.StatusCode, "response", string(bodyBytes))
-		return nil, fmt.Errorf("RAG服务错误 (HTTP %d): %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var rr ragResp
-	if err := json.NewDecoder(bytes.NewReader(bodyBytes)).Decode(&rr); err != nil {
-		logger.Error("解析RAG响应失败", "error", err)
-		return nil, fmt.Errorf("解析RAG响应失败: %v", err)
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("读取RAG响应失败", "error", err)
+		return 0, nil, fmt.Errorf("读取RAG响应失败: %v", err)
 	}
 
-	// 检查业务状态码
-	if rr.Code != 0 {
-		logger.Error("RAG服务业务错误", "code", rr.Code, "message", rr.Message)
-		return nil, fmt.Errorf("RAG服务业务错误: %s (错误码: %d)", rr.Message, rr.Code)
-	}
+	logger.Info("RAG响应内容", "response", string(bodyBytes))
+	return resp.StatusCode, bodyBytes, nil
+}
 
-	logger.Info("RAG响应解析结果", "code", rr.Code, "message", rr.Message, "result_count", len(rr.Data.Results))
+// convertRAGResults 将RAG检索结果格式化为推荐项
+func convertRAGResults(cfg *config.Config, results []ragResult) []models.RecommendationItem {
+	return formatRAGResults(cfg, results, true)
+}
 
+// formatRAGResults 将检索结果格式化为推荐项，colloquialize 为 false 时不调用LLM做口语化处理
+func formatRAGResults(cfg *config.Config, results []ragResult, colloquialize bool) []models.RecommendationItem {
 	// 创建RAG内容格式化器，根据配置决定是否启用口语化处理
 	var formatter *utils.RAGContentFormatter
-	if cfg.SiliconFlow.APIKey != "" && cfg.SiliconFlow.Model != "" {
+	if colloquialize && cfg.SiliconFlow.APIKey != "" && cfg.SiliconFlow.Model != "" {
 		// 如果配置了SiliconFlow，启用口语化处理
 		siliconFlowConfig := &utils.SiliconFlowConfig{
 			APIKey:  cfg.SiliconFlow.APIKey,
@@ -114,8 +303,8 @@ func CallRAG(cfg *config.Config, query string) ([]models.RecommendationItem, err
 		formatter = utils.NewRAGContentFormatter()
 	}
 
-	items := make([]models.RecommendationItem, 0, len(rr.Data.Results))
-	for _, r := range rr.Data.Results {
+	items := make([]models.RecommendationItem, 0, len(results))
+	for _, r := range results {
 		// 分别处理标题和内容，而不是一起处理
 		formattedTitle := formatter.RemoveMarkdownHeaders(r.Title)
 		formattedContent := formatter.RemoveMarkdownHeaders(r.Content)
@@ -137,15 +326,15 @@ func CallRAG(cfg *config.Config, query string) ([]models.RecommendationItem, err
 		}
 
 		items = append(items, models.RecommendationItem{
-			Source:  "rag",
-			Title:   formattedTitle,
-			Content: formattedContent,
-			URL:     "",
-			Score:   r.Score,
-			RefID:   r.DocumentID,
+			Source:      "rag",
+			Title:       formattedTitle,
+			Content:     formattedContent,
+			URL:         "",
+			Score:       r.Score,
+			RefID:       r.DocumentID,
+			KnowledgeID: r.KnowledgeID,
 		})
 	}
 
-	logger.Info("生成的推荐项数量", "count", len(items))
-	return items, nil
+	return items
 }
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"sort"
+
+	"ai_push_message/models"
+)
+
+// defaultRRFK 倒数排名融合的平滑常数，取值越大排名靠后的结果衰减越慢
+const defaultRRFK = 60.0
+
+// rankedList 单个关键词的检索结果，Items 的顺序即为排名
+type rankedList struct {
+	Keyword string
+	Weight  float64
+	Items   []models.RecommendationItem
+}
+
+// fusedItem 融合过程中的中间结果
+type fusedItem struct {
+	item         models.RecommendationItem
+	key          string
+	fusedScore   float64
+	bestRawScore float64
+	bestTerm     float64
+}
+
+// recommendationKey 推荐内容去重键
+func recommendationKey(item models.RecommendationItem) string {
+	return item.RefID + "|" + item.Title
+}
+
+// fuseRankedLists 使用加权倒数排名融合（Weighted RRF）合并多个关键词的检索结果
+// score(d) = Σ weight_k / (rrfK + rank_k(d))，rank 从1开始
+// 结果按融合分数降序排列，分数相同时依次按原始相关性分数降序、去重键升序排列，保证排序确定；
+// 融合分数写入 FusedScore，Score 保留各关键词检索中最高的原始相关性分数
+func fuseRankedLists(lists []rankedList, rrfK float64, topN int) []models.RecommendationItem {
+	if rrfK <= 0 {
+		rrfK = defaultRRFK
+	}
+
+	// 按权重降序、关键词升序处理，保证同分时选用的代表关键词确定
+	ordered := make([]rankedList, len(lists))
+	copy(ordered, lists)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Weight != ordered[j].Weight {
+			return ordered[i].Weight > ordered[j].Weight
+		}
+		return ordered[i].Keyword < ordered[j].Keyword
+	})
+
+	fused := make(map[string]*fusedItem)
+	for _, list := range ordered {
+		if list.Weight <= 0 {
+			continue
+		}
+
+		// 列表内按原始分数排序确定排名，同一列表中的重复内容只计一次
+		items := make([]models.RecommendationItem, len(list.Items))
+		copy(items, list.Items)
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Score != items[j].Score {
+				return items[i].Score > items[j].Score
+			}
+			return recommendationKey(items[i]) < recommendationKey(items[j])
+		})
+
+		rank := 0
+		seenInList := make(map[string]bool)
+		for _, item := range items {
+			key := recommendationKey(item)
+			if seenInList[key] {
+				continue
+			}
+			seenInList[key] = true
+			rank++
+
+			term := list.Weight / (rrfK + float64(rank))
+			f, ok := fused[key]
+			if !ok {
+				item.SearchKeyword = list.Keyword
+				fused[key] = &fusedItem{
+					item:         item,
+					key:          key,
+					fusedScore:   term,
+					bestRawScore: item.Score,
+					bestTerm:     term,
+				}
+				continue
+			}
+
+			f.fusedScore += term
+			if item.Score > f.bestRawScore {
+				f.bestRawScore = item.Score
+			}
+			// 贡献最大的关键词作为该推荐内容的搜索关键词
+			if term > f.bestTerm {
+				f.bestTerm = term
+				item.SearchKeyword = list.Keyword
+				f.item = item
+			}
+		}
+	}
+
+	arr := make([]*fusedItem, 0, len(fused))
+	for _, f := range fused {
+		arr = append(arr, f)
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].fusedScore != arr[j].fusedScore {
+			return arr[i].fusedScore > arr[j].fusedScore
+		}
+		if arr[i].bestRawScore != arr[j].bestRawScore {
+			return arr[i].bestRawScore > arr[j].bestRawScore
+		}
+		return arr[i].key < arr[j].key
+	})
+
+	if topN > 0 && len(arr) > topN {
+		arr = arr[:topN]
+	}
+
+	result := make([]models.RecommendationItem, 0, len(arr))
+	for _, f := range arr {
+		item := f.item
+		item.Score = f.bestRawScore
+		item.FusedScore = f.fusedScore
+		result = append(result, item)
+	}
+	return result
+}
+
+// rankingScore 排序使用的分数：经过融合的结果使用融合分数，否则使用原始相关性分数
+func rankingScore(item models.RecommendationItem) float64 {
+	if item.FusedScore > 0 {
+		return item.FusedScore
+	}
+	return item.Score
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"ai_push_message/models"
+)
+
+func rec(refID string, score float64) models.RecommendationItem {
+	return models.RecommendationItem{RefID: refID, Title: refID, Score: score}
+}
+
+func refIDs(items []models.RecommendationItem) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.RefID)
+	}
+	return out
+}
+
+func TestFuseRankedLists(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists []rankedList
+		topN  int
+		want  []string
+	}{
+		{
+			name: "权重高的关键词排名靠前",
+			lists: []rankedList{
+				{Keyword: "以太坊", Weight: 0.2, Items: []models.RecommendationItem{rec("b", 0.9)}},
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.5)}},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "多个关键词命中的内容累加分数",
+			lists: []rankedList{
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.9), rec("c", 0.8)}},
+				{Keyword: "以太坊", Weight: 1.0, Items: []models.RecommendationItem{rec("b", 0.9), rec("c", 0.8)}},
+			},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			name: "融合分数相同按原始分数排序",
+			lists: []rankedList{
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.6)}},
+				{Keyword: "以太坊", Weight: 1.0, Items: []models.RecommendationItem{rec("b", 0.8)}},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "分数全部相同按去重键排序",
+			lists: []rankedList{
+				{Keyword: "以太坊", Weight: 1.0, Items: []models.RecommendationItem{rec("b", 0.8)}},
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.8)}},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "截取前topN条",
+			lists: []rankedList{
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.9), rec("b", 0.8), rec("c", 0.7)}},
+			},
+			topN: 2,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "忽略权重为0的关键词",
+			lists: []rankedList{
+				{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.5)}},
+				{Keyword: "以太坊", Weight: 0, Items: []models.RecommendationItem{rec("b", 0.9)}},
+			},
+			want: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := refIDs(fuseRankedLists(tt.lists, 60, tt.topN))
+			if len(got) != len(tt.want) {
+				t.Fatalf("结果为 %v，期望 %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("结果为 %v，期望 %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseRankedListsKeepsRawScore(t *testing.T) {
+	lists := []rankedList{
+		{Keyword: "比特币", Weight: 1.0, Items: []models.RecommendationItem{rec("a", 0.7), rec("a", 0.7)}},
+		{Keyword: "以太坊", Weight: 0.5, Items: []models.RecommendationItem{rec("b", 0.9), rec("a", 0.8)}},
+	}
+	result := fuseRankedLists(lists, 60, 0)
+	if len(result) != 2 || result[0].RefID != "a" {
+		t.Fatalf("结果为 %v，期望 a 排在首位且去重", refIDs(result))
+	}
+
+	a := result[0]
+	// 同一列表中的重复内容只计一次：1.0/(60+1) + 0.5/(60+2)
+	if want := 1.0/61 + 0.5/62; math.Abs(a.FusedScore-want) > 1e-9 {
+		t.Errorf("融合分数为 %v，期望 %v", a.FusedScore, want)
+	}
+	if a.Score != 0.8 {
+		t.Errorf("原始分数为 %v，期望保留最高的原始分数 0.8", a.Score)
+	}
+	if a.SearchKeyword != "比特币" {
+		t.Errorf("搜索关键词为 %s，期望贡献最大的 比特币", a.SearchKeyword)
+	}
+}
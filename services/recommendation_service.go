@@ -6,7 +6,8 @@ import (
 	"ai_push_message/models"
 	"ai_push_message/repository"
 	"ai_push_message/utils"
-	"encoding/json"
+	"context"
+	"sort"
 	"sync"
 	"time"
 )
@@ -98,115 +99,56 @@ func GenerateRecommendationsForAllUsers(cfg *config.Config) error {
 	return nil
 }
 
-// extractKeywords 从用户画像中提取关键词
-func extractKeywords(profile *models.UserProfile) []string {
-	if profile == nil {
-		return []string{}
-	}
-
-	var keywords []string
-
-	// 首先尝试从 Keywords 字段解析
-	if profile.Keywords != "" {
-		if err := json.Unmarshal([]byte(profile.Keywords), &keywords); err == nil && len(keywords) > 0 {
-			return keywords
-		} else if err != nil {
-			logger.Debug("Failed to parse keywords from Keywords field", "cid", profile.CID, "error", err)
-		}
-	}
-
-	// 如果 Keywords 字段解析失败，尝试从 ProfileRaw 中提取
-	if profile.ProfileRaw != "" {
-		var profileData map[string]interface{}
-		if err := json.Unmarshal([]byte(profile.ProfileRaw), &profileData); err == nil {
-			// 从 weighted_keywords 中提取
-			if wkRaw, ok := profileData["weighted_keywords"].([]interface{}); ok {
-				for _, wk := range wkRaw {
-					if kwObj, ok := wk.(map[string]interface{}); ok {
-						if kw, ok := kwObj["keyword"].(string); ok && kw != "" {
-							keywords = append(keywords, kw)
-						}
-					}
-				}
-			}
-
-			// 如果还是没有关键词，尝试从 interests 中获取
-			if len(keywords) == 0 {
-				if interests, ok := profileData["interests"].([]interface{}); ok {
-					for _, interest := range interests {
-						if interestStr, ok := interest.(string); ok && interestStr != "" {
-							keywords = append(keywords, interestStr)
-						}
-					}
-				}
-			}
-		} else {
-			logger.Debug("Failed to parse ProfileRaw", "cid", profile.CID, "error", err)
-		}
-	}
-
-	logger.Debug("Extracted keywords from profile", "cid", profile.CID, "count", len(keywords))
-	return keywords
-}
-
 // SearchKnowledgeBaseByProfile 根据用户画像搜索知识库
-func SearchKnowledgeBaseByProfile(cfg *config.Config, keywords []string) ([]models.RecommendationItem, error) {
-	allRecommendations := make([]models.RecommendationItem, 0)
-	seen := make(map[string]bool)
+// 所有带权重的关键词在并发限制下并行检索，配置了知识库策略时按用户类型分别检索各知识库，
+// 结果通过加权倒数排名融合（RRF）合并排序后做多样性重排
+func SearchKnowledgeBaseByProfile(cfg *config.Config, keywords []models.WeightedKeyword, userType string) ([]models.RecommendationItem, error) {
+	searchKeywords := make([]models.WeightedKeyword, 0, len(keywords))
 	processedKeywords := make(map[string]bool)
 
-	logger.Info("Searching knowledge base with keywords", "count", len(keywords))
-
-	// 按权重顺序（从高到低）处理关键词
-	for _, keyword := range keywords {
-		// 跳过空关键词和已处理的关键词
-		if keyword == "" || processedKeywords[keyword] {
-			continue
-		}
-
-		processedKeywords[keyword] = true
-		logger.Info("Searching with keyword", "keyword", keyword)
-
-		// 调用RAG服务搜索
-		items, err := CallRAG(cfg, keyword)
-		if err != nil {
-			logger.Error("RAG search failed for keyword", "keyword", keyword, "error", err)
+	// 早期画像中的关键词可能未规范化，检索前统一为规范词
+	for _, wk := range canonicalizeKeywords(cfg, keywords) {
+		// 跳过空关键词、无权重关键词和已处理的关键词
+		if wk.Keyword == "" || wk.Weight <= 0 || processedKeywords[wk.Keyword] {
 			continue
 		}
+		processedKeywords[wk.Keyword] = true
+		searchKeywords = append(searchKeywords, wk)
+	}
 
-		logger.Info("Found items for keyword", "keyword", keyword, "count", len(items))
+	// 权重高的关键词优先派发
+	sort.SliceStable(searchKeywords, func(i, j int) bool {
+		return searchKeywords[i].Weight > searchKeywords[j].Weight
+	})
 
-		// 检查返回内容是否为空
-		if len(items) == 0 {
-			logger.Info("No items found for keyword, skipping", "keyword", keyword)
-			continue
-		}
+	// 追加同义词查询，检索结果归到原关键词下
+	queries, origin := expandKeywordsWithSynonyms(cfg, searchKeywords)
 
-		// 去重并添加到结果中
-		for _, item := range items {
-			key := item.RefID + "|" + item.Title
-			if !seen[key] {
-				item.Source = "knowledge_base"
-				item.SearchKeyword = keyword
-				allRecommendations = append(allRecommendations, item)
-				seen[key] = true
-			}
-		}
+	plans := buildKBSearchPlans(cfg, userType)
+	logger.Info("Searching knowledge base with keywords", "count", len(searchKeywords), "queries", len(queries), "user_type", userType, "search_plans", len(plans))
+	lists := searchKeywordsConcurrently(cfg, queries, plans)
+	for i := range lists {
+		lists[i].Keyword = origin[lists[i].Keyword]
+	}
 
-		// 如果已经找到足够的推荐内容，就不再继续搜索
-		if len(allRecommendations) >= cfg.RAG.TopK {
-			logger.Info("Found enough recommendations, stopping search", "count", len(allRecommendations))
-			break
+	// 按融合分数排序，启用多样性重排时保留更大的候选池
+	candidateLimit := cfg.RAG.TopK
+	if cfg.Diversity.Enabled {
+		multiplier := cfg.Diversity.CandidateMultiplier
+		if multiplier <= 0 {
+			multiplier = 3 // 默认值
 		}
+		candidateLimit = cfg.RAG.TopK * multiplier
 	}
+	candidates := fuseRankedLists(lists, cfg.RAG.RRFK, candidateLimit)
 
-	logger.Info("Total recommendations found", "count", len(allRecommendations))
-
-	// 按相关性分数排序并限制数量
-	if len(allRecommendations) > cfg.RAG.TopK {
-		allRecommendations = allRecommendations[:cfg.RAG.TopK]
+	interests := make([]string, 0, len(searchKeywords))
+	for _, wk := range searchKeywords {
+		interests = append(interests, wk.Keyword)
 	}
+	allRecommendations := diversifyRecommendations(cfg, candidates, interests, cfg.RAG.TopK)
 
+	logger.Info("Total recommendations found", "count", len(allRecommendations), "keyword_lists", len(lists))
 	return allRecommendations, nil
 }
 
@@ -269,10 +211,21 @@ func ForceGenerateRecommendationsForUserWithProfile(cfg *config.Config, cid stri
 	var err error
 
 	// 如果用户有画像和关键词，优先使用基于画像的推荐
-	if profile != nil && profile.Keywords != "" {
-		keywords := extractKeywords(profile)
+	if profile != nil {
+		parsed, parseErr := models.ParseUserProfile(profile)
+		if parseErr != nil {
+			logger.Error("Failed to parse user profile", "cid", cid, "error", parseErr)
+			return nil, parseErr
+		}
+		keywords := parsed.WeightedKeywords
+		userType := parsed.UserType
 		if len(keywords) > 0 {
-			recommendations, err = SearchKnowledgeBaseByProfile(cfg, keywords)
+			if cfg.Hybrid.Enabled {
+				// 混合召回：知识库 + 近期群聊总结
+				recommendations, err = hybridRecall(cfg, keywords, userType)
+			} else {
+				recommendations, err = SearchKnowledgeBaseByProfile(cfg, keywords, userType)
+			}
 			if err != nil {
 				logger.Error("Failed to search knowledge base", "cid", cid, "error", err)
 				return nil, err
@@ -280,7 +233,10 @@ func ForceGenerateRecommendationsForUserWithProfile(cfg *config.Config, cid stri
 		}
 	}
 
-	// 如果RAG服务返回为空，不写入recommendation_cache，让定时推送通过pushHotTopicsBroadcast来处理
+	// 自身关键词检索结果较少时，补充相似用户点击或收到过的内容
+	recommendations = supplementWithSimilarUsers(cfg, cid, recommendations)
+
+	// 如果RAG服务返回为空，不写入recommendation_cache，让定时推送通过PushHotTopicsBroadcast来处理
 	if len(recommendations) == 0 {
 		logger.Info("No profile-based recommendations found from RAG service, not saving to cache, will be handled by hot topics broadcast", "cid", cid)
 		return []models.RecommendationItem{}, nil
@@ -313,41 +269,56 @@ func GetRecommendationStats() map[string]interface{} {
 	}
 }
 
-// 并发生成用户推荐内容
-func GenerateRecommendationsWithConcurrency(cfg *config.Config, cids []string, concurrency int) {
+// 并发生成用户推荐内容，返回处理、生成成功和失败的用户数
+func GenerateRecommendationsWithConcurrency(cfg *config.Config, cids []string, concurrency int) models.StageCounts {
+	return GenerateRecommendationsWithCheckpoint(context.Background(), cfg, cids, concurrency, nil)
+}
+
+// GenerateRecommendationsWithCheckpoint 并发生成用户推荐内容，跳过检查点中已完成的用户并记录每个用户的结果
+// ctx 取消后不再开始处理新的用户，已开始的用户处理完成后返回
+func GenerateRecommendationsWithCheckpoint(ctx context.Context, cfg *config.Config, cids []string, concurrency int, cp *RunCheckpoint) models.StageCounts {
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, concurrency)
 
 	var mu sync.Mutex
-	processed, failed, completed := 0, 0, 0
+	var counts models.StageCounts
+	cids, counts.Skipped = cp.pending(cids)
+	if counts.Skipped > 0 {
+		logger.Info("跳过已生成推荐内容的用户", "count", counts.Skipped)
+	}
 
 	for _, cid := range cids {
+		if !acquireSlot(ctx, semaphore) {
+			logger.Warn("任务已取消，停止生成推荐内容", "error", context.Cause(ctx))
+			break
+		}
 		wg.Add(1)
-		semaphore <- struct{}{} // acquire semaphore
 
 		go func(userCID string) {
 			defer wg.Done()
 			defer func() { <-semaphore }() // release semaphore
 
 			_, err := GenerateRecommendationsForUser(cfg, userCID)
+			cp.Finish(userCID, err)
 			mu.Lock()
 			defer mu.Unlock()
-			processed++
+			counts.Processed++
 			if err != nil {
-				failed++
+				counts.AddError(userCID, err)
 				logger.Error("生成用户推荐内容失败", "cid", userCID, "error", err)
 				return
 			}
 			// 不再区分created和updated，因为GenerateRecommendationsForUser内部已有完整逻辑
-			completed++
+			counts.Regenerated++
 			logger.Info("成功生成用户推荐内容", "cid", userCID)
 		}(cid)
 	}
 
 	wg.Wait()
 	logger.Info("所有用户推荐内容生成完成",
-		"processed", processed,
-		"completed", completed,
-		"failed", failed,
+		"processed", counts.Processed,
+		"completed", counts.Regenerated,
+		"failed", counts.Failed,
 	)
+	return counts
 }
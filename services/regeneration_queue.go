@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sync"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+)
+
+// regenerationQueue 后台推荐内容重新生成队列，同一用户排队期间只保留一个任务
+type regenerationQueue struct {
+	ch      chan string
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+var (
+	regenQueueOnce sync.Once
+	regenQueue     *regenerationQueue
+)
+
+// getRegenerationQueue 获取重新生成队列，首次调用时启动后台工作协程
+func getRegenerationQueue(cfg *config.Config) *regenerationQueue {
+	regenQueueOnce.Do(func() {
+		size := cfg.Webhook.QueueSize
+		if size <= 0 {
+			size = 10000 // 默认值
+		}
+		workers := cfg.Webhook.RegenerationConcurrency
+		if workers <= 0 {
+			workers = 2 // 默认值
+		}
+
+		regenQueue = &regenerationQueue{
+			ch:      make(chan string, size),
+			pending: make(map[string]bool),
+		}
+		for i := 0; i < workers; i++ {
+			go regenQueue.work(cfg)
+		}
+		logger.Info("推荐内容重新生成队列已启动", "workers", workers, "queue_size", size)
+	})
+	return regenQueue
+}
+
+// QueueRecommendationRegeneration 将用户加入推荐内容重新生成队列
+// 返回是否新加入队列（已在队列中或队列已满时返回false）
+func QueueRecommendationRegeneration(cfg *config.Config, cid string) bool {
+	q := getRegenerationQueue(cfg)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[cid] {
+		return false
+	}
+
+	select {
+	case q.ch <- cid:
+		q.pending[cid] = true
+		return true
+	default:
+		logger.Warn("推荐内容重新生成队列已满，丢弃任务", "cid", cid)
+		return false
+	}
+}
+
+// work 逐个处理队列中的用户，使用现有画像重新生成推荐内容
+func (q *regenerationQueue) work(cfg *config.Config) {
+	for cid := range q.ch {
+		q.mu.Lock()
+		delete(q.pending, cid)
+		q.mu.Unlock()
+
+		if _, err := RefreshUserRecommendationsWithOptions(cfg, cid, false); err != nil {
+			logger.Error("队列任务重新生成推荐内容失败", "cid", cid, "error", err)
+			continue
+		}
+		logger.Info("队列任务重新生成推荐内容完成", "cid", cid)
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// segmentPreviewSize 试算分群时返回的成员数
+const segmentPreviewSize = 20
+
+// profilePageSize 分批读取用户画像时每批的条数
+const profilePageSize = 1000
+
+// parsedProfile 解析后的用户画像，用于计算分群和相似用户
+type parsedProfile struct {
+	cid        string
+	profile    *models.Profile
+	lastActive time.Time
+}
+
+// ListSegments 获取全部分群
+func ListSegments() ([]models.Segment, error) {
+	return repository.ListSegments()
+}
+
+// GetSegment 获取单个分群
+func GetSegment(id int64) (*models.Segment, error) {
+	return repository.GetSegment(id)
+}
+
+// ListSegmentMembers 分页获取分群成员，分群不存在时返回 sql.ErrNoRows
+func ListSegmentMembers(id int64, limit, offset int) ([]string, error) {
+	if _, err := repository.GetSegment(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 100 // 默认值
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return repository.ListSegmentMembers(id, limit, offset)
+}
+
+// DeleteSegment 删除分群
+func DeleteSegment(id int64) error {
+	return repository.DeleteSegment(id)
+}
+
+// ValidateSegmentRules 校验并整理分群规则，关键词按同义词词典规范化
+func ValidateSegmentRules(cfg *config.Config, rules *models.SegmentRules) error {
+	userTypes := make([]string, 0, len(rules.UserTypes))
+	for _, t := range rules.UserTypes {
+		if t = strings.TrimSpace(t); t != "" {
+			userTypes = append(userTypes, t)
+		}
+	}
+
+	levels := make([]string, 0, len(rules.ActivityLevels))
+	for _, level := range rules.ActivityLevels {
+		level = strings.ToLower(strings.TrimSpace(level))
+		if level == "" {
+			continue
+		}
+		if !models.IsValidActivityLevel(level) {
+			return fmt.Errorf("activity_levels只能包含minimal、low、medium或high")
+		}
+		levels = append(levels, level)
+	}
+
+	keywords := make([]models.SegmentKeywordRule, 0, len(rules.Keywords))
+	for _, rule := range rules.Keywords {
+		rule.Keyword = strings.Join(strings.Fields(rule.Keyword), " ")
+		if rule.Keyword == "" {
+			continue
+		}
+		if rule.MinWeight < 0 || rule.MinWeight > 1 {
+			return fmt.Errorf("关键词 %s 的权重阈值必须在0-1之间", rule.Keyword)
+		}
+		if terms := canonicalizeTerms(cfg, []string{rule.Keyword}); len(terms) == 1 {
+			rule.Keyword = terms[0]
+		}
+		keywords = append(keywords, rule)
+	}
+
+	if rules.ActiveWithinDays < 0 {
+		return fmt.Errorf("active_within_days不能小于0")
+	}
+
+	rules.UserTypes = userTypes
+	rules.ActivityLevels = levels
+	rules.Keywords = keywords
+	return nil
+}
+
+// SaveSegment 按名称保存分群，并立即计算成员
+func SaveSegment(cfg *config.Config, segment *models.Segment) (*models.Segment, error) {
+	segment.Name = strings.TrimSpace(segment.Name)
+	if segment.Name == "" {
+		return nil, fmt.Errorf("分群名称不能为空")
+	}
+
+	id, err := repository.UpsertSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := repository.GetSegment(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	members := make([]string, 0)
+	err = forEachParsedProfile(func(sp parsedProfile) {
+		if saved.Rules.Match(sp.profile, sp.lastActive, now) {
+			members = append(members, sp.cid)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := saveSegmentMembers(saved, members); err != nil {
+		return nil, err
+	}
+	return repository.GetSegment(id)
+}
+
+// PreviewSegment 按规则试算分群，不保存
+func PreviewSegment(rules *models.SegmentRules) (*models.SegmentPreview, error) {
+	now := time.Now()
+	preview := &models.SegmentPreview{Members: make([]string, 0, segmentPreviewSize)}
+	err := forEachParsedProfile(func(sp parsedProfile) {
+		if !rules.Match(sp.profile, sp.lastActive, now) {
+			return
+		}
+		preview.Count++
+		if len(preview.Members) < segmentPreviewSize {
+			preview.Members = append(preview.Members, sp.cid)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// RefreshSegments 重新计算全部分群的成员，在每次画像生成完成后调用
+// 画像分批读取，只在内存中保留各分群的成员 cid；有分群保存失败时返回错误
+func RefreshSegments() error {
+	segments, err := repository.ListSegments()
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	members := make([][]string, len(segments))
+	for i := range members {
+		members[i] = make([]string, 0)
+	}
+	profiles := 0
+	err = forEachParsedProfile(func(sp parsedProfile) {
+		profiles++
+		for i := range segments {
+			if segments[i].Rules.Match(sp.profile, sp.lastActive, now) {
+				members[i] = append(members[i], sp.cid)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range segments {
+		if err := saveSegmentMembers(&segments[i], members[i]); err != nil {
+			failed++
+			logger.Error("计算分群失败", "segment", segments[i].Name, "error", err)
+		}
+	}
+	logger.Info("用户分群计算完成", "segments", len(segments), "profiles", profiles, "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d/%d个分群保存失败", failed, len(segments))
+	}
+	return nil
+}
+
+// saveSegmentMembers 保存分群的成员
+func saveSegmentMembers(segment *models.Segment, members []string) error {
+	if err := repository.ReplaceSegmentMembers(segment.ID, members); err != nil {
+		return err
+	}
+	logger.Debug("分群成员已更新", "segment", segment.Name, "count", len(members))
+	return nil
+}
+
+// loadParsedProfiles 读取并解析全部用户画像，无法解析的画像跳过
+func loadParsedProfiles() ([]parsedProfile, error) {
+	profiles := make([]parsedProfile, 0)
+	err := forEachParsedProfile(func(sp parsedProfile) {
+		profiles = append(profiles, sp)
+	})
+	return profiles, err
+}
+
+// forEachParsedProfile 按 cid 分批读取并解析全部用户画像，无法解析的画像跳过
+func forEachParsedProfile(fn func(parsedProfile)) error {
+	after := ""
+	for {
+		rows, err := repository.ListProfilesAfter(after, profilePageSize)
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			profile, err := models.ParseUserProfile(&rows[i])
+			if err != nil {
+				logger.Debug("解析用户画像失败，跳过分群计算", "cid", rows[i].CID, "error", err)
+				continue
+			}
+			fn(parsedProfile{
+				cid:        rows[i].CID,
+				profile:    profile,
+				lastActive: profile.LastActive(rows[i].UpdatedAt),
+			})
+		}
+		if len(rows) < profilePageSize {
+			return nil
+		}
+		after = rows[len(rows)-1].CID
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai_push_message/db/dbtest"
+)
+
+// fakeProfilePages 按 cid 分页返回投资者画像，cid 小于 u1000 的用户比特币权重为0.9，记录每次查询的 limit
+func fakeProfilePages(cids []string, limits *[]int64) dbtest.QueryFunc {
+	return func(args []driver.Value) ([]string, [][]driver.Value, error) {
+		after, limit := args[0].(string), args[1].(int64)
+		*limits = append(*limits, limit)
+		rows := make([][]driver.Value, 0, limit)
+		for _, cid := range cids {
+			if cid > after && int64(len(rows)) < limit {
+				weight := 0.2
+				if cid < "u1000" {
+					weight = 0.9
+				}
+				profile := fmt.Sprintf(`{"user_type":"投资者","weighted_keywords":[{"keyword":"比特币","weight":%.1f}]}`, weight)
+				rows = append(rows, []driver.Value{cid, profile, "[]", time.Now()})
+			}
+		}
+		return []string{"cid", "profile_json", "keywords", "updated_at"}, rows, nil
+	}
+}
+
+func segmentRow(id int64, name, rules string) []driver.Value {
+	now := time.Now()
+	return []driver.Value{id, name, "", rules, int64(0), nil, now, now}
+}
+
+func TestRefreshSegmentsPagesThroughProfiles(t *testing.T) {
+	fake := dbtest.Open(t)
+
+	cids := make([]string, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		cids = append(cids, fmt.Sprintf("u%04d", i))
+	}
+	var limits []int64
+	fake.OnQuery("FROM user_profiles", fakeProfilePages(cids, &limits))
+	fake.OnQuery("FROM user_segments", dbtest.Rows(
+		[]string{"id", "name", "description", "rules_json", "member_count", "refreshed_at", "created_at", "updated_at"},
+		segmentRow(1, "全部投资者", `{"user_types":["投资者"]}`),
+		segmentRow(2, "比特币重度关注", `{"keywords":[{"keyword":"比特币","min_weight":0.5}]}`),
+	))
+
+	if err := RefreshSegments(); err != nil {
+		t.Fatalf("计算分群失败: %v", err)
+	}
+
+	if len(limits) != 3 {
+		t.Errorf("读取画像 %d 次，期望按每批 %d 条分 3 次读取", len(limits), profilePageSize)
+	}
+	for _, l := range limits {
+		if l != profilePageSize {
+			t.Errorf("每批读取 %d 条，期望 %d", l, profilePageSize)
+		}
+	}
+
+	counts := make(map[int64]int64)
+	for _, s := range fake.ExecutedMatching("UPDATE user_segments SET member_count") {
+		counts[s.Args[1].(int64)] = s.Args[0].(int64)
+	}
+	if counts[1] != 2500 || counts[2] != 1000 {
+		t.Errorf("分群成员数为 %v，期望 1:2500 2:1000", counts)
+	}
+}
+
+func TestRefreshSegmentsReturnsErrorWhenSaveFails(t *testing.T) {
+	fake := dbtest.Open(t)
+	var limits []int64
+	fake.OnQuery("FROM user_profiles", fakeProfilePages([]string{"u0001", "u0002"}, &limits))
+	fake.OnQuery("FROM user_segments", dbtest.Rows(
+		[]string{"id", "name", "description", "rules_json", "member_count", "refreshed_at", "created_at", "updated_at"},
+		segmentRow(1, "全部投资者", `{"user_types":["投资者"]}`),
+		segmentRow(2, "技术爱好者", `{"user_types":["技术爱好者"]}`),
+	))
+	fake.OnExec("DELETE FROM user_segment_members", func(args []driver.Value) (int64, error) {
+		if args[0].(int64) == 1 {
+			return 0, errors.New("连接中断")
+		}
+		return 0, nil
+	})
+
+	if err := RefreshSegments(); err == nil {
+		t.Fatal("有分群保存失败时应返回错误")
+	}
+	// 一个分群失败不影响其他分群
+	updated := fake.ExecutedMatching("UPDATE user_segments SET member_count")
+	if len(updated) != 1 || updated[0].Args[1].(int64) != 2 {
+		t.Errorf("更新的分群为 %+v，期望只有分群2", updated)
+	}
+}
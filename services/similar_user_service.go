@@ -0,0 +1,306 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// sourceSimilarUsers 相似用户协同推荐的来源标识
+const sourceSimilarUsers = "similar_users"
+
+// keywordPosting 倒排索引中的一项：拥有该关键词的用户及其权重
+type keywordPosting struct {
+	cid    string
+	weight float64
+}
+
+// similarityIndex 用户关键词向量的倒排索引
+type similarityIndex struct {
+	vectors  map[string]map[string]float64 // cid -> 关键词 -> 权重
+	norms    map[string]float64            // cid -> 向量长度
+	postings map[string][]keywordPosting   // 关键词 -> 拥有该关键词的用户
+}
+
+var (
+	similarityMu      sync.RWMutex
+	similarityIdx     = buildSimilarityIndex(nil)
+	similarityBuiltAt time.Time
+)
+
+// buildSimilarityIndex 由用户画像构建倒排索引，关键词按同义词查找键归一化
+func buildSimilarityIndex(profiles []parsedProfile) *similarityIndex {
+	idx := &similarityIndex{
+		vectors:  make(map[string]map[string]float64, len(profiles)),
+		norms:    make(map[string]float64, len(profiles)),
+		postings: make(map[string][]keywordPosting),
+	}
+	for _, p := range profiles {
+		vector := make(map[string]float64, len(p.profile.WeightedKeywords))
+		for _, wk := range p.profile.WeightedKeywords {
+			key := synonymKey(wk.Keyword)
+			if key == "" || wk.Weight <= 0 {
+				continue
+			}
+			vector[key] = math.Max(vector[key], wk.Weight)
+		}
+		if len(vector) == 0 {
+			continue
+		}
+
+		sum := 0.0
+		for key, weight := range vector {
+			sum += weight * weight
+			idx.postings[key] = append(idx.postings[key], keywordPosting{cid: p.cid, weight: weight})
+		}
+		idx.vectors[p.cid] = vector
+		idx.norms[p.cid] = math.Sqrt(sum)
+	}
+	return idx
+}
+
+// getSimilarityIndex 获取相似度索引，超过重建间隔时重新构建，构建失败时继续使用旧索引
+func getSimilarityIndex(cfg *config.Config) *similarityIndex {
+	ttl := time.Duration(cfg.Collaborative.IndexTTLSec) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour // 默认值
+	}
+
+	similarityMu.RLock()
+	idx, builtAt := similarityIdx, similarityBuiltAt
+	similarityMu.RUnlock()
+	if time.Since(builtAt) < ttl {
+		return idx
+	}
+
+	similarityMu.Lock()
+	defer similarityMu.Unlock()
+	if time.Since(similarityBuiltAt) < ttl {
+		return similarityIdx
+	}
+
+	// 失败时同样记录构建时间，避免每次调用都访问数据库
+	similarityBuiltAt = time.Now()
+	profiles, err := loadParsedProfiles()
+	if err != nil {
+		logger.Error("构建相似用户索引失败，继续使用旧索引", "error", err)
+		return similarityIdx
+	}
+	similarityIdx = buildSimilarityIndex(profiles)
+	logger.Debug("相似用户索引已构建", "users", len(similarityIdx.vectors), "keywords", len(similarityIdx.postings))
+	return similarityIdx
+}
+
+// invalidateSimilarityIndex 画像更新后，下次使用时重新构建索引
+func invalidateSimilarityIndex() {
+	similarityMu.Lock()
+	similarityBuiltAt = time.Time{}
+	similarityMu.Unlock()
+}
+
+// similarTo 通过倒排索引计算与指定用户余弦相似度最高的用户
+func (idx *similarityIndex) similarTo(cid string, limit int, minSimilarity float64) []models.SimilarUser {
+	vector, ok := idx.vectors[cid]
+	if !ok {
+		return nil
+	}
+
+	// 只累加与目标用户有共同关键词的用户
+	dots := make(map[string]float64)
+	for key, weight := range vector {
+		for _, posting := range idx.postings[key] {
+			if posting.cid != cid {
+				dots[posting.cid] += weight * posting.weight
+			}
+		}
+	}
+
+	norm := idx.norms[cid]
+	out := make([]models.SimilarUser, 0, len(dots))
+	for other, dot := range dots {
+		similarity := dot / (norm * idx.norms[other])
+		if similarity >= minSimilarity {
+			out = append(out, models.SimilarUser{CID: other, Similarity: similarity})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Similarity != out[j].Similarity {
+			return out[i].Similarity > out[j].Similarity
+		}
+		return out[i].CID < out[j].CID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// FindSimilarUsers 获取关键词向量与指定用户最相似的用户
+func FindSimilarUsers(cfg *config.Config, cid string) []models.SimilarUser {
+	neighborCount := cfg.Collaborative.NeighborCount
+	if neighborCount <= 0 {
+		neighborCount = 20 // 默认值
+	}
+	minSimilarity := cfg.Collaborative.MinSimilarity
+	if minSimilarity <= 0 {
+		minSimilarity = 0.2 // 默认值
+	}
+	return getSimilarityIndex(cfg).similarTo(cid, neighborCount, minSimilarity)
+}
+
+// SimilarUserRecommendations 推荐相似用户点击或收到过、而该用户没有收到过的内容
+// 内容分数为 Σ 相似度 × 行为权重（点击过使用 click_weight，只收到过使用 push_weight）
+func SimilarUserRecommendations(cfg *config.Config, cid string, limit int) ([]models.RecommendationItem, error) {
+	neighbors := FindSimilarUsers(cfg, cid)
+	if len(neighbors) == 0 {
+		return []models.RecommendationItem{}, nil
+	}
+
+	lookbackDays := cfg.Collaborative.LookbackDays
+	if lookbackDays <= 0 {
+		lookbackDays = 14 // 默认值
+	}
+	clickWeight := cfg.Collaborative.ClickWeight
+	if clickWeight <= 0 {
+		clickWeight = 1.0 // 默认值
+	}
+	pushWeight := cfg.Collaborative.PushWeight
+	if pushWeight < 0 {
+		pushWeight = 0
+	}
+	since := time.Now().AddDate(0, 0, -lookbackDays)
+
+	similarity := make(map[string]float64, len(neighbors))
+	cids := make([]string, 0, len(neighbors))
+	for _, n := range neighbors {
+		similarity[n.CID] = n.Similarity
+		cids = append(cids, n.CID)
+	}
+
+	logs, err := repository.ListPushLogs(cids, since)
+	if err != nil {
+		return nil, err
+	}
+	clicks, err := repository.ListFeedbackItemKeys(cids, models.FeedbackClick, since)
+	if err != nil {
+		return nil, err
+	}
+	received, err := repository.ListPushedItemKeys(cid, since)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64)
+	items := make(map[string]models.RecommendationItem)
+	counted := make(map[string]bool)
+	for _, l := range logs {
+		if received[l.ItemKey] || counted[l.CID+"|"+l.ItemKey] {
+			continue
+		}
+		counted[l.CID+"|"+l.ItemKey] = true
+
+		weight := pushWeight
+		if clicks[l.CID][l.ItemKey] {
+			weight = clickWeight
+		}
+		if weight <= 0 {
+			continue
+		}
+		scores[l.ItemKey] += similarity[l.CID] * weight
+		if _, ok := items[l.ItemKey]; !ok {
+			items[l.ItemKey] = l.Item
+		}
+	}
+
+	keys := make([]string, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] > scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	out := make([]models.RecommendationItem, 0, len(keys))
+	for _, key := range keys {
+		item := items[key]
+		item.Source = sourceSimilarUsers
+		item.Score = scores[key]
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// supplementWithSimilarUsers 自身关键词检索到的内容较少时，用相似用户的内容补足
+func supplementWithSimilarUsers(cfg *config.Config, cid string, recommendations []models.RecommendationItem) []models.RecommendationItem {
+	if !cfg.Collaborative.Enabled {
+		return recommendations
+	}
+	minResults := cfg.Collaborative.MinResults
+	if minResults <= 0 {
+		minResults = cfg.RAG.TopK // 默认值
+	}
+	if len(recommendations) >= minResults {
+		return recommendations
+	}
+
+	items, err := SimilarUserRecommendations(cfg, cid, minResults)
+	if err != nil {
+		logger.Error("获取相似用户推荐失败", "cid", cid, "error", err)
+		return recommendations
+	}
+
+	existing := make(map[string]bool, len(recommendations))
+	for _, item := range recommendations {
+		existing[pushItemKey(item)] = true
+	}
+	added := 0
+	for _, item := range items {
+		if len(recommendations) >= minResults {
+			break
+		}
+		if key := pushItemKey(item); !existing[key] {
+			existing[key] = true
+			recommendations = append(recommendations, item)
+			added++
+		}
+	}
+	if added > 0 {
+		logger.Info("使用相似用户的内容补充推荐", "cid", cid, "added", added)
+	}
+	return recommendations
+}
+
+// RecordFeedback 记录用户对推送内容的反馈，返回内容标识
+func RecordFeedback(req *models.FeedbackRequest) (string, error) {
+	if req.Action != models.FeedbackClick {
+		return "", fmt.Errorf("action只能是click")
+	}
+	itemKey := strings.ToLower(strings.TrimSpace(req.ItemKey))
+	if itemKey == "" {
+		if req.Title == "" && req.Content == "" {
+			return "", fmt.Errorf("item_key和title/content不能同时为空")
+		}
+		itemKey = pushItemKey(models.RecommendationItem{Title: req.Title, Content: req.Content})
+	}
+	if err := ensureNotSuppressed(req.CID); err != nil {
+		return "", err
+	}
+	if err := repository.InsertItemFeedback(req.CID, itemKey, req.Action); err != nil {
+		return "", err
+	}
+	return itemKey, nil
+}
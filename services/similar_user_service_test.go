@@ -0,0 +1,187 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+)
+
+// similarityProfile 由 关键词->权重 构造用于相似度索引的画像
+func similarityProfile(cid string, weights map[string]float64) parsedProfile {
+	p := &models.Profile{}
+	for kw, w := range weights {
+		p.WeightedKeywords = append(p.WeightedKeywords, models.WeightedKeyword{Keyword: kw, Weight: w})
+	}
+	return parsedProfile{cid: cid, profile: p}
+}
+
+// useSimilarityIndex 用给定画像构建的索引替换相似用户索引，测试期间不从数据库重建
+func useSimilarityIndex(t *testing.T, profiles ...parsedProfile) {
+	t.Helper()
+	similarityMu.Lock()
+	prevIdx, prevBuiltAt := similarityIdx, similarityBuiltAt
+	similarityIdx = buildSimilarityIndex(profiles)
+	similarityBuiltAt = time.Now()
+	similarityMu.Unlock()
+	t.Cleanup(func() {
+		similarityMu.Lock()
+		similarityIdx, similarityBuiltAt = prevIdx, prevBuiltAt
+		similarityMu.Unlock()
+	})
+}
+
+// similarityTestProfiles a 与 d 的夹角最小，与 b 部分重合，与 c 没有共同关键词
+func similarityTestProfiles() []parsedProfile {
+	return []parsedProfile{
+		similarityProfile("a", map[string]float64{"比特币": 1, "以太坊": 1}),
+		similarityProfile("b", map[string]float64{"BTC": 1}),
+		similarityProfile("c", map[string]float64{"NFT": 1}),
+		similarityProfile("d", map[string]float64{"比特币": 0.6, "以太坊": 0.8}),
+	}
+}
+
+func TestSimilarityIndexCosine(t *testing.T) {
+	// 画像保存前已规范化，BTC 与 比特币 为同一关键词
+	cfg := useSynonyms(t, [2]string{"比特币", "BTC"})
+	profiles := similarityTestProfiles()
+	for i := range profiles {
+		normalizeProfileKeywords(cfg, profiles[i].profile)
+	}
+	idx := buildSimilarityIndex(append(profiles, similarityProfile("empty", nil)))
+
+	if _, ok := idx.vectors["empty"]; ok {
+		t.Error("没有关键词的用户不应加入索引")
+	}
+
+	got := idx.similarTo("a", 0, 0)
+	want := []models.SimilarUser{
+		{CID: "d", Similarity: (0.6 + 0.8) / math.Sqrt2},
+		{CID: "b", Similarity: 1 / math.Sqrt2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("相似用户为 %+v，期望 %+v（没有共同关键词的 c 不计算）", got, want)
+	}
+	for i := range want {
+		if got[i].CID != want[i].CID || math.Abs(got[i].Similarity-want[i].Similarity) > 1e-9 {
+			t.Errorf("第%d个相似用户为 %+v，期望 %+v", i+1, got[i], want[i])
+		}
+	}
+
+	// 相似度对称
+	for _, s := range idx.similarTo("d", 0, 0) {
+		if s.CID == "a" && math.Abs(s.Similarity-want[0].Similarity) > 1e-9 {
+			t.Errorf("d 与 a 的相似度为 %v，期望 %v", s.Similarity, want[0].Similarity)
+		}
+	}
+
+	if got := idx.similarTo("a", 0, 0.8); len(got) != 1 || got[0].CID != "d" {
+		t.Errorf("min_similarity=0.8 时相似用户为 %+v，期望只有 d", got)
+	}
+	if got := idx.similarTo("a", 1, 0); len(got) != 1 || got[0].CID != "d" {
+		t.Errorf("limit=1 时相似用户为 %+v，期望只有 d", got)
+	}
+	if got := idx.similarTo("unknown", 0, 0); len(got) != 0 {
+		t.Errorf("没有画像的用户不应有相似用户，实际 %+v", got)
+	}
+}
+
+func TestFindSimilarUsersMinSimilarity(t *testing.T) {
+	// e 与 a 的相似度约为0.07
+	useSimilarityIndex(t,
+		similarityProfile("a", map[string]float64{"比特币": 1, "以太坊": 1}),
+		similarityProfile("d", map[string]float64{"比特币": 0.6, "以太坊": 0.8}),
+		similarityProfile("e", map[string]float64{"比特币": 0.1, "NFT": 1}),
+	)
+
+	cfg := &config.Config{}
+	cfg.Collaborative.IndexTTLSec = 3600
+	tests := []struct {
+		minSimilarity float64
+		want          int
+	}{
+		{0, 1}, // 默认0.2
+		{0.05, 2},
+		{0.995, 0},
+	}
+	for _, tt := range tests {
+		cfg.Collaborative.MinSimilarity = tt.minSimilarity
+		if got := FindSimilarUsers(cfg, "a"); len(got) != tt.want {
+			t.Errorf("min_similarity=%v 时相似用户为 %+v，期望 %d 个", tt.minSimilarity, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarUserRecommendationsWeighting(t *testing.T) {
+	useSimilarityIndex(t,
+		similarityProfile("a", map[string]float64{"比特币": 1, "以太坊": 1}),
+		similarityProfile("b", map[string]float64{"比特币": 1}),
+		similarityProfile("d", map[string]float64{"比特币": 0.6, "以太坊": 0.8}),
+	)
+	simB, simD := 1/math.Sqrt2, 1.4/math.Sqrt2
+
+	fake := dbtest.Open(t)
+	item := func(key string) driver.Value {
+		b, _ := json.Marshal(models.RecommendationItem{Title: key})
+		return string(b)
+	}
+	now := time.Now()
+	fake.OnQuery("SELECT id, cid, item_key, item_json", dbtest.Rows(
+		[]string{"id", "cid", "item_key", "item_json", "created_at"},
+		[]driver.Value{int64(1), "b", "item1", item("item1"), now},
+		[]driver.Value{int64(2), "d", "item1", item("item1"), now},
+		[]driver.Value{int64(3), "d", "item2", item("item2"), now},
+		[]driver.Value{int64(4), "d", "item2", item("item2"), now}, // 同一用户重复推送只计一次
+		[]driver.Value{int64(5), "b", "item3", item("item3"), now},
+		[]driver.Value{int64(6), "d", "item4", item("item4"), now},
+	))
+	fake.OnQuery("FROM item_feedback", dbtest.Rows(
+		[]string{"cid", "item_key"},
+		[]driver.Value{"b", "item1"},
+		[]driver.Value{"d", "item2"},
+	))
+	// 目标用户已收到过 item4
+	fake.OnQuery("SELECT DISTINCT item_key FROM push_logs", dbtest.Rows([]string{"item_key"}, []driver.Value{"item4"}))
+
+	cfg := &config.Config{}
+	cfg.Collaborative.IndexTTLSec = 3600
+	cfg.Collaborative.MinSimilarity = 0.1
+	cfg.Collaborative.ClickWeight = 1
+	cfg.Collaborative.PushWeight = 0.2
+
+	got, err := SimilarUserRecommendations(cfg, "a", 0)
+	if err != nil {
+		t.Fatalf("获取相似用户推荐失败: %v", err)
+	}
+	want := []struct {
+		title string
+		score float64
+	}{
+		{"item2", simD * 1},
+		{"item1", simB*1 + simD*0.2},
+		{"item3", simB * 0.2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("推荐为 %+v，期望 %d 条", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Title != w.title || math.Abs(got[i].Score-w.score) > 1e-9 || got[i].Source != sourceSimilarUsers {
+			t.Errorf("第%d条为 %s（%.4f，%s），期望 %s（%.4f）", i+1, got[i].Title, got[i].Score, got[i].Source, w.title, w.score)
+		}
+	}
+
+	// push_weight 为0时只推荐相似用户点击过的内容
+	cfg.Collaborative.PushWeight = 0
+	got, err = SimilarUserRecommendations(cfg, "a", 0)
+	if err != nil {
+		t.Fatalf("获取相似用户推荐失败: %v", err)
+	}
+	if len(got) != 2 || got[0].Title != "item2" || got[1].Title != "item1" || math.Abs(got[1].Score-simB) > 1e-9 {
+		t.Errorf("push_weight=0 时推荐为 %+v，期望 item2、item1（只计点击）", got)
+	}
+}
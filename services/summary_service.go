@@ -1,23 +1,60 @@
 package services
 
 import (
+	"strings"
+
 	"ai_push_message/models"
 	"ai_push_message/repository"
+	"ai_push_message/utils"
 )
 
-func SearchGroupSummaries(keywords []string, lookbackDays, topN int) ([]models.RecommendationItem, error) {
-	gs, err := repository.SearchGroupSummariesByKeywords(keywords, lookbackDays, topN)
+// SearchGroupSummaries 检索近期与关键词匹配的群聊总结
+// 分数为命中关键词的权重之和，关键话题命中的权重高于总结正文命中
+func SearchGroupSummaries(keywords []models.WeightedKeyword, lookbackDays, topN int) ([]models.RecommendationItem, error) {
+	terms := make([]string, 0, len(keywords))
+	for _, wk := range keywords {
+		terms = append(terms, wk.Keyword)
+	}
+
+	gs, err := repository.SearchGroupSummariesByKeywords(terms, lookbackDays, topN)
 	if err != nil {
 		return nil, err
 	}
+
+	formatter := utils.NewRAGContentFormatter()
 	items := make([]models.RecommendationItem, 0, len(gs))
 	for _, g := range gs {
+		topics := strings.ToLower(g.KeyTopics)
+		content := strings.ToLower(g.Content)
+
+		score, bestWeight, bestKeyword := 0.0, 0.0, ""
+		for _, wk := range keywords {
+			kw := strings.ToLower(strings.TrimSpace(wk.Keyword))
+			if kw == "" {
+				continue
+			}
+			matched := 0.0
+			if strings.Contains(topics, kw) {
+				matched = wk.Weight
+			} else if strings.Contains(content, kw) {
+				matched = wk.Weight * 0.5
+			}
+			score += matched
+			if matched > bestWeight {
+				bestWeight = matched
+				bestKeyword = wk.Keyword
+			}
+		}
+
+		title, summary := formatter.FormatTitleAndContent(g.GroupName+" | "+g.KeyTopics, g.Content)
 		items = append(items, models.RecommendationItem{
-			Source: "group_summary",
-			Title:  g.GroupName + " | " + g.KeyTopics,
-			URL:    "",
-			Score:  0.8,
-			RefID:  repository.IdToString(g.ID),
+			Source:        sourceGroupSummary,
+			Title:         title,
+			Content:       summary,
+			URL:           "",
+			Score:         score,
+			RefID:         repository.IdToString(g.ID),
+			SearchKeyword: bestKeyword,
 		})
 	}
 	return items, nil
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// keywordSeparators 复合关键词的分隔符，如"DW20与比特币"
+var keywordSeparators = []string{"与", "和", "及", "、", "&", "/", "+", "，", ","}
+
+// synonymDictionary 内存中的同义词词典
+type synonymDictionary struct {
+	canonicalOf map[string]string   // 归一化后的词 -> 规范词（规范词本身也收录）
+	synonymsOf  map[string][]string // 规范词 -> 同义词
+}
+
+var (
+	synonymMu       sync.RWMutex
+	synonymDict     = buildSynonymDictionary(nil)
+	synonymLoadedAt time.Time
+)
+
+// synonymKey 词典查找键：全角转半角、英文小写并去掉空白，"DW20 代币"与"dw20代币"视为同一写法
+func synonymKey(term string) string {
+	return strings.ReplaceAll(normalizeRAGQuery(term), " ", "")
+}
+
+// buildSynonymDictionary 由数据库中的映射构建词典
+func buildSynonymDictionary(entries []models.KeywordSynonym) *synonymDictionary {
+	d := &synonymDictionary{
+		canonicalOf: make(map[string]string),
+		synonymsOf:  make(map[string][]string),
+	}
+	for _, e := range entries {
+		d.canonicalOf[synonymKey(e.Canonical)] = e.Canonical
+	}
+	for _, e := range entries {
+		// 同义词与某个规范词写法相同时，以规范词为准
+		if _, ok := d.canonicalOf[synonymKey(e.Synonym)]; !ok {
+			d.canonicalOf[synonymKey(e.Synonym)] = e.Canonical
+		}
+		d.synonymsOf[e.Canonical] = append(d.synonymsOf[e.Canonical], e.Synonym)
+	}
+	return d
+}
+
+// getSynonymDictionary 获取词典，超过重新加载间隔时从数据库重新加载，加载失败时继续使用旧词典
+func getSynonymDictionary(cfg *config.Config) *synonymDictionary {
+	interval := time.Duration(cfg.Synonyms.ReloadIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute // 默认值
+	}
+
+	synonymMu.RLock()
+	dict, loadedAt := synonymDict, synonymLoadedAt
+	synonymMu.RUnlock()
+	if time.Since(loadedAt) < interval {
+		return dict
+	}
+
+	synonymMu.Lock()
+	defer synonymMu.Unlock()
+	if time.Since(synonymLoadedAt) < interval {
+		return synonymDict
+	}
+
+	// 失败时同样记录加载时间，避免每次调用都访问数据库
+	synonymLoadedAt = time.Now()
+	entries, err := repository.ListSynonyms()
+	if err != nil {
+		logger.Error("加载同义词词典失败，继续使用旧词典", "error", err)
+		return synonymDict
+	}
+	synonymDict = buildSynonymDictionary(entries)
+	logger.Debug("同义词词典已加载", "entries", len(entries))
+	return synonymDict
+}
+
+// invalidateSynonymDictionary 词典被编辑后，下次使用时重新加载
+func invalidateSynonymDictionary() {
+	synonymMu.Lock()
+	synonymLoadedAt = time.Time{}
+	synonymMu.Unlock()
+}
+
+// canonical 返回词典中的规范写法
+func (d *synonymDictionary) canonical(term string) (string, bool) {
+	c, ok := d.canonicalOf[synonymKey(term)]
+	return c, ok
+}
+
+// canonicalTerms 将关键词规范化；未收录的复合关键词在各部分都已收录时拆分为多个规范词，
+// 否则保留整理空白后的原词
+func (d *synonymDictionary) canonicalTerms(term string) []string {
+	term = strings.Join(strings.Fields(term), " ")
+	if term == "" {
+		return nil
+	}
+	if c, ok := d.canonical(term); ok {
+		return []string{c}
+	}
+	if parts := d.splitCompound(term); len(parts) > 1 {
+		return parts
+	}
+	return []string{term}
+}
+
+// splitCompound 按分隔符拆分复合关键词，任一部分未收录时不拆分（避免误拆"参与"等普通词）
+func (d *synonymDictionary) splitCompound(term string) []string {
+	parts := []string{term}
+	for _, sep := range keywordSeparators {
+		next := make([]string, 0, len(parts))
+		for _, p := range parts {
+			next = append(next, strings.Split(p, sep)...)
+		}
+		parts = next
+	}
+	if len(parts) < 2 {
+		return nil
+	}
+
+	out := make([]string, 0, len(parts))
+	seen := make(map[string]bool)
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		c, ok := d.canonical(p)
+		if !ok {
+			return nil
+		}
+		if !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// canonicalizeKeywords 规范化带权重的关键词，归为同一规范词的关键词合并并保留最高权重
+func canonicalizeKeywords(cfg *config.Config, keywords []models.WeightedKeyword) []models.WeightedKeyword {
+	if !cfg.Synonyms.Enabled {
+		return keywords
+	}
+	dict := getSynonymDictionary(cfg)
+
+	out := make([]models.WeightedKeyword, 0, len(keywords))
+	index := make(map[string]int)
+	for _, wk := range keywords {
+		for _, term := range dict.canonicalTerms(wk.Keyword) {
+			key := synonymKey(term)
+			if i, ok := index[key]; ok {
+				if wk.Weight > out[i].Weight {
+					out[i].Weight = wk.Weight
+				}
+				// 出现时间均为同一格式的 RFC3339 字符串，可直接比较
+				if wk.LastSeen > out[i].LastSeen {
+					out[i].LastSeen = wk.LastSeen
+				}
+				out[i].Evidence += wk.Evidence
+				continue
+			}
+			index[key] = len(out)
+			canonical := wk
+			canonical.Keyword = term
+			out = append(out, canonical)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Weight > out[j].Weight })
+	return out
+}
+
+// canonicalizeTerms 规范化关键词列表，保持原有顺序并去重
+func canonicalizeTerms(cfg *config.Config, terms []string) []string {
+	if !cfg.Synonyms.Enabled {
+		return terms
+	}
+	dict := getSynonymDictionary(cfg)
+
+	out := make([]string, 0, len(terms))
+	seen := make(map[string]bool)
+	for _, t := range terms {
+		for _, term := range dict.canonicalTerms(t) {
+			if key := synonymKey(term); !seen[key] {
+				seen[key] = true
+				out = append(out, term)
+			}
+		}
+	}
+	return out
+}
+
+// normalizeProfileKeywords 存储画像前按同义词词典规范化画像中的关键词
+func normalizeProfileKeywords(cfg *config.Config, profile *models.Profile) {
+	if !cfg.Synonyms.Enabled {
+		return
+	}
+	profile.WeightedKeywords = canonicalizeKeywords(cfg, profile.WeightedKeywords)
+	profile.Interests = canonicalizeTerms(cfg, profile.Interests)
+	profile.Normalize()
+}
+
+// expandKeywordsWithSynonyms 为每个关键词追加同义词查询，扩展查询的权重按比例降低
+// 返回扩展后的关键词，以及 查询 -> 原关键词 的映射
+func expandKeywordsWithSynonyms(cfg *config.Config, keywords []models.WeightedKeyword) ([]models.WeightedKeyword, map[string]string) {
+	origin := make(map[string]string, len(keywords))
+	for _, wk := range keywords {
+		origin[wk.Keyword] = wk.Keyword
+	}
+	if !cfg.Synonyms.Enabled {
+		return keywords, origin
+	}
+
+	ratio := cfg.Synonyms.ExpansionWeight
+	if ratio <= 0 || ratio > 1 {
+		ratio = 0.5 // 默认值
+	}
+	maxExpansions := cfg.Synonyms.MaxExpansions
+	if maxExpansions <= 0 {
+		maxExpansions = 2 // 默认值
+	}
+
+	dict := getSynonymDictionary(cfg)
+	seen := make(map[string]bool, len(keywords))
+	for _, wk := range keywords {
+		seen[synonymKey(wk.Keyword)] = true
+	}
+
+	expanded := append([]models.WeightedKeyword(nil), keywords...)
+	for _, wk := range keywords {
+		added := 0
+		for _, synonym := range dict.synonymsOf[wk.Keyword] {
+			if added >= maxExpansions {
+				break
+			}
+			key := synonymKey(synonym)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			expanded = append(expanded, models.WeightedKeyword{Keyword: synonym, Weight: wk.Weight * ratio})
+			origin[synonym] = wk.Keyword
+			added++
+		}
+	}
+	return expanded, origin
+}
+
+// =====================
+// 词典管理
+// =====================
+
+// ListSynonymGroups 获取词典中的全部规范词及同义词
+func ListSynonymGroups() ([]models.SynonymGroup, error) {
+	entries, err := repository.ListSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]models.SynonymGroup, 0)
+	index := make(map[string]int)
+	for _, e := range entries {
+		i, ok := index[e.Canonical]
+		if !ok {
+			i = len(groups)
+			index[e.Canonical] = i
+			groups = append(groups, models.SynonymGroup{Canonical: e.Canonical, Synonyms: []string{}})
+		}
+		groups[i].Synonyms = append(groups[i].Synonyms, e.Synonym)
+	}
+	return groups, nil
+}
+
+// ValidateSynonymGroup 校验并整理同义词组：去除空白、重复项和与规范词相同的写法
+func ValidateSynonymGroup(group *models.SynonymGroup) error {
+	group.Canonical = strings.Join(strings.Fields(group.Canonical), " ")
+	if group.Canonical == "" {
+		return fmt.Errorf("canonical不能为空")
+	}
+
+	seen := map[string]bool{synonymKey(group.Canonical): true}
+	synonyms := make([]string, 0, len(group.Synonyms))
+	for _, s := range group.Synonyms {
+		s = strings.Join(strings.Fields(s), " ")
+		if s == "" || seen[synonymKey(s)] {
+			continue
+		}
+		seen[synonymKey(s)] = true
+		synonyms = append(synonyms, s)
+	}
+	if len(synonyms) == 0 {
+		return fmt.Errorf("synonyms不能为空")
+	}
+	group.Synonyms = synonyms
+	return nil
+}
+
+// SaveSynonymGroup 保存同义词组，替换规范词下原有的同义词
+func SaveSynonymGroup(group *models.SynonymGroup) error {
+	if err := ValidateSynonymGroup(group); err != nil {
+		return err
+	}
+	if err := repository.ReplaceSynonymGroup(group.Canonical, group.Synonyms); err != nil {
+		return err
+	}
+	invalidateSynonymDictionary()
+	logger.Info("同义词组已保存", "canonical", group.Canonical, "synonyms", group.Synonyms)
+	return nil
+}
+
+// DeleteSynonymGroup 删除规范词及其同义词，不存在时返回 sql.ErrNoRows
+func DeleteSynonymGroup(canonical string) error {
+	n, err := repository.DeleteSynonymGroup(canonical)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	invalidateSynonymDictionary()
+	logger.Info("同义词组已删除", "canonical", canonical, "removed", n)
+	return nil
+}
+
+// =====================
+// LLM同义词建议
+// =====================
+
+// synonymSuggestionResp LLM返回的同义词分组
+type synonymSuggestionResp struct {
+	Groups []models.SynonymGroup `json:"groups"`
+}
+
+// GenerateSynonymSuggestions 调用LLM分析关键词的不同写法，结果写入审核队列，返回新增建议数
+// terms 为空时使用画像中出现最多且尚未收录的关键词
+func GenerateSynonymSuggestions(cfg *config.Config, terms []string) (int, error) {
+	if !cfg.Synonyms.LLMSuggestions {
+		return 0, fmt.Errorf("未启用LLM同义词建议（synonyms.llm_suggestions）")
+	}
+
+	if len(terms) == 0 {
+		var err error
+		if terms, err = unknownProfileKeywords(cfg); err != nil {
+			return 0, err
+		}
+	}
+	if len(terms) < 2 {
+		return 0, nil
+	}
+
+	prompt := fmt.Sprintf(`以下是用户画像中的关键词，其中一些是同一事物的不同写法（大小写、空格、简称、附加"代币""币"等后缀）。
+请找出这些写法并分组，每组给出一个规范写法（canonical）和其余写法（synonyms）。
+只能使用列表中出现的关键词作为同义词，不确定的不要分组。以JSON格式返回：
+{"groups": [{"canonical": "DW20", "synonyms": ["dw20代币", "DW20 币"]}]}
+
+关键词列表：
+%s`, strings.Join(terms, "\n"))
+
+	content, err := callLLMCompletion(cfg, prompt)
+	if err != nil {
+		return 0, err
+	}
+	var resp synonymSuggestionResp
+	if err := json.Unmarshal([]byte(extractJSONFromText(content)), &resp); err != nil {
+		return 0, fmt.Errorf("解析LLM同义词建议失败: %v", err)
+	}
+
+	provided := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		provided[synonymKey(t)] = true
+	}
+	dict := getSynonymDictionary(cfg)
+
+	added := 0
+	for _, group := range resp.Groups {
+		if err := ValidateSynonymGroup(&group); err != nil {
+			continue
+		}
+		for _, synonym := range group.Synonyms {
+			// 只接受列表中出现且尚未收录的写法，避免模型编造
+			if !provided[synonymKey(synonym)] {
+				continue
+			}
+			if _, ok := dict.canonical(synonym); ok {
+				continue
+			}
+			inserted, err := repository.InsertSynonymSuggestion(group.Canonical, synonym, "llm")
+			if err != nil {
+				logger.Error("写入同义词建议失败", "canonical", group.Canonical, "synonym", synonym, "error", err)
+				continue
+			}
+			if inserted {
+				added++
+			}
+		}
+	}
+
+	logger.Info("LLM同义词建议已加入审核队列", "terms", len(terms), "groups", len(resp.Groups), "added", added)
+	return added, nil
+}
+
+// unknownProfileKeywords 统计画像关键词出现次数，返回出现最多且词典未收录的关键词
+func unknownProfileKeywords(cfg *config.Config) ([]string, error) {
+	profileKeywords, err := repository.ListProfileKeywords()
+	if err != nil {
+		return nil, err
+	}
+
+	dict := getSynonymDictionary(cfg)
+	counts := make(map[string]int)
+	for _, keywords := range profileKeywords {
+		for _, kw := range keywords {
+			if _, ok := dict.canonical(kw); !ok {
+				counts[kw]++
+			}
+		}
+	}
+
+	terms := make([]string, 0, len(counts))
+	for kw := range counts {
+		terms = append(terms, kw)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+
+	limit := cfg.Synonyms.SuggestionBatchSize
+	if limit <= 0 {
+		limit = 50 // 默认值
+	}
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms, nil
+}
+
+// ListSynonymSuggestions 获取同义词建议，status 为空时返回全部
+func ListSynonymSuggestions(status string) ([]models.SynonymSuggestion, error) {
+	return repository.ListSynonymSuggestions(status, 200)
+}
+
+// ReviewSynonymSuggestion 审核同义词建议，通过后加入词典；建议不存在时返回 sql.ErrNoRows
+func ReviewSynonymSuggestion(id int64, approve bool) (*models.SynonymSuggestion, error) {
+	suggestion, err := repository.GetSynonymSuggestion(id)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion.Status != models.SuggestionPending {
+		return nil, fmt.Errorf("建议已审核，当前状态: %s", suggestion.Status)
+	}
+
+	status := models.SuggestionRejected
+	if approve {
+		status = models.SuggestionApproved
+		if err := repository.AddSynonym(suggestion.Canonical, suggestion.Synonym); err != nil {
+			return nil, err
+		}
+		invalidateSynonymDictionary()
+	}
+	if err := repository.UpdateSynonymSuggestionStatus(id, status); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	suggestion.Status = status
+	suggestion.ReviewedAt = &now
+	logger.Info("同义词建议已审核", "id", id, "canonical", suggestion.Canonical, "synonym", suggestion.Synonym, "status", status)
+	return suggestion, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"ai_push_message/config"
+	"ai_push_message/models"
+)
+
+// useSynonyms 用给定的映射替换内存中的同义词词典，测试期间不从数据库重新加载
+func useSynonyms(t *testing.T, entries ...[2]string) *config.Config {
+	t.Helper()
+	synonymMu.Lock()
+	prevDict, prevLoadedAt := synonymDict, synonymLoadedAt
+	list := make([]models.KeywordSynonym, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, models.KeywordSynonym{Canonical: e[0], Synonym: e[1]})
+	}
+	synonymDict = buildSynonymDictionary(list)
+	synonymLoadedAt = time.Now()
+	synonymMu.Unlock()
+	t.Cleanup(func() {
+		synonymMu.Lock()
+		synonymDict, synonymLoadedAt = prevDict, prevLoadedAt
+		synonymMu.Unlock()
+	})
+
+	cfg := &config.Config{}
+	cfg.Synonyms.Enabled = true
+	cfg.Synonyms.ReloadIntervalSec = 3600
+	return cfg
+}
+
+func TestCanonicalizeTerms(t *testing.T) {
+	cfg := useSynonyms(t,
+		[2]string{"DW20", "dw20代币"},
+		[2]string{"DW20", "DW20 币"},
+		[2]string{"比特币", "BTC"},
+		[2]string{"以太坊", "ETH"},
+	)
+
+	tests := []struct {
+		name  string
+		terms []string
+		want  []string
+	}{
+		{"同义词归为规范词", []string{"dw20代币"}, []string{"DW20"}},
+		{"忽略大小写和空白", []string{"dw20 代币", "btc"}, []string{"DW20", "比特币"}},
+		{"全角写法", []string{"ＢＴＣ"}, []string{"比特币"}},
+		{"规范词本身", []string{"DW20"}, []string{"DW20"}},
+		{"归为同一规范词后去重并保持顺序", []string{"ETH", "BTC", "以太坊", "DW20 币", "dw20代币"}, []string{"以太坊", "比特币", "DW20"}},
+		{"复合关键词各部分都已收录时拆分", []string{"BTC与ETH"}, []string{"比特币", "以太坊"}},
+		{"复合关键词有未收录部分时不拆分", []string{"参与质押"}, []string{"参与质押"}},
+		{"未收录的词整理空白后保留", []string{"  Layer   2 "}, []string{"Layer 2"}},
+		{"空白词被丢弃", []string{" ", "BTC"}, []string{"比特币"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalizeTerms(cfg, tt.terms); !slices.Equal(got, tt.want) {
+				t.Errorf("canonicalizeTerms(%q) = %q，期望 %q", tt.terms, got, tt.want)
+			}
+		})
+	}
+
+	cfg.Synonyms.Enabled = false
+	if got := canonicalizeTerms(cfg, []string{"BTC"}); !slices.Equal(got, []string{"BTC"}) {
+		t.Errorf("未启用时不应规范化，实际 %q", got)
+	}
+}
+
+func TestCanonicalizeKeywordsMergesWeights(t *testing.T) {
+	cfg := useSynonyms(t, [2]string{"比特币", "BTC"})
+	got := canonicalizeKeywords(cfg, []models.WeightedKeyword{
+		{Keyword: "BTC", Weight: 0.4, Evidence: 2, LastSeen: "2026-01-02T00:00:00Z"},
+		{Keyword: "合约", Weight: 0.6, Evidence: 1},
+		{Keyword: "比特币", Weight: 0.8, Evidence: 1, LastSeen: "2026-01-01T00:00:00Z"},
+	})
+	if len(got) != 2 || got[0].Keyword != "比特币" || got[1].Keyword != "合约" {
+		t.Fatalf("规范化结果为 %+v，期望 比特币、合约 按权重排序", got)
+	}
+	btc := got[0]
+	if btc.Weight != 0.8 || btc.Evidence != 3 || btc.LastSeen != "2026-01-02T00:00:00Z" {
+		t.Errorf("合并后为 %+v，期望权重0.8、出现3次、最近出现 2026-01-02", btc)
+	}
+}
+
+func TestExpandKeywordsWithSynonyms(t *testing.T) {
+	cfg := useSynonyms(t,
+		[2]string{"比特币", "BTC"},
+		[2]string{"比特币", "Bitcoin"},
+		[2]string{"比特币", "大饼"},
+		[2]string{"以太坊", "ETH"},
+	)
+	keywords := []models.WeightedKeyword{{Keyword: "比特币", Weight: 0.8}, {Keyword: "以太坊", Weight: 0.6}}
+
+	t.Run("扩展权重按比例降低", func(t *testing.T) {
+		cfg.Synonyms.ExpansionWeight = 0.25
+		cfg.Synonyms.MaxExpansions = 5
+		expanded, origin := expandKeywordsWithSynonyms(cfg, keywords)
+
+		want := map[string]float64{"比特币": 0.8, "以太坊": 0.6, "BTC": 0.2, "Bitcoin": 0.2, "大饼": 0.2, "ETH": 0.15}
+		if len(expanded) != len(want) {
+			t.Fatalf("扩展结果为 %+v，期望 %v", expanded, want)
+		}
+		for _, wk := range expanded {
+			if w, ok := want[wk.Keyword]; !ok || math.Abs(wk.Weight-w) > 1e-9 {
+				t.Errorf("%s 权重为 %v，期望 %v", wk.Keyword, wk.Weight, w)
+			}
+		}
+		if origin["BTC"] != "比特币" || origin["ETH"] != "以太坊" || origin["比特币"] != "比特币" {
+			t.Errorf("查询来源映射为 %v", origin)
+		}
+		if expanded[0].Keyword != "比特币" || expanded[1].Keyword != "以太坊" {
+			t.Errorf("原关键词应排在扩展查询之前，实际 %+v", expanded)
+		}
+	})
+
+	t.Run("每个关键词最多扩展 max_expansions 个", func(t *testing.T) {
+		cfg.Synonyms.ExpansionWeight = 0.5
+		cfg.Synonyms.MaxExpansions = 1
+		expanded, _ := expandKeywordsWithSynonyms(cfg, keywords)
+		got := make([]string, 0, len(expanded))
+		for _, wk := range expanded {
+			got = append(got, wk.Keyword)
+		}
+		if want := []string{"比特币", "以太坊", "BTC", "ETH"}; !slices.Equal(got, want) {
+			t.Errorf("扩展结果为 %q，期望 %q", got, want)
+		}
+	})
+
+	t.Run("未配置时使用默认比例和上限", func(t *testing.T) {
+		cfg.Synonyms.ExpansionWeight = 0
+		cfg.Synonyms.MaxExpansions = 0
+		expanded, _ := expandKeywordsWithSynonyms(cfg, keywords[:1])
+		if len(expanded) != 3 {
+			t.Fatalf("默认最多扩展2个，实际 %+v", expanded)
+		}
+		if expanded[1].Weight != 0.4 {
+			t.Errorf("默认扩展权重为原权重的一半，实际 %v", expanded[1].Weight)
+		}
+	})
+
+	t.Run("已在关键词中的同义词不重复扩展", func(t *testing.T) {
+		cfg.Synonyms.MaxExpansions = 2
+		expanded, _ := expandKeywordsWithSynonyms(cfg, []models.WeightedKeyword{{Keyword: "比特币", Weight: 0.8}, {Keyword: "btc", Weight: 0.5}})
+		for _, wk := range expanded[2:] {
+			if wk.Keyword == "BTC" {
+				t.Errorf("BTC 已作为关键词出现，不应再扩展: %+v", expanded)
+			}
+		}
+		if len(expanded) != 4 {
+			t.Errorf("应跳过 BTC 继续扩展其余同义词，实际 %+v", expanded)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"ai_push_message/logger"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+// deletionReasonUserRequest 用户请求删除数据
+const deletionReasonUserRequest = "user_request"
+
+// ErrUserSuppressed 用户已删除全部数据，不再为其生成或保存数据
+var ErrUserSuppressed = repository.ErrUserSuppressed
+
+// ensureNotSuppressed 用户已删除数据时返回 ErrUserSuppressed
+func ensureNotSuppressed(cid string) error {
+	suppressed, err := repository.IsUserSuppressed(cid)
+	if err != nil {
+		return fmt.Errorf("检查用户是否已删除数据失败: %w", err)
+	}
+	if suppressed {
+		return ErrUserSuppressed
+	}
+	return nil
+}
+
+// DeleteUserData 删除用户的画像、推荐、推送记录、反馈等全部衍生数据，
+// 并记录该用户，之后的画像生成不再处理
+func DeleteUserData(cid string) (*models.UserDataDeletion, error) {
+	deleted, err := repository.DeleteUserData(cid, deletionReasonUserRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// 内存中的相似用户索引仍包含该用户的关键词向量
+	invalidateSimilarityIndex()
+
+	logger.Info("已删除用户数据", "cid", cid, "deleted", deleted)
+	return &models.UserDataDeletion{CID: cid, Deleted: deleted}, nil
+}
+
+// ExportUserData 导出系统为用户生成和保存的全部数据
+func ExportUserData(cid string) (*models.UserDataExport, error) {
+	export := &models.UserDataExport{CID: cid, ExportedAt: time.Now()}
+
+	stored, err := repository.GetProfile(cid)
+	switch {
+	case err == nil:
+		profile, parseErr := models.ParseUserProfile(stored)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		export.Profile = profile
+		updatedAt := stored.UpdatedAt
+		export.ProfileUpdatedAt = &updatedAt
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	if export.ProfileHistory, err = repository.ListAllProfileHistory(cid); err != nil {
+		return nil, err
+	}
+	for i := range export.ProfileHistory {
+		if p, err := models.ParseProfile(export.ProfileHistory[i].ProfileRaw); err == nil {
+			export.ProfileHistory[i].Profile = p
+		}
+	}
+
+	overrides, err := repository.GetProfileOverrides(cid)
+	switch {
+	case err == nil:
+		export.Overrides = overrides
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	preferences, err := repository.GetUserPreferences(cid)
+	switch {
+	case err == nil:
+		export.Preferences = preferences
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	recommendations, err := repository.GetRecommendations(cid)
+	switch {
+	case err == nil:
+		export.Recommendations = recommendations
+	case errors.Is(err, sql.ErrNoRows):
+		export.Recommendations = []models.RecommendationItem{}
+	default:
+		return nil, err
+	}
+
+	if export.PushLogs, err = repository.ListUserPushLogs(cid); err != nil {
+		return nil, err
+	}
+	if export.Feedback, err = repository.ListUserFeedback(cid); err != nil {
+		return nil, err
+	}
+	if export.Segments, err = repository.ListUserSegmentNames(cid); err != nil {
+		return nil, err
+	}
+	if export.ModerationReviews, err = repository.ListUserModerationReviews(cid); err != nil {
+		return nil, err
+	}
+
+	suppression, err := repository.GetUserSuppression(cid)
+	switch {
+	case err == nil:
+		export.Suppression = suppression
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	return export, nil
+}
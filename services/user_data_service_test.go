@@ -0,0 +1,77 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"ai_push_message/config"
+	"ai_push_message/db/dbtest"
+	"ai_push_message/models"
+	"ai_push_message/repository"
+)
+
+func TestDeletedUserIsNotSavedOrPushed(t *testing.T) {
+	fake := dbtest.Open(t)
+	suppressed := make(map[string]bool)
+	fake.OnExec("INSERT INTO user_suppressions", func(args []driver.Value) (int64, error) {
+		suppressed[args[0].(string)] = true
+		return 1, nil
+	})
+	fake.OnQuery("FROM user_suppressions", func(args []driver.Value) ([]string, [][]driver.Value, error) {
+		n := int64(0)
+		if suppressed[args[0].(string)] {
+			n = 1
+		}
+		return []string{"count"}, [][]driver.Value{{n}}, nil
+	})
+	fake.OnQuery("FROM recommendation_cache", dbtest.Rows([]string{"count"}, []driver.Value{int64(0)}))
+
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.Write([]byte(`{"success":true,"errCode":200}`))
+	}))
+	defer srv.Close()
+	cfg := &config.Config{}
+	cfg.ExternalAPI.TagPushURL = srv.URL
+
+	items := []models.RecommendationItem{{Title: "比特币行情", Content: "今日走势"}}
+
+	// 未删除的用户正常保存和推送
+	if err := repository.SaveRecommendations("keep", items, nil); err != nil {
+		t.Fatalf("保存推荐失败: %v", err)
+	}
+	if pushViaHTTP(cfg, "keep", items) != pushSent || sent.Load() != 1 {
+		t.Fatalf("未删除的用户应推送成功，推送次数 %d", sent.Load())
+	}
+
+	if _, err := DeleteUserData("gone"); err != nil {
+		t.Fatalf("删除用户数据失败: %v", err)
+	}
+	before := len(fake.Executed())
+
+	err := repository.SaveRecommendations("gone", items, nil)
+	if !errors.Is(err, ErrUserSuppressed) {
+		t.Errorf("保存已删除用户的推荐返回 %v，期望 ErrUserSuppressed", err)
+	}
+	if got := pushViaHTTP(cfg, "gone", items); got != pushSkipped {
+		t.Errorf("推送已删除的用户结果为 %s，期望 skipped", got)
+	}
+
+	if n := sent.Load(); n != 1 {
+		t.Errorf("已删除的用户收到了推送，推送次数 %d", n)
+	}
+	for _, s := range fake.Executed()[before:] {
+		switch {
+		case s.Query == "COMMIT":
+			t.Error("已删除用户的推荐缓存不应提交")
+		case s.Query != "ROLLBACK" && !strings.Contains(s.Query, "recommendation_cache"):
+			t.Errorf("已删除的用户不应写入: %s", s.Query)
+		}
+	}
+}
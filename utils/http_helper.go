@@ -62,11 +62,11 @@ func FormatRecommendations(recommendations []models.RecommendationItem) []map[st
 	return tags
 }
 
-// ParseProfileData 解析用户画像数据
-func ParseProfileData(w http.ResponseWriter, profileRaw string) (map[string]interface{}, bool) {
-	var profileData map[string]interface{}
-	if err := json.Unmarshal([]byte(profileRaw), &profileData); err != nil {
-		WriteCustomErrorResponse(w, models.CodeServerError, "解析画像数据失败: "+err.Error(), map[string]interface{}{})
+// ParseProfileData 解析用户画像数据，旧版画像按当前结构迁移后返回
+func ParseProfileData(w http.ResponseWriter, profile *models.UserProfile) (*models.Profile, bool) {
+	profileData, err := models.ParseUserProfile(profile)
+	if err != nil {
+		WriteCustomErrorResponse(w, models.CodeServerError, err.Error(), map[string]interface{}{})
 		return nil, false
 	}
 	return profileData, true
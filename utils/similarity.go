@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TextShingles 将文本切分为长度为n的字符片段集合（shingles）
+// 忽略空白和标点，英文统一转为小写，适用于中英文混合文本的近似去重
+func TextShingles(text string, n int) map[string]struct{} {
+	if n <= 0 {
+		n = 2
+	}
+
+	runes := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+
+	shingles := make(map[string]struct{})
+	if len(runes) == 0 {
+		return shingles
+	}
+	if len(runes) < n {
+		shingles[string(runes)] = struct{}{}
+		return shingles
+	}
+	for i := 0; i+n <= len(runes); i++ {
+		shingles[string(runes[i:i+n])] = struct{}{}
+	}
+	return shingles
+}
+
+// JaccardSimilarity 计算两个片段集合的Jaccard相似度，范围0-1
+func JaccardSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	// 遍历较小的集合
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	intersection := 0
+	for s := range a {
+		if _, ok := b[s]; ok {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	return float64(intersection) / float64(union)
+}
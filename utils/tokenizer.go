@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isCJK 判断字符是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// TokenizeForSearch 将文本切分为全文检索用的词元
+// 连续的中日韩文字切分为相邻二元组（bigram），单个字时保留单字；
+// 英文和数字按连续片段切分并转为小写；空白和标点作为分隔符
+func TokenizeForSearch(text string) []string {
+	tokens := make([]string, 0, len(text)/2)
+	var cjkRun []rune
+	var word strings.Builder
+
+	flushCJK := func() {
+		switch {
+		case len(cjkRun) == 1:
+			tokens = append(tokens, string(cjkRun))
+		case len(cjkRun) > 1:
+			for i := 0; i+2 <= len(cjkRun); i++ {
+				tokens = append(tokens, string(cjkRun[i:i+2]))
+			}
+		}
+		cjkRun = cjkRun[:0]
+	}
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjkRun = append(cjkRun, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word.WriteRune(r)
+		default:
+			flushCJK()
+			flushWord()
+		}
+	}
+	flushCJK()
+	flushWord()
+	return tokens
+}
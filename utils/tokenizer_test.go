@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenizeForSearch(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"比特币", []string{"比特", "特币"}},
+		{"币", []string{"币"}},
+		{"比特币ETF上市", []string{"比特", "特币", "etf", "上市"}},
+		{"Web3 钱包，安全！", []string{"web3", "钱包", "安全"}},
+		{"以太坊 2.0", []string{"以太", "太坊", "2", "0"}},
+		{"  ，。 ", []string{}},
+	}
+	for _, tt := range tests {
+		if got := TokenizeForSearch(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("TokenizeForSearch(%q) = %q，期望 %q", tt.text, got, tt.want)
+		}
+	}
+}